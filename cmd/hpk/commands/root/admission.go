@@ -87,11 +87,11 @@ func AddAdmissionWebhooks(c Opts, virtualk8s *provider.VirtualK8S) {
 	 * Add handlers for Logs and Statistics
 	 *---------------------------------------------------*/
 	api.AttachPodRoutes(api.PodHandlerConfig{
-		RunInContainer:   virtualk8s.RunInContainer,
-		GetContainerLogs: virtualk8s.GetContainerLogs,
-		GetPods:          virtualk8s.GetPods,
-		PortForward:      virtualk8s.PortForward,
-		// AttachToContainer: ,
+		RunInContainer:    virtualk8s.RunInContainer,
+		GetContainerLogs:  virtualk8s.GetContainerLogs,
+		GetPods:           virtualk8s.GetPods,
+		PortForward:       virtualk8s.PortForward,
+		AttachToContainer: virtualk8s.AttachToContainer,
 		// GetPodsFromKubernetes: func(context.Context) ([]*corev1.Pod, error) {
 		//	return k8sclientset.CoreV1().Pods(c.KubeNamespace).List(ctx, labels.Everything())
 		// },
@@ -16,9 +16,14 @@ package root
 
 import (
 	"os"
+	"strings"
 	"time"
 
 	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/podhandler"
+	"github.com/carv-ics-forth/hpk/compute/runtime"
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
+	"github.com/carv-ics-forth/hpk/provider"
 	"github.com/spf13/pflag"
 	corev1 "k8s.io/api/core/v1"
 )
@@ -49,8 +54,29 @@ type Opts struct {
 	// Node name to use when creating a node in Kubernetes
 	NodeName string
 
+	// NodePerPartition registers one virtual node per Slurm partition, instead of a single node for the whole cluster.
+	NodePerPartition bool
+
+	// NodeStatusInterval defines how often the capacity and the health of the virtual nodes are refreshed.
+	NodeStatusInterval time.Duration
+
+	// ResourceMappings translate extended resources into Slurm, in the form '<resource>=<kind>[:<name>]'.
+	ResourceMappings []string
+
+	// PriorityMappings translate the priority of pods into Slurm, in the form '<selector>=[<qos>][:<nice>]'.
+	PriorityMappings []string
+
+	// MaxPodsPerNode is the number of pods advertised for every Slurm node. 0 means one pod per cpu.
+	MaxPodsPerNode int
+
+	// PartitionTaints lists the partitions whose virtual nodes are tainted with their partition name.
+	PartitionTaints []string
+
 	FSPollingInterval time.Duration
 
+	// JobSyncInterval defines how often pods are reconciled against the state of their Slurm jobs.
+	JobSyncInterval time.Duration
+
 	// Number of workers to use to handle pod notifications
 	PodSyncWorkers       int
 	InformerResyncPeriod time.Duration
@@ -58,6 +84,24 @@ type Opts struct {
 	// Startup Timeout is how long to wait for the kubelet to start
 	StartupTimeout time.Duration
 
+	// Scheduler selects the batch system that runs the pods ("slurm" or "local").
+	Scheduler string
+
+	// JobArrayWindow is how long to wait for the pods of an Indexed Job, before submitting them as a job array.
+	JobArrayWindow time.Duration
+
+	// Pilot configures the pilot jobs, when the "pilot" scheduler is used.
+	Pilot scheduler.PilotOptions
+
+	// SlurmBackend selects how HPK talks with Slurm ("cli" or "rest").
+	SlurmBackend string
+
+	// SlurmRest configures the access to slurmrestd, when the "rest" backend is used.
+	SlurmRestURL        string
+	SlurmRestAPIVersion string
+	SlurmRestUser       string
+	SlurmRestToken      string
+
 	DisableTaint bool
 	TaintKey     string
 	TaintValue   string
@@ -68,6 +112,7 @@ const (
 	EnvKubeletAddress  = "VKUBELET_ADDRESS"
 	EnvAPICertLocation = "APISERVER_CERT_LOCATION"
 	EnvAPIKeyLocation  = "APISERVER_KEY_LOCATION"
+	EnvSlurmJWT        = "SLURM_JWT"
 )
 
 func installFlags(flags *pflag.FlagSet, c *Opts) {
@@ -82,16 +127,42 @@ func installFlags(flags *pflag.FlagSet, c *Opts) {
 
 	flags.StringVar(&c.KubeNamespace, "namespace", corev1.NamespaceAll, "kubernetes namespace (default is 'all')")
 	flags.StringVar(&c.NodeName, "nodename", "hpk-kubelet", "kubernetes node name")
+	flags.BoolVar(&c.NodePerPartition, "node-per-partition", false, "register one virtual node per Slurm partition, named <nodename>-<partition>")
+	flags.DurationVar(&c.NodeStatusInterval, "node-status-period", 30*time.Second, "how often to refresh the capacity, allocatable resources, and Slurm health conditions of the virtual nodes. 0 disables it")
+	flags.StringSliceVar(&c.ResourceMappings, "resource-mapping", []string{"nvidia.com/gpu=gres:gpu"}, "translate extended resources into Slurm, as <resource>=<kind>[:<name>]. Kind is one of: gres, gpus-per-node, licenses (e.g, amd.com/gpu=gpus-per-node, example.com/matlab=licenses:matlab)")
+	flags.StringSliceVar(&c.PriorityMappings, "priority-mapping", nil, "translate the priority of pods into the qos and the nice value of their Slurm jobs, as <selector>=[<qos>][:<nice>]. The selector is a PriorityClass name, or a priority range <min>..<max>. The first matching mapping applies (e.g, system-cluster-critical=urgent, 1000..=high:-100, ..-1=:10000)")
+	flags.IntVar(&c.MaxPodsPerNode, "max-pods-per-node", 0, "maximum number of pods advertised for every Slurm node, or for the host of the local scheduler. 0 means one pod per cpu")
+	flags.StringSliceVar(&c.PartitionTaints, "partition-taints", nil, "partitions whose virtual nodes are tainted with '"+provider.PartitionLabel+"=<partition>'. Requires --node-per-partition")
 
 	flags.StringVar(&c.DefaultHostEnvironment.PodmanBin, "podman", "podman-hpc", "path to Podman bin")
+	flags.StringVar(&c.DefaultHostEnvironment.ContainerRuntime, "container-runtime", runtime.NamePodmanHPC, "the runtime for the containers of pods, unless overridden by the '"+runtime.SlurmContainerRuntime+"' annotation. One of: "+strings.Join(runtime.Names(), ", "))
+	flags.StringVar(&c.DefaultHostEnvironment.PauseBin, "pause", "hpk-pause", "path to hpk-pause bin, as seen from the Slurm nodes")
 	flags.StringVar(&c.DefaultHostEnvironment.ContainerRegistry, "registry", "docker://", "container registry")
 	flags.StringVar(&c.DefaultHostEnvironment.WorkingDirectory, "working-dir", GetUserHomeDir(), "sets up the HPK's working directory")
 	// Set up config filepath for Slurm
 	// flags.StringVar(&c.DefaultHostEnvironment.SlurmConfigFilePath, "/config.json", , "sets up the HPK's working directory")
 
+	flags.StringSliceVar(&c.DefaultHostEnvironment.AllowedPodOverrides, "allowed-pod-overrides", podhandler.PolicyOverrideNames(), "namespace-level Slurm options that pods can override with annotations. One or more of: "+strings.Join(podhandler.PolicyOverrideNames(), ", "))
+
 	flags.BoolVar(&c.DefaultHostEnvironment.EnableCgroupV2, "enable-cgroupv2", false, "Enable support for cgroupv2.")
 	flags.DurationVar(&c.FSPollingInterval, "poll", 5*time.Second, "if greater than 0, it will use a poll based approach to watch for file system changes")
 
+	flags.DurationVar(&c.JobSyncInterval, "job-sync-period", 30*time.Second, "how often to reconcile pods against the state of their Slurm jobs. 0 disables it")
+
+	flags.StringVar(&c.Scheduler, "scheduler", scheduler.BackendSlurm, "the batch system that runs the pods. One of: slurm, pilot (packs pods into long-lived Slurm allocations), local (runs pods as processes on this host, for development)")
+	flags.Int64Var(&c.Pilot.CPUs, "pilot-cpus", 16, "cpus of every pilot job, used by the pilot scheduler")
+	flags.Int64Var(&c.Pilot.MemoryMB, "pilot-memory", 32768, "memory of every pilot job in megabytes, used by the pilot scheduler")
+	flags.IntVar(&c.Pilot.MaxPilots, "pilot-max", 4, "maximum number of pilot jobs. Pods that do not fit in the pilots are submitted as regular jobs")
+	flags.DurationVar(&c.Pilot.IdleTimeout, "pilot-idle-timeout", 10*time.Minute, "how long a pilot job may remain without pods, before it is released")
+	flags.DurationVar(&c.Pilot.SyncInterval, "pilot-sync-period", 10*time.Second, "how often to check the pilot jobs for termination and idleness")
+	flags.StringSliceVar(&c.Pilot.Flags, "pilot-flags", nil, "additional sbatch flags for the pilot jobs (e.g, --partition=short,--time=04:00:00)")
+	flags.DurationVar(&c.JobArrayWindow, "job-array-window", 5*time.Second, "how long to wait for the pods of an Indexed Job before submitting them as a single Slurm job array. 0 submits every pod separately")
+	flags.StringVar(&c.SlurmBackend, "slurm-backend", "cli", "how to talk with Slurm. One of: cli, rest")
+	flags.StringVar(&c.SlurmRestURL, "slurmrestd-url", "", "address of slurmrestd (e.g, http://localhost:6820), used by the rest backend")
+	flags.StringVar(&c.SlurmRestAPIVersion, "slurmrestd-api-version", "v0.0.39", "version of the slurmrestd API")
+	flags.StringVar(&c.SlurmRestUser, "slurmrestd-user", os.Getenv("USER"), "user name for authenticating with slurmrestd")
+	flags.StringVar(&c.SlurmRestToken, "slurmrestd-token", os.Getenv(EnvSlurmJWT), "JWT for authenticating with slurmrestd")
+
 	flags.IntVar(&c.PodSyncWorkers, "pod-sync-workers", 1, `set the number of pod synchronization workers`)
 	flags.DurationVar(&c.InformerResyncPeriod, "full-resync-period", 0, "how often to perform a full resync of pods between kubernetes and the provider")
 
@@ -37,7 +37,12 @@ func AddInformers(ctx context.Context, c Opts, k8sclientset *kubernetes.Clientse
 		k8sclientset,
 		c.InformerResyncPeriod,
 		kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
-			options.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", c.NodeName).String()
+			// the pods of the per-partition nodes are filtered by the pod controller.
+			if c.NodePerPartition {
+				options.FieldSelector = fields.OneTermNotEqualSelector("spec.nodeName", "").String()
+			} else {
+				options.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", c.NodeName).String()
+			}
 		}),
 	)
 	podInformer := podInformerFactory.Core().V1().Pods()
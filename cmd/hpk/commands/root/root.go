@@ -20,10 +20,16 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/carv-ics-forth/hpk/cmd/hpk/commands"
 	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/compute/podhandler"
+	"github.com/carv-ics-forth/hpk/compute/runtime"
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
 	"github.com/hashicorp/go-multierror"
 	"github.com/sirupsen/logrus"
 	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
@@ -32,6 +38,7 @@ import (
 	"golang.org/x/time/rate"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -91,6 +98,64 @@ func NewCommand(ctx context.Context, name string, c Opts) *cobra.Command {
 				merr = multierror.Append(merr, errors.Errorf("empty key path. Use flags or set %s", EnvAPIKeyLocation))
 			}
 
+			for _, name := range c.DefaultHostEnvironment.AllowedPodOverrides {
+				if !slices.Contains(podhandler.PolicyOverrideNames(), name) {
+					merr = multierror.Append(merr, errors.Errorf("unknown pod override '%s'", name))
+				}
+			}
+
+			if _, err := runtime.Lookup(c.DefaultHostEnvironment.ContainerRuntime); err != nil {
+				merr = multierror.Append(merr, err)
+			}
+
+			switch c.Scheduler {
+			case scheduler.BackendSlurm, scheduler.BackendLocal:
+			case scheduler.BackendPilot:
+				if c.Pilot.CPUs <= 0 || c.Pilot.MemoryMB <= 0 || c.Pilot.MaxPilots <= 0 {
+					merr = multierror.Append(merr, errors.New("the pilot cpus, memory, and max must be positive"))
+				}
+
+				if c.Pilot.SyncInterval <= 0 {
+					merr = multierror.Append(merr, errors.New("the pilot sync period must be positive"))
+				}
+			default:
+				merr = multierror.Append(merr, errors.Errorf("unknown scheduler '%s'", c.Scheduler))
+			}
+
+			if _, err := slurm.ParseResourceMappings(c.ResourceMappings); err != nil {
+				merr = multierror.Append(merr, err)
+			}
+
+			if _, err := slurm.ParsePriorityMappings(c.PriorityMappings); err != nil {
+				merr = multierror.Append(merr, err)
+			}
+
+			if c.MaxPodsPerNode < 0 {
+				merr = multierror.Append(merr, errors.New("max pods per node must not be negative"))
+			}
+
+			if c.NodePerPartition && c.Scheduler != scheduler.BackendSlurm {
+				merr = multierror.Append(merr, errors.New("--node-per-partition requires the slurm scheduler"))
+			}
+
+			if len(c.PartitionTaints) > 0 && !c.NodePerPartition {
+				merr = multierror.Append(merr, errors.New("--partition-taints requires --node-per-partition"))
+			}
+
+			switch c.SlurmBackend {
+			case "cli":
+			case "rest":
+				if c.SlurmRestURL == "" {
+					merr = multierror.Append(merr, errors.New("the rest backend requires --slurmrestd-url"))
+				}
+
+				if c.SlurmRestToken == "" {
+					merr = multierror.Append(merr, errors.Errorf("empty slurmrestd token. Use flags or set %s", EnvSlurmJWT))
+				}
+			default:
+				merr = multierror.Append(merr, errors.Errorf("unknown slurm backend '%s'", c.SlurmBackend))
+			}
+
 			if merr.ErrorOrNil() != nil {
 				return merr.ErrorOrNil()
 			}
@@ -155,6 +220,46 @@ func runRootCommand(ctx context.Context, c Opts) error {
 		)
 	}
 
+	/*---------------------------------------------------
+	 * Setup the connection to Slurm
+	 *---------------------------------------------------*/
+	if c.SlurmBackend == "rest" {
+		slurm.Slurm.Client = slurm.NewREST(c.SlurmRestURL, c.SlurmRestAPIVersion, c.SlurmRestUser, c.SlurmRestToken)
+	}
+
+	slurm.Slurm.ArrayWindow = c.JobArrayWindow
+	slurm.Slurm.PodsPerNode = c.MaxPodsPerNode
+
+	slurm.Slurm.ResourceMappings, err = slurm.ParseResourceMappings(c.ResourceMappings)
+	if err != nil {
+		return errors.Wrapf(err, "invalid resource mappings")
+	}
+
+	slurm.Slurm.PriorityMappings, err = slurm.ParsePriorityMappings(c.PriorityMappings)
+	if err != nil {
+		return errors.Wrapf(err, "invalid priority mappings")
+	}
+
+	switch c.Scheduler {
+	case scheduler.BackendLocal:
+		scheduler.Default = scheduler.NewLocal()
+
+	case scheduler.BackendPilot:
+		pilot, err := scheduler.NewPilot(endpoint.HPK(c.DefaultHostEnvironment.WorkingDirectory).PilotDir(), c.Pilot)
+		if err != nil {
+			return errors.Wrapf(err, "unable to start the pilot scheduler")
+		}
+
+		go pilot.Run(ctx)
+
+		scheduler.Default = pilot
+	}
+
+	DefaultLogger.Info("Scheduler is ready",
+		"scheduler", c.Scheduler,
+		"backend", c.SlurmBackend,
+	)
+
 	/*---------------------------------------------------
 	 * Discover Kubernetes DNS server
 	 *---------------------------------------------------*/
@@ -187,6 +292,7 @@ func runRootCommand(ctx context.Context, c Opts) error {
 		DaemonPort:        c.KubeletPort,
 		BuildVersion:      commands.BuildVersion,
 		FSPollingInterval: c.FSPollingInterval,
+		JobSyncInterval:   c.JobSyncInterval,
 		RestConfig:        restConfig,
 	})
 	if err != nil {
@@ -200,6 +306,22 @@ func runRootCommand(ctx context.Context, c Opts) error {
 		"DaemonPort", virtualk8s.DaemonPort,
 	)
 
+	/*---------------------------------------------------
+	 * Build the Virtual Nodes
+	 *---------------------------------------------------*/
+	var taint *corev1.Taint
+	if !c.DisableTaint {
+		taint, err = getTaint(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	virtualNodes, err := newVirtualNodes(ctx, c, virtualk8s, taint)
+	if err != nil {
+		return err
+	}
+
 	/*---------------------------------------------------
 	 * Create Informers for CRDs and Pod Controller
 	 *---------------------------------------------------*/
@@ -217,11 +339,14 @@ func runRootCommand(ctx context.Context, c Opts) error {
 
 		eb := record.NewBroadcaster()
 		eb.StartLogging(logrus.Infof)
+		eb.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: compute.K8SClientset.CoreV1().Events("")})
+
+		compute.EventRecorder = eb.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "hpk-controller", Host: c.NodeName})
 
 		pc, err := node.NewPodController(node.PodControllerConfig{
 			PodClient:                            compute.K8SClientset.CoreV1(),
 			PodInformer:                          podInformer,
-			EventRecorder:                        eb.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "hpk-controller"}),
+			EventRecorder:                        compute.EventRecorder,
 			Provider:                             virtualk8s,
 			ConfigMapInformer:                    configMapInformer,
 			SecretInformer:                       secretInformer,
@@ -229,6 +354,15 @@ func runRootCommand(ctx context.Context, c Opts) error {
 			SyncPodsFromKubernetesRateLimiter:    rateLimiter(),
 			DeletePodsFromKubernetesRateLimiter:  rateLimiter(),
 			SyncPodStatusFromProviderRateLimiter: rateLimiter(),
+			PodEventFilterFunc: func(_ context.Context, pod *corev1.Pod) bool {
+				if !c.NodePerPartition {
+					return true
+				}
+
+				_, owned := compute.Environment.NodePartitions[pod.Spec.NodeName]
+
+				return owned
+			},
 		})
 		if err != nil {
 			return err
@@ -265,76 +399,152 @@ func runRootCommand(ctx context.Context, c Opts) error {
 	}
 
 	/*---------------------------------------------------
-	 * Create Node Controller
+	 * Create Node Controllers
 	 *---------------------------------------------------*/
 	{
-		np := node.NewNaiveNodeProvider()
+		controllers := make([]*node.NodeController, 0, len(virtualNodes))
 
-		var taint *corev1.Taint
-		if !c.DisableTaint {
-			taint, err = getTaint(c)
+		for _, virtualNode := range virtualNodes {
+			nc, err := runNodeController(ctx, virtualNode, c.NodeStatusInterval, c.Scheduler)
 			if err != nil {
 				return err
 			}
+
+			controllers = append(controllers, nc)
 		}
 
-		virtualNode := virtualk8s.NewVirtualNode(ctx, c.NodeName, taint)
+		DefaultLogger.Info("Node Controller is Ready", "nodes", len(controllers))
 
-		nc, err := node.NewNodeController(
-			np,
-			virtualNode,
-			compute.K8SClientset.CoreV1().Nodes(),
-			node.WithNodeEnableLeaseV1(compute.K8SClientset.CoordinationV1().Leases(corev1.NamespaceNodeLease), 0),
-			node.WithNodeStatusUpdateErrorHandler(func(ctx context.Context, err error) error {
-				if !k8serrors.IsNotFound(err) {
-					return err
-				}
+		DefaultLogger.Info("... HPK is successfully initialized and waiting for jobs....")
 
-				DefaultLogger.Info("node not found")
-				newNode := virtualNode.DeepCopy()
-				newNode.ResourceVersion = ""
+		// wait for as long the app is running
+		for _, nc := range controllers {
+			<-nc.Done()
+		}
 
-				if _, err = compute.K8SClientset.CoreV1().Nodes().Create(ctx, newNode, metav1.CreateOptions{}); err != nil {
-					return err
-				}
+		DefaultLogger.Info("... HPK has been gracefully terminated ....")
+	}
+
+	return nil
+}
+
+// newVirtualNodes builds either a single virtual node for the whole cluster, or one virtual node per Slurm partition.
+func newVirtualNodes(ctx context.Context, c Opts, virtualk8s *provider.VirtualK8S, taint *corev1.Taint) ([]*corev1.Node, error) {
+	if !c.NodePerPartition {
+		return []*corev1.Node{virtualk8s.NewVirtualNode(ctx, c.NodeName, taint)}, nil
+	}
+
+	partitions, err := slurm.Partitions()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to discover the Slurm partitions")
+	}
+
+	if len(partitions) == 0 {
+		return nil, errors.New("no Slurm partition was found")
+	}
+
+	compute.Environment.NodePartitions = make(map[string]string, len(partitions))
+
+	virtualNodes := make([]*corev1.Node, 0, len(partitions))
+
+	for _, partition := range partitions {
+		var taints []corev1.Taint
+
+		if taint != nil {
+			taints = append(taints, *taint)
+		}
+
+		if slices.Contains(c.PartitionTaints, partition.Name) {
+			taints = append(taints, corev1.Taint{
+				Key:    provider.PartitionLabel,
+				Value:  partition.Name,
+				Effect: corev1.TaintEffectNoSchedule,
+			})
+		}
+
+		nodename := provider.PartitionNodeName(c.NodeName, partition.Name)
+
+		compute.Environment.NodePartitions[nodename] = partition.Name
 
-				DefaultLogger.Info("created new node")
-				return nil
-			}),
+		virtualNodes = append(virtualNodes, virtualk8s.NewPartitionNode(ctx, nodename, partition, taints))
+
+		DefaultLogger.Info("Virtual Node for partition",
+			"node", nodename,
+			"partition", partition.Name,
+			"features", partition.Features,
 		)
-		if err != nil {
-			return err
+	}
+
+	return virtualNodes, nil
+}
+
+// runNodeController registers the virtual node to Kubernetes, and waits until it is marked as ready.
+// The capacity and the health of the node are refreshed every interval.
+func runNodeController(ctx context.Context, virtualNode *corev1.Node, interval time.Duration, backend string) (*node.NodeController, error) {
+	capacity := scheduler.Default.Capacity
+
+	health := slurm.CheckHealth
+
+	if backend == scheduler.BackendLocal {
+		// there are no partitions to check.
+		health = func() slurm.Health {
+			return slurm.Health{ControllerErr: scheduler.Default.Ping()}
 		}
+	}
 
-		// Start the Node controller.
-		go func() {
-			if err := nc.Run(ctx); err != nil && err != context.Canceled {
-				DefaultLogger.Error(err, "NodeController has failed")
+	if partition, exists := compute.Environment.NodePartitions[virtualNode.GetName()]; exists {
+		capacity = func() (corev1.ResourceList, corev1.ResourceList, error) {
+			return slurm.PartitionResources(partition)
+		}
+	}
 
-				// handle error
+	np := provider.NewNodeProvider(virtualNode, interval, capacity, health)
+
+	nc, err := node.NewNodeController(
+		np,
+		virtualNode,
+		compute.K8SClientset.CoreV1().Nodes(),
+		node.WithNodeEnableLeaseV1(compute.K8SClientset.CoordinationV1().Leases(corev1.NamespaceNodeLease), 0),
+		node.WithNodeStatusUpdateErrorHandler(func(ctx context.Context, err error) error {
+			if !k8serrors.IsNotFound(err) {
+				return err
 			}
-		}()
 
-		// Wait for node controller to become ready
-		<-nc.Ready()
+			DefaultLogger.Info("node not found", "node", virtualNode.GetName())
+			newNode := virtualNode.DeepCopy()
+			newNode.ResourceVersion = ""
 
-		// If we got here, set Node condition Ready.
-		setNodeReady(virtualNode)
-		if err := np.UpdateStatus(ctx, virtualNode); err != nil {
-			return errors.Wrap(err, "error marking the node as ready")
-		}
+			if _, err = compute.K8SClientset.CoreV1().Nodes().Create(ctx, newNode, metav1.CreateOptions{}); err != nil {
+				return err
+			}
+
+			DefaultLogger.Info("created new node", "node", virtualNode.GetName())
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
 
-		DefaultLogger.Info("Node Controller is Ready")
+	// Start the Node controller.
+	go func() {
+		if err := nc.Run(ctx); err != nil && err != context.Canceled {
+			DefaultLogger.Error(err, "NodeController has failed", "node", virtualNode.GetName())
 
-		DefaultLogger.Info("... HPK is successfully initialized and waiting for jobs....")
+			// handle error
+		}
+	}()
 
-		// wait for as long the app is running
-		<-nc.Done()
+	// Wait for node controller to become ready
+	<-nc.Ready()
 
-		DefaultLogger.Info("... HPK has been gracefully terminated ....")
+	// If we got here, set Node condition Ready.
+	setNodeReady(virtualNode)
+	if err := np.UpdateStatus(ctx, virtualNode); err != nil {
+		return nil, errors.Wrap(err, "error marking the node as ready")
 	}
 
-	return nil
+	return nc, nil
 }
 
 func rateLimiter() workqueue.RateLimiter {
@@ -18,6 +18,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -46,8 +47,42 @@ const (
 
 	// ExtensionJobID describes the file  where the sbatch script will write its job id.
 	ExtensionJobID ControlFileType = ".jobid"
+
+	// ExtensionRestartCount describes the file where hpk-pause writes the number of restarts of a container.
+	// It is rewritten whenever the container is about to be restarted.
+	ExtensionRestartCount ControlFileType = ".restartCount"
+
+	// ExtensionLastExitCode describes the file where hpk-pause writes the exit code of the previous run of a container.
+	ExtensionLastExitCode ControlFileType = ".lastExitCode"
+
+	// ExtensionStarted describes the file where hpk-pause writes the result of the startup probe of a container.
+	ExtensionStarted ControlFileType = ".started"
+
+	// ExtensionReady describes the file where hpk-pause writes the result of the readiness probe of a container.
+	// It is rewritten whenever the readiness of the container changes.
+	ExtensionReady ControlFileType = ".ready"
+
+	// ExtensionPostStartError describes the file where hpk-pause writes the failure of the postStart hook of a container.
+	ExtensionPostStartError ControlFileType = ".postStartError"
+
+	// ExtensionPreStopError describes the file where hpk-pause writes the failure of the preStop hook of a container.
+	ExtensionPreStopError ControlFileType = ".preStopError"
 )
 
+// NodeSuffix marks the control files written by the secondary nodes of multi-node pods (e.g, .ip.node1).
+const NodeSuffix = ".node"
+
+// ParseControlFileType returns the type of the control file, and the rank of the node that has written it.
+func ParseControlFileType(fileName string) (fileType ControlFileType, rank int) {
+	if base, rawRank, found := strings.Cut(fileName, NodeSuffix); found {
+		if r, err := strconv.Atoi(rawRank); err == nil {
+			return filepath.Ext(base), r
+		}
+	}
+
+	return filepath.Ext(fileName), 0
+}
+
 // Pod-Related Extensions
 const (
 	// ExtensionCRD describes the file where HPK will write the pod definition.
@@ -67,6 +102,9 @@ const (
 
 	// ExtensionLogs describes the file  where the sbatch script will write its logs.
 	ExtensionLogs = ".logs"
+
+	// ExtensionPreviousLogs describes the file where hpk-pause keeps the logs of the previous run of a container.
+	ExtensionPreviousLogs = ".previous.logs"
 )
 
 type HPKPath string
@@ -91,6 +129,11 @@ func (p HPKPath) CorruptedDir() string {
 	return filepath.Join(string(p), ".corrupted")
 }
 
+// PilotDir holds the agent and the tasks of the pilot jobs.
+func (p HPKPath) PilotDir() string {
+	return filepath.Join(string(p), ".pilots")
+}
+
 type WalkPodFunc func(path PodPath) error
 
 func (p HPKPath) WalkPodDirectories(f WalkPodFunc) error {
@@ -108,7 +151,7 @@ func (p HPKPath) WalkPodDirectories(f WalkPodFunc) error {
 		}
 
 		// skip the systems paths.
-		if path == p.CorruptedDir() || path == p.ImageDir() {
+		if path == p.CorruptedDir() || path == p.ImageDir() || path == p.PilotDir() {
 			return filepath.SkipDir
 		}
 
@@ -215,14 +258,47 @@ func (p PodPath) ControlFileDir() string {
 	return filepath.Join(string(p), "controlfiles")
 }
 
+// AttemptDir $HPK/<namespace>/<podName>/attempts/<attempt> holds the control files of a previous attempt
+// of a requeued Slurm job.
+func (p PodPath) AttemptDir(attempt int) string {
+	return filepath.Join(string(p), "attempts", strconv.Itoa(attempt))
+}
+
+// ArchiveControlFiles moves the control files of the given attempt into its AttemptDir,
+// so that the next attempt of the job starts with an empty ControlFileDir.
+func (p PodPath) ArchiveControlFiles(attempt int) error {
+	archiveDir := p.AttemptDir(attempt)
+
+	if err := os.MkdirAll(archiveDir, PodGlobalDirectoryPermissions); err != nil {
+		return errors.Wrapf(err, "cannot create archive directory '%s'", archiveDir)
+	}
+
+	files, err := os.ReadDir(p.ControlFileDir())
+	if err != nil {
+		return errors.Wrapf(err, "cannot list control files")
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		if err := os.Rename(filepath.Join(p.ControlFileDir(), file.Name()), filepath.Join(archiveDir, file.Name())); err != nil {
+			return errors.Wrapf(err, "cannot archive control file '%s'", file.Name())
+		}
+	}
+
+	return nil
+}
+
 // EncodedJSONPath .hpk/namespace/podName/.virtualenv/pod.crd
 func (p PodPath) EncodedJSONPath() string {
 	return filepath.Join(p.JobDir(), "pod"+ExtensionCRD)
 }
 
-// ConstructorFilePath .hpk/namespace/podName/.virtualenv/constructor.sh
-func (p PodPath) ConstructorFilePath() string {
-	return filepath.Join(p.JobDir(), "constructor.sh")
+// PauseSpecPath .hpk/namespace/podName/.virtualenv/pause.json
+func (p PodPath) PauseSpecPath() string {
+	return filepath.Join(p.JobDir(), "pause.json")
 }
 
 // CgroupFilePath .hpk/namespace/podName/.virtualenv/cgroup.toml
@@ -255,6 +331,16 @@ func (p PodPath) IPAddressPath() string {
 	return filepath.Join(p.ControlFileDir(), string(ExtensionIP))
 }
 
+// NodeIPAddressPath points to the ip file of the given node of a multi-node pod.
+// The first node (rank 0) uses IPAddressPath, and the rest suffix it with their rank (e.g, .ip.node1).
+func (p PodPath) NodeIPAddressPath(rank int) string {
+	if rank == 0 {
+		return p.IPAddressPath()
+	}
+
+	return p.IPAddressPath() + NodeSuffix + strconv.Itoa(rank)
+}
+
 /*
 	Container-Related paths captured by Slurm Notifier.
 	They are necessary to drive the lifecycle of a Container.
@@ -276,6 +362,11 @@ func (c ContainerPath) LogsPath() string {
 	return filepath.Join(c.p.LogDir(), c.containerName+ExtensionLogs)
 }
 
+// PreviousLogsPath holds the logs of the previous run of a restarted container (e.g, kubectl logs --previous).
+func (c ContainerPath) PreviousLogsPath() string {
+	return filepath.Join(c.p.LogDir(), c.containerName+ExtensionPreviousLogs)
+}
+
 func (c ContainerPath) IDPath() string {
 	return filepath.Join(c.p.ControlFileDir(), c.containerName+string(ExtensionJobID))
 }
@@ -284,6 +375,30 @@ func (c ContainerPath) ExitCodePath() string {
 	return filepath.Join(c.p.ControlFileDir(), c.containerName+string(ExtensionExitCode))
 }
 
+func (c ContainerPath) RestartCountPath() string {
+	return filepath.Join(c.p.ControlFileDir(), c.containerName+string(ExtensionRestartCount))
+}
+
+func (c ContainerPath) LastExitCodePath() string {
+	return filepath.Join(c.p.ControlFileDir(), c.containerName+string(ExtensionLastExitCode))
+}
+
+func (c ContainerPath) StartedPath() string {
+	return filepath.Join(c.p.ControlFileDir(), c.containerName+string(ExtensionStarted))
+}
+
+func (c ContainerPath) ReadyPath() string {
+	return filepath.Join(c.p.ControlFileDir(), c.containerName+string(ExtensionReady))
+}
+
+func (c ContainerPath) PostStartErrorPath() string {
+	return filepath.Join(c.p.ControlFileDir(), c.containerName+string(ExtensionPostStartError))
+}
+
+func (c ContainerPath) PreStopErrorPath() string {
+	return filepath.Join(c.p.ControlFileDir(), c.containerName+string(ExtensionPreStopError))
+}
+
 /*
 	Container-Related paths not captured by Slurm Notifier.
 	They are needed for HPK to bootstrap a container.
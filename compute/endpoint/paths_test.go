@@ -1,6 +1,8 @@
 package endpoint
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -89,3 +91,51 @@ func TestHPKPath_ParseAbsPath(t *testing.T) {
 		})
 	}
 }
+
+func TestParseControlFileType(t *testing.T) {
+	tests := []struct {
+		fileName string
+		wantType ControlFileType
+		wantRank int
+	}{
+		{fileName: ".ip", wantType: ExtensionIP, wantRank: 0},
+		{fileName: ".ip.node3", wantType: ExtensionIP, wantRank: 3},
+		{fileName: "main.exitCode", wantType: ExtensionExitCode, wantRank: 0},
+		{fileName: "main.exitCode.node1", wantType: ExtensionExitCode, wantRank: 1},
+		{fileName: "main.jobid", wantType: ExtensionJobID, wantRank: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			gotType, gotRank := ParseControlFileType(tt.fileName)
+			if gotType != tt.wantType || gotRank != tt.wantRank {
+				t.Errorf("ParseControlFileType() = (%v, %v), want (%v, %v)", gotType, gotRank, tt.wantType, tt.wantRank)
+			}
+		})
+	}
+}
+
+func TestPodPath_ArchiveControlFiles(t *testing.T) {
+	podDir := PodPath(t.TempDir())
+
+	if err := os.MkdirAll(podDir.ControlFileDir(), PodGlobalDirectoryPermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{podDir.IPAddressPath(), podDir.Container("main").ExitCodePath()} {
+		if err := os.WriteFile(file, []byte("1"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := podDir.ArchiveControlFiles(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, _ := os.ReadDir(podDir.ControlFileDir()); len(files) != 0 {
+		t.Errorf("control files of the previous attempt were not moved: %v", files)
+	}
+
+	if _, err := os.Stat(filepath.Join(podDir.AttemptDir(0), "main"+ExtensionExitCode)); err != nil {
+		t.Errorf("control files were not archived: %v", err)
+	}
+}
@@ -17,6 +17,7 @@ package compute
 import (
 	"github.com/carv-ics-forth/hpk/compute/endpoint"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
@@ -27,12 +28,24 @@ type HostEnvironment struct {
 	ContainerRegistry string
 	PodmanBin      string
 
+	// ContainerRuntime is the default runtime for the containers of pods (e.g, apptainer, podman-hpc).
+	ContainerRuntime string
+
+	// PauseBin is the hpk-pause binary, which runs the containers of pods within their Slurm allocations.
+	PauseBin string
+
 	EnableCgroupV2 bool
 
 	WorkingDirectory string
 
 	// KubeDNS points to the internal DNS of a Kubernetes cluster.
 	KubeDNS string
+
+	// AllowedPodOverrides lists the namespace-level Slurm options (e.g, account, partition) that pods can override.
+	AllowedPodOverrides []string
+
+	// NodePartitions maps the name of each per-partition virtual node to its Slurm partition.
+	NodePartitions map[string]string
 }
 
 // The VirtualEnvironment create lightweight "virtual environments" that resemble "Pods" semantics.
@@ -43,8 +56,8 @@ type VirtualEnvironment struct {
 	// CgroupFilePath points to the cgroup configuration for the virtual environment.
 	CgroupFilePath string
 
-	// ConstructorFilePath points to the script for creating the virtual environment for Pod.
-	ConstructorFilePath string
+	// PauseSpecPath points to the spec from which hpk-pause creates the virtual environment for Pod.
+	PauseSpecPath string
 
 	// IPAddressPath is where we store the internal Pod's ip.
 	IPAddressPath string
@@ -69,5 +82,8 @@ var (
 	K8SClient    client.Client
 	K8SClientset *kubernetes.Clientset
 
+	// EventRecorder publishes Kubernetes Events about the pods. By default, events are dropped.
+	EventRecorder record.EventRecorder = &record.FakeRecorder{}
+
 	HPK endpoint.HPKPath
 )
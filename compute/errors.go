@@ -32,8 +32,15 @@ var (
 	ReasonUnsupportedFeatures = "UnsupportedFeatures"
 	ReasonExecutionError      = "ExecutionError"
 	ReasonInitializationError = "InitializationError"
+	ReasonDeadlineExceeded    = "DeadlineExceeded"
+
+	ReasonDependencyNeverSatisfied = "DependencyNeverSatisfied"
+	ReasonTerminalLost             = "TerminalLost"
 )
 
+// MessageDeadlineExceeded is the message of kubelet for pods that have exceeded their activeDeadlineSeconds.
+const MessageDeadlineExceeded = "Pod was active on the node longer than the specified deadline"
+
 // Volume Errors
 var (
 	ErrUnboundedPVC         = errors.New("unbound pvc")
@@ -18,6 +18,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/carv-ics-forth/hpk/compute"
@@ -107,8 +108,8 @@ func (h *EventHandler) Listen(ctx context.Context, control PodControl) {
 
 					return
 				case event := <-h.Queue:
-					// filter events other than creations.
-					if !event.Op.Has(fsnotify.Create) {
+					// filter events other than creations, and rewrites of the control files that change over time.
+					if !event.Op.Has(fsnotify.Create) && !(event.Op.Has(fsnotify.Write) && isRewritten(event.Name)) {
 						compute.DefaultLogger.Info("SLURM: omit non-create event", "details", event)
 
 						// return from select
@@ -139,7 +140,14 @@ func (h *EventHandler) Listen(ctx context.Context, control PodControl) {
 					/*---------------------------------------------------
 					 * Declare events that warrant Pod reconciliation
 					 *---------------------------------------------------*/
-					ext := filepath.Ext(file)
+					ext, rank := endpoint.ParseControlFileType(file)
+					if rank > 0 && ext != endpoint.ExtensionIP && ext != endpoint.ExtensionExitCode {
+						/*-- Secondary nodes of multi-node pods only contribute their IPs and exit codes --*/
+						logger.Info("Ignore event from secondary node", "rank", rank, "file", file)
+
+						continue
+					}
+
 					switch ext {
 					case endpoint.ExtensionSysError:
 						/*-- Sbatch failed. Pod should fail immediately without other checks --*/
@@ -179,6 +187,19 @@ func (h *EventHandler) Listen(ctx context.Context, control PodControl) {
 					case endpoint.ExtensionExitCode: // Container Terminated
 						logger.Info("[Slurm] -> Container Terminated", "op", event.Op, "file", file)
 
+					case endpoint.ExtensionRestartCount: // Container Restarting
+						logger.Info("[Slurm] -> Container Restarting", "op", event.Op, "file", file)
+
+					case endpoint.ExtensionStarted, endpoint.ExtensionReady: // Container Probed
+						logger.Info("[Slurm] -> Container Probed", "op", event.Op, "file", file)
+
+					case endpoint.ExtensionPostStartError, endpoint.ExtensionPreStopError: // Container Hook Failed
+						logger.Info("[Slurm] -> Container Hook Failed", "op", event.Op, "file", file)
+
+						if pod, err := control.LoadFromDisk(podkey); err == nil {
+							reportHookFailure(pod, event.Name, ext)
+						}
+
 					default:
 						/*-- Any other file is ignored --*/
 						compute.DefaultLogger.Info("Ignore event", "details", event)
@@ -227,3 +248,32 @@ func (h *EventHandler) Listen(ctx context.Context, control PodControl) {
 		waitGroup.Wait()
 	}
 }
+
+// isRewritten returns true for the control files that hpk-pause rewrites as the containers progress.
+func isRewritten(path string) bool {
+	for _, ext := range []endpoint.ControlFileType{endpoint.ExtensionRestartCount, endpoint.ExtensionReady, endpoint.ExtensionPostStartError} {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reportHookFailure publishes the failure of a lifecycle hook as an Event of the pod, as with the kubelet.
+func reportHookFailure(pod *corev1.Pod, path string, ext endpoint.ControlFileType) {
+	reason, hook := "FailedPostStartHook", "PostStartHook"
+	if ext == endpoint.ExtensionPreStopError {
+		reason, hook = "FailedPreStopHook", "PreStopHook"
+	}
+
+	message, err := os.ReadFile(path)
+	if err != nil {
+		compute.DefaultLogger.Info("cannot read hook failure", "path", path, "err", err.Error())
+	}
+
+	containerName := strings.TrimSuffix(filepath.Base(path), ext)
+
+	compute.EventRecorder.Eventf(pod, corev1.EventTypeWarning, reason, "%s of container %s failed: %s",
+		hook, containerName, strings.TrimSpace(string(message)))
+}
@@ -22,4 +22,5 @@ func (t Transport) Wrap(imageName string) string {
 	return string(t) + imageName
 }
 
-
+// PauseImage is the image that hosts the hpk-pause supervisor.
+const PauseImage = "icsforth/pause:apptainer"
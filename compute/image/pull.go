@@ -16,78 +16,58 @@ package image
 
 import (
 	"strings"
-	"fmt"
+
 	"github.com/carv-ics-forth/hpk/compute"
-	"github.com/carv-ics-forth/hpk/pkg/process"
 	"github.com/pkg/errors"
 )
 
-func Pull(imageDir string, transport Transport, imageName string) (*Image, error) {
+// Puller is implemented by the container runtimes, for downloading images in their own format.
+type Puller interface {
+	// ImageRef returns the reference that the runtime runs the image from (e.g, a file under the image directory).
+	ImageRef(imageDir string, imageName string) string
+
+	// Present returns true if the image is already available at the reference.
+	Present(ref string) (bool, error)
+
+	// Pull downloads the image to the reference.
+	Pull(imageName string, ref string) error
+}
+
+// Pull makes the image available to the runtime, unless it is already present.
+func Pull(puller Puller, imageDir string, imageName string) (*Image, error) {
 	// Remove the digest from the image, because Singularity fails with
 	// "Docker references with both a tag and digest are currently not supported".
 	imageName = strings.Split(imageName, "@")[0]
 
 	/*
-	
-	Keep in mind the ImagePullpolicy implementation for the future 
+
+		Keep in mind the ImagePullpolicy implementation for the future
 
 	*/
 
-	res, err := process.Execute(compute.Environment.PodmanBin, "images", fmt.Sprintf("--format=\"{{.Names}}|{{.IsReadOnly}}\""))
+	ref := puller.ImageRef(imageDir, imageName)
+
+	present, err := puller.Present(ref)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Failed to check the image")
 	}
 
+	if present {
+		compute.DefaultLogger.Info(" * Image already exists", "image", imageName, "path", ref)
 
-	cleanOutput := strings.Trim(string(res), "{}\" \n")
-
-	// TODO: 
-	// Add the tag if there is no tag appending the latest tag
-
-	// Split the output into lines
-	lines := strings.Split(cleanOutput, "\n")
-
-	// Check every line to see if the image already exists
-	for _, line := range lines {
-		
-		// Trim extra quotes and spaces
-		line = strings.Trim(line, "\" ")
-
-		// Split by the '|' character
-		parts := strings.Split(line, "|")
-		if len(parts) != 2 {
-			continue
-		}
-
-		// Extract image name and condition
-		imagePart := strings.Trim(parts[0], "[] ")
-		// remove the tag at the end of the image name
-		imagePart = strings.Split(imagePart, ":")[0]
-		condition := strings.Trim(parts[1], " ")
-
-		// Check if the image name matches and condition is true
-		if imagePart == imageName && condition == "true" {
-			compute.DefaultLogger.Info(" * Image already exists", "image", imageName, "path", imageName)
-			return &Image{
-				ImageName: imageName,
-			}, nil
-		}
+		return &Image{ImageName: ref}, nil
 	}
-	compute.DefaultLogger.Info(" * Image does not exist", "image", imageName, "path", imageName)
 
+	compute.DefaultLogger.Info(" * Image does not exist", "image", imageName, "path", ref)
 
 	// otherwise, download a fresh copy
-	if _, err := process.Execute(compute.Environment.PodmanBin, "pull", imageName); err != nil {
+	if err := puller.Pull(imageName, ref); err != nil {
 		return nil, errors.Wrapf(err, "downloading has failed")
 	}
 
+	compute.DefaultLogger.Info(" * Download completed", "image", imageName, "path", ref)
 
-	img := &Image{
-		ImageName: imageName,	
-	}
-	compute.DefaultLogger.Info(" * Download completed", "image", imageName, "path", img.ImageName)
-
-	return img, nil
+	return &Image{ImageName: ref}, nil
 }
 
 func ParseImageName(rawImageName string) string {
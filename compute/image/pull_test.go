@@ -5,6 +5,7 @@ import (
 
 	"github.com/carv-ics-forth/hpk/compute"
 	"github.com/carv-ics-forth/hpk/compute/image"
+	"github.com/carv-ics-forth/hpk/compute/runtime"
 )
 
 func Test_ParseImageName(t *testing.T) {
@@ -51,7 +52,7 @@ func TestPull(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := image.Pull(imageDir, image.Docker, tt.imageName)
+			_, err := image.Pull(runtime.PodmanHPC{}, imageDir, tt.imageName)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Pull() error = %v, wantErr %v", err, tt.wantErr)
 				return
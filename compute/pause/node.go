@@ -0,0 +1,194 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pause
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+)
+
+/************************************************************
+
+			Placement of the Pod within the Allocation
+
+************************************************************/
+
+// Node is the placement of the supervisor within the allocation of the pod.
+// Multi-node pods run a supervisor on every node. The first node (rank 0) owns the control files of the pod,
+// while the rest suffix them with their rank.
+type Node struct {
+	Rank       int
+	Count      int
+	NodeList   string
+	MasterAddr string
+	Hostname   string
+}
+
+// NodeFromEnv determines the placement of the supervisor from the environment that srun and sbatch provide.
+func NodeFromEnv(getenv func(string) string) (Node, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return Node{}, errors.Wrapf(err, "cannot get hostname")
+	}
+
+	node := Node{
+		Rank:       atoiOrDefault(getenv("SLURM_NODEID"), 0),
+		Count:      atoiOrDefault(getenv("SLURM_JOB_NUM_NODES"), 1),
+		NodeList:   getenv("SLURM_JOB_NODELIST"),
+		MasterAddr: hostname,
+		Hostname:   hostname,
+	}
+
+	if node.NodeList == "" {
+		node.NodeList = hostname
+	}
+
+	if node.Count > 1 {
+		// the nodelist is compressed (e.g, node[01-04]), so we rely on Slurm to expand it.
+		out, err := process.Execute("scontrol", "show", "hostnames", node.NodeList)
+		if err != nil {
+			return Node{}, errors.Wrapf(err, "cannot expand nodelist '%s'. out: '%s'", node.NodeList, out)
+		}
+
+		node.MasterAddr = strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	}
+
+	return node, nil
+}
+
+// Suffix is appended to the control files written by this node.
+func (n Node) Suffix() string {
+	if n.Rank == 0 {
+		return ""
+	}
+
+	return endpoint.NodeSuffix + strconv.Itoa(n.Rank)
+}
+
+// Env is the placement of the pod, as given to the environment of the containers.
+func (n Node) Env() []string {
+	return []string{
+		"HPK_NODE_RANK=" + strconv.Itoa(n.Rank),
+		"HPK_NODE_COUNT=" + strconv.Itoa(n.Count),
+		"HPK_NODELIST=" + n.NodeList,
+		"HPK_MASTER_ADDR=" + n.MasterAddr,
+	}
+}
+
+func atoiOrDefault(value string, defaultValue int) int {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+
+	return v
+}
+
+/************************************************************
+
+			Network Identity of the Pod
+
+************************************************************/
+
+// HostIP returns the ip of the node, as seen by the rest of the cluster. This is the source address of the
+// default route, which is also what the downward API gives to the containers as status.podIP
+// (see podhandler.GenerateEnvTemplate). Nodes without a default route fall back to their first non-loopback
+// IPv4 address.
+func HostIP() (string, error) {
+	// connecting a udp socket only selects the route, without sending any packet.
+	if conn, err := net.Dial("udp4", "1.1.1.1:53"); err == nil {
+		defer conn.Close()
+
+		if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok && !addr.IP.IsLoopback() {
+			return addr.IP.String(), nil
+		}
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot list the addresses of the node")
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP.String(), nil
+		}
+	}
+
+	return "", errors.New("node has no IPv4 address")
+}
+
+// ResolvConf points the containers to the DNS of the Kubernetes cluster.
+func ResolvConf(namespace string, kubeDNS string) string {
+	return fmt.Sprintf("search %s.svc.cluster.local svc.cluster.local cluster.local\nnameserver %s\noptions ndots:5\n",
+		namespace, kubeDNS)
+}
+
+// Hosts resolves the hostname of the node, which is required for loopback.
+func Hosts(ip string, hostname string) string {
+	return fmt.Sprintf("127.0.0.1 localhost\n%s %s\n", ip, hostname)
+}
+
+// writeDNS generates the resolv.conf and hosts files, which are mounted into the containers.
+func writeDNS(scratchDir string, namespace string, kubeDNS string, ip string, hostname string) error {
+	etcDir := filepath.Join(scratchDir, "etc")
+
+	if err := os.MkdirAll(etcDir, endpoint.PodGlobalDirectoryPermissions); err != nil {
+		return errors.Wrapf(err, "cannot create '%s'", etcDir)
+	}
+
+	if err := os.WriteFile(filepath.Join(etcDir, "resolv.conf"), []byte(ResolvConf(namespace, kubeDNS)), endpoint.PodGlobalDirectoryPermissions); err != nil {
+		return errors.Wrapf(err, "cannot write resolv.conf")
+	}
+
+	if err := os.WriteFile(filepath.Join(etcDir, "hosts"), []byte(Hosts(ip, hostname)), endpoint.PodGlobalDirectoryPermissions); err != nil {
+		return errors.Wrapf(err, "cannot write hosts")
+	}
+
+	return nil
+}
+
+// inheritedEnv are set by apptainer or singularity, when the supervisor itself runs in a container.
+// If not removed, they are consumed by the nested runtime and overwrite its paths.
+// https://docs.sylabs.io/guides/3.11/user-guide/environment_and_metadata.html
+var inheritedEnv = []string{
+	"LD_LIBRARY_PATH",
+	"SINGULARITY_COMMAND",
+	"SINGULARITY_CONTAINER",
+	"SINGULARITY_ENVIRONMENT",
+	"SINGULARITY_NAME",
+	"SINGULARITY_BIND",
+	"APPTAINER_APPNAME",
+	"APPTAINER_COMMAND",
+	"APPTAINER_CONTAINER",
+	"APPTAINER_ENVIRONMENT",
+	"APPTAINER_NAME",
+	"APPTAINER_BIND",
+}
+
+// resetEnv removes the inherited variables from the environment of the supervisor.
+func resetEnv() {
+	for _, name := range inheritedEnv {
+		_ = os.Unsetenv(name)
+	}
+}
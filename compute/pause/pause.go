@@ -0,0 +1,145 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pause implements hpk-pause, the supervisor that runs within the Slurm allocation of a pod.
+// It resembles the pause container of a Kubernetes pod: it prepares the network identity of the pod,
+// runs its containers through the container runtime, and reports their progress to HPK via control files.
+package pause
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/compute/runtime"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ScratchDir is the node-local directory where the supervisor keeps the dns and the environment files of the pod.
+const ScratchDir = "/tmp/scratch"
+
+// Spec is everything the supervisor needs to run a pod. It is generated by HPK upon the creation of the pod,
+// so that the supervisor does not need access to the Kubernetes API.
+type Spec struct {
+	// Pod is the pod, as materialized by HPK.
+	Pod *corev1.Pod `json:"pod"`
+
+	// Runtime is the name of the container runtime of the pod. See runtime.Drivers.
+	Runtime string `json:"runtime"`
+
+	// PodmanBin is the podman binary of the podman-hpc runtime.
+	PodmanBin string `json:"podmanBin,omitempty"`
+
+	// KubeDNS points to the internal DNS of the Kubernetes cluster.
+	KubeDNS string `json:"kubeDNS"`
+
+	// ScratchDir is where the dns and the environment files of the pod are generated on every node.
+	ScratchDir string `json:"scratchDir"`
+
+	// IPAddressPath is where the ip of the pod is announced.
+	IPAddressPath string `json:"ipAddressPath"`
+
+	// SysErrorFilePath is where failures of the supervisor itself are reported.
+	SysErrorFilePath string `json:"sysErrorFilePath"`
+
+	// InitContainers run sequentially, before the Containers.
+	InitContainers []Container `json:"initContainers,omitempty"`
+
+	// Containers run in parallel.
+	Containers []Container `json:"containers,omitempty"`
+}
+
+// Container is a container of the pod, along with its control files.
+type Container struct {
+	runtime.Container
+
+	// EnvFilePath points to the script that generates the environment variables of the container.
+	EnvFilePath string `json:"envFilePath,omitempty"`
+
+	// LogsPath is where the stdout and stderr of the container are written.
+	LogsPath string `json:"logsPath"`
+
+	// IDPath is where the process id of the container is written, once the container has started.
+	IDPath string `json:"idPath"`
+
+	// ExitCodePath is where the exit code of the container is written, once the container has terminated
+	// and will not be restarted.
+	ExitCodePath string `json:"exitCodePath"`
+
+	// RestartCountPath is where the number of restarts is written, whenever the container is about to be restarted.
+	RestartCountPath string `json:"restartCountPath,omitempty"`
+
+	// LastExitCodePath is where the exit code of the previous run is written, whenever the container is about
+	// to be restarted.
+	LastExitCodePath string `json:"lastExitCodePath,omitempty"`
+
+	// PreviousLogsPath is where the logs of the previous run are kept, once the container has been restarted.
+	PreviousLogsPath string `json:"previousLogsPath,omitempty"`
+
+	// PostStart is the command that runs the postStart hook of the container, if any.
+	PostStart []string `json:"postStart,omitempty"`
+
+	// PreStop is the command that runs the preStop hook of the container, if any.
+	PreStop []string `json:"preStop,omitempty"`
+
+	// PostStartErrorPath and PreStopErrorPath are where the failures of the respective hooks are written.
+	PostStartErrorPath string `json:"postStartErrorPath,omitempty"`
+	PreStopErrorPath   string `json:"preStopErrorPath,omitempty"`
+
+	// StartupProbe, LivenessProbe, and ReadinessProbe are the probes of the container, if any.
+	StartupProbe   *Probe `json:"startupProbe,omitempty"`
+	LivenessProbe  *Probe `json:"livenessProbe,omitempty"`
+	ReadinessProbe *Probe `json:"readinessProbe,omitempty"`
+
+	// StartedPath is where the result of the startup probe is written, once the container has started.
+	StartedPath string `json:"startedPath,omitempty"`
+
+	// ReadyPath is where the result of the readiness probe is written, whenever the readiness of the container changes.
+	ReadyPath string `json:"readyPath,omitempty"`
+}
+
+// Load reads the spec that HPK has generated for the pod.
+func Load(path string) (*Spec, error) {
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read spec '%s'", path)
+	}
+
+	var spec Spec
+
+	if err := json.Unmarshal(encoded, &spec); err != nil {
+		return nil, errors.Wrapf(err, "cannot decode spec '%s'", path)
+	}
+
+	if spec.Pod == nil {
+		return nil, errors.Errorf("spec '%s' has no pod", path)
+	}
+
+	return &spec, nil
+}
+
+// Write stores the spec at the given path, where it is read by the supervisor.
+func (s *Spec) Write(path string) error {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrapf(err, "cannot encode spec")
+	}
+
+	if err := os.WriteFile(path, encoded, endpoint.PodGlobalDirectoryPermissions); err != nil {
+		return errors.Wrapf(err, "cannot write spec '%s'", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,282 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pause
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+/************************************************************
+
+			Probes of the Containers
+
+************************************************************/
+
+// Probe is a probe of a container, with its handler resolved by HPK.
+// Exactly one of Command, URL, and Address is set.
+type Probe struct {
+	// Command runs the exec and grpc probes. The probe succeeds if the command exits with zero.
+	Command []string `json:"command,omitempty"`
+
+	// URL is the target of the httpGet probes. The probe succeeds on 2xx and 3xx responses.
+	URL string `json:"url,omitempty"`
+
+	// HTTPHeaders are sent along with the httpGet probes.
+	HTTPHeaders []corev1.HTTPHeader `json:"httpHeaders,omitempty"`
+
+	// Address is the host:port of the tcpSocket probes. The probe succeeds once a connection is established.
+	Address string `json:"address,omitempty"`
+
+	// InitialDelay, Period, Timeout, SuccessThreshold, and FailureThreshold follow the respective fields
+	// of corev1.Probe. Zero values are replaced by the defaults of Kubernetes.
+	InitialDelay     time.Duration `json:"initialDelay,omitempty"`
+	Period           time.Duration `json:"period,omitempty"`
+	Timeout          time.Duration `json:"timeout,omitempty"`
+	SuccessThreshold int32         `json:"successThreshold,omitempty"`
+	FailureThreshold int32         `json:"failureThreshold,omitempty"`
+}
+
+// withDefaults returns the probe, with the defaults of Kubernetes in place of the zero values.
+func (p Probe) withDefaults() Probe {
+	if p.Period <= 0 {
+		p.Period = 10 * time.Second
+	}
+
+	if p.Timeout <= 0 {
+		p.Timeout = time.Second
+	}
+
+	if p.SuccessThreshold <= 0 {
+		p.SuccessThreshold = 1
+	}
+
+	if p.FailureThreshold <= 0 {
+		p.FailureThreshold = 3
+	}
+
+	return p
+}
+
+// probeClient does not verify certificates, as with the kubelet.
+var probeClient = &http.Client{
+	Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+}
+
+// Check runs the probe once, and returns the reason of its failure.
+func (p Probe) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.withDefaults().Timeout)
+	defer cancel()
+
+	switch {
+	case len(p.Command) > 0:
+		cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+		cmd.Env = os.Environ()
+		// do not wait for orphaned processes that hold the output, once the command is killed.
+		cmd.WaitDelay = time.Second
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return errors.Wrapf(err, "command has failed. out: '%s'", strings.TrimSpace(string(out)))
+		}
+
+		return nil
+
+	case p.URL != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+		if err != nil {
+			return errors.Wrapf(err, "invalid url '%s'", p.URL)
+		}
+
+		for _, header := range p.HTTPHeaders {
+			if strings.EqualFold(header.Name, "Host") {
+				req.Host = header.Value
+			} else {
+				req.Header.Add(header.Name, header.Value)
+			}
+		}
+
+		resp, err := probeClient.Do(req)
+		if err != nil {
+			return errors.Wrapf(err, "http request has failed")
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+			return errors.Errorf("http probe has failed with statuscode: %d", resp.StatusCode)
+		}
+
+		return nil
+
+	case p.Address != "":
+		var dialer net.Dialer
+
+		conn, err := dialer.DialContext(ctx, "tcp", p.Address)
+		if err != nil {
+			return errors.Wrapf(err, "cannot connect to '%s'", p.Address)
+		}
+
+		return conn.Close()
+
+	default:
+		return errors.New("probe has no handler")
+	}
+}
+
+// probe runs the probes of the current run of the container, until the context is cancelled.
+// The liveness and readiness probes only start once the startup probe has succeeded.
+// A failed startup or liveness probe stops the container, which is then restarted according to the restart policy.
+func (s *Supervisor) probe(ctx context.Context, p *containerProcess) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	unhealthy := func(kind string) {
+		s.logger.Info("Container is unhealthy. Stop it", "container", p.Name, "probe", kind)
+
+		cancel()
+		s.stop(p)
+	}
+
+	/*---------------------------------------------------
+	 * Wait for the Startup Probe
+	 *---------------------------------------------------*/
+	if p.StartupProbe != nil {
+		started := false
+
+		startup, stopStartup := context.WithCancel(ctx)
+
+		s.runProbe(startup, p, "startup", *p.StartupProbe, func(healthy bool) {
+			if healthy {
+				started = true
+
+				if err := s.writeControlFile(p.StartedPath, strconv.FormatBool(true)); err != nil {
+					s.logger.Error(err, "cannot write the startup of container", "container", p.Name)
+				}
+			} else {
+				unhealthy("startup")
+			}
+
+			stopStartup()
+		})
+
+		stopStartup()
+
+		if !started {
+			return
+		}
+	}
+
+	/*---------------------------------------------------
+	 * Run the Liveness and Readiness Probes
+	 *---------------------------------------------------*/
+	var wg sync.WaitGroup
+
+	if p.LivenessProbe != nil {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			s.runProbe(ctx, p, "liveness", *p.LivenessProbe, func(healthy bool) {
+				if !healthy {
+					unhealthy("liveness")
+				}
+			})
+		}()
+	}
+
+	if p.ReadinessProbe != nil {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			s.runProbe(ctx, p, "readiness", *p.ReadinessProbe, func(healthy bool) {
+				s.logger.Info("Container readiness has changed", "container", p.Name, "ready", healthy)
+
+				if err := s.writeControlFile(p.ReadyPath, strconv.FormatBool(healthy)); err != nil {
+					s.logger.Error(err, "cannot write the readiness of container", "container", p.Name)
+				}
+			})
+		}()
+	}
+
+	wg.Wait()
+}
+
+// runProbe runs the probe periodically, until the context is cancelled. The result is reported
+// whenever the consecutive successes or failures of the probe reach the respective threshold.
+func (s *Supervisor) runProbe(ctx context.Context, p *containerProcess, kind string, probe Probe, report func(healthy bool)) {
+	probe = probe.withDefaults()
+
+	select {
+	case <-time.After(probe.InitialDelay):
+	case <-ctx.Done():
+		return
+	}
+
+	ticker := time.NewTicker(probe.Period)
+	defer ticker.Stop()
+
+	var successes, failures int32
+
+	var healthy *bool
+
+	for {
+		err := probe.Check(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			s.logger.Info("Probe has failed", "container", p.Name, "probe", kind, "err", err.Error())
+
+			successes, failures = 0, failures+1
+		} else {
+			successes, failures = successes+1, 0
+		}
+
+		switch {
+		case successes >= probe.SuccessThreshold && (healthy == nil || !*healthy):
+			result := true
+			healthy = &result
+
+			report(true)
+
+		case failures >= probe.FailureThreshold && (healthy == nil || *healthy):
+			result := false
+			healthy = &result
+
+			report(false)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
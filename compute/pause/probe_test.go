@@ -0,0 +1,177 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pause
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestProbeCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			if r.Header.Get("X-Probe") != "hpk" {
+				w.WriteHeader(http.StatusForbidden)
+			}
+		case "/moved":
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed.Close()
+	defer listener.Close()
+
+	header := []corev1.HTTPHeader{{Name: "X-Probe", Value: "hpk"}}
+
+	tests := []struct {
+		name    string
+		probe   Probe
+		wantErr bool
+	}{
+		{name: "exec success", probe: Probe{Command: []string{"true"}}},
+		{name: "exec failure", probe: Probe{Command: []string{"false"}}, wantErr: true},
+		{name: "exec timeout", probe: Probe{Command: []string{"sleep", "10"}, Timeout: 100 * time.Millisecond}, wantErr: true},
+		{name: "http success", probe: Probe{URL: server.URL + "/healthz", HTTPHeaders: header}},
+		{name: "http redirection", probe: Probe{URL: server.URL + "/moved"}},
+		{name: "http without headers", probe: Probe{URL: server.URL + "/healthz"}, wantErr: true},
+		{name: "http error", probe: Probe{URL: server.URL + "/error"}, wantErr: true},
+		{name: "tcp success", probe: Probe{Address: listener.Addr().String()}},
+		{name: "tcp failure", probe: Probe{Address: closed.Addr().String()}, wantErr: true},
+		{name: "no handler", probe: Probe{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.probe.Check(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSupervisorProbes(t *testing.T) {
+	fastProbe := func(command string) *Probe {
+		return &Probe{Command: []string{"sh", "-c", command}, Period: 20 * time.Millisecond, FailureThreshold: 2}
+	}
+
+	tests := []struct {
+		name           string
+		script         string
+		startupProbe   *Probe
+		livenessProbe  *Probe
+		readinessProbe *Probe
+
+		expectedStarted  string
+		expectedReady    string
+		expectedExitCode string
+	}{
+		{
+			name:           "ready",
+			script:         "touch $DIR/ready; sleep 0.5",
+			startupProbe:   fastProbe("true"),
+			readinessProbe: fastProbe("test -f $DIR/ready"),
+
+			expectedStarted:  "true",
+			expectedReady:    "true",
+			expectedExitCode: "0",
+		},
+		{
+			name:           "not ready",
+			script:         "sleep 0.5",
+			readinessProbe: fastProbe("test -f $DIR/ready"),
+
+			expectedReady:    "false",
+			expectedExitCode: "0",
+		},
+		{
+			name:          "liveness failure stops the container",
+			script:        "exec 2>/dev/null; sleep 0.1; touch $DIR/dead; while true; do sleep 0.1; done",
+			livenessProbe: fastProbe("test ! -f $DIR/dead"),
+
+			expectedExitCode: "143",
+		},
+		{
+			name:          "startup failure stops the container",
+			script:        "exec 2>/dev/null; while true; do sleep 0.1; done",
+			startupProbe:  fastProbe("false"),
+			livenessProbe: fastProbe("true"),
+
+			expectedExitCode: "143",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("DIR", dir)
+
+			spec := newSpec(t, nil, []Container{shell("main", tt.script)})
+
+			c := &spec.Containers[0]
+			c.StartedPath = filepath.Join(dir, "main.started")
+			c.ReadyPath = filepath.Join(dir, "main.ready")
+			c.StartupProbe = tt.startupProbe
+			c.LivenessProbe = tt.livenessProbe
+			c.ReadinessProbe = tt.readinessProbe
+
+			result := make(chan error, 1)
+
+			go func() {
+				result <- NewSupervisor(spec, shellRuntime{}, Node{}, logr.Discard()).Run(context.Background())
+			}()
+
+			select {
+			case err := <-result:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("pod has not terminated")
+			}
+
+			expect := func(what string, path string, expected string) {
+				if actual, _ := readFile(t, path); actual != expected {
+					t.Errorf("expected %s '%s' but got '%s'", what, expected, actual)
+				}
+			}
+
+			expect("started", c.StartedPath, tt.expectedStarted)
+			expect("ready", c.ReadyPath, tt.expectedReady)
+			expect("exit code", c.ExitCodePath, tt.expectedExitCode)
+		})
+	}
+}
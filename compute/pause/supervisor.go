@@ -0,0 +1,716 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pause
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/compute/runtime"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+/************************************************************
+
+			Supervisor of the Pod
+
+************************************************************/
+
+// Supervisor runs the containers of a pod within its Slurm allocation, on a single node.
+//
+// The init containers run sequentially, and the first failure stops the pod. Then, the main containers run
+// in parallel, each in its own process group. The container with a TTY, if any, runs in the foreground, attached
+// to the terminal of the supervisor.
+//
+// Containers are restarted in place according to the restartPolicy of the pod, with an exponential backoff,
+// for as long as the allocation lives. Their probes run alongside them, and failed liveness probes stop them.
+// Their postStart hooks run right after they start, and their preStop hooks upon the termination of the pod.
+// A failed postStart hook stops the container.
+//
+// The progress of every container is reported via its control files: the process id once the container has started,
+// the results of its startup and readiness probes, the restart count and last exit code whenever it is about
+// to be restarted, and the exit code once it has terminated for good. Failures of the supervisor itself are reported via the SysError file, which fails the pod
+// regardless of its containers.
+//
+// It must be created with NewSupervisor.
+type Supervisor struct {
+	spec    *Spec
+	runtime runtime.ContainerRuntime
+	node    Node
+	logger  logr.Logger
+
+	// Stdin and Stdout are the terminal of the TTY container.
+	Stdin  io.Reader
+	Stdout io.Writer
+
+	// Backoff is the delay between the restarts of a container.
+	Backoff Backoff
+
+	lock       sync.Mutex
+	containers []*containerProcess
+
+	// stopping is closed once the termination of the pod has been requested.
+	stopping chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSupervisor returns a supervisor for the pod of the spec.
+func NewSupervisor(spec *Spec, rt runtime.ContainerRuntime, node Node, logger logr.Logger) *Supervisor {
+	return &Supervisor{
+		spec:     spec,
+		runtime:  rt,
+		node:     node,
+		logger:   logger,
+		Stdin:    os.Stdin,
+		Stdout:   os.Stdout,
+		Backoff:  DefaultBackoff,
+		stopping: make(chan struct{}),
+	}
+}
+
+// Run runs the pod until all of its containers have terminated. Cancelling the context terminates the pod:
+// the preStop hooks run, and then the containers are stopped.
+//
+// Failures of the containers are reported via their exit codes, and only the failures of the supervisor are returned.
+func (s *Supervisor) Run(ctx context.Context) error {
+	if err := s.run(ctx); err != nil {
+		s.sysError(err)
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *Supervisor) run(ctx context.Context) error {
+	s.logger.Info("Starting pod",
+		"pod", s.spec.Pod.GetNamespace()+"/"+s.spec.Pod.GetName(),
+		"runtime", s.runtime.Name(),
+		"node", fmt.Sprintf("%d/%d", s.node.Rank, s.node.Count),
+		"nodelist", s.node.NodeList,
+		"host", s.node.Hostname,
+		"dns", s.spec.KubeDNS,
+	)
+
+	resetEnv()
+
+	/*---------------------------------------------------
+	 * Prepare the Network Identity of the Pod
+	 *---------------------------------------------------*/
+	ip, err := HostIP()
+	if err != nil {
+		return errors.Wrapf(err, "cannot determine the ip of the pod")
+	}
+
+	if err := writeDNS(s.spec.ScratchDir, s.spec.Pod.GetNamespace(), s.spec.KubeDNS, ip, s.node.Hostname); err != nil {
+		return errors.Wrapf(err, "cannot set the dns of the pod")
+	}
+
+	/*-- the ip is announced last, since it marks the start of the pod --*/
+	if err := os.WriteFile(s.spec.IPAddressPath+s.node.Suffix(), []byte(ip), endpoint.PodGlobalDirectoryPermissions); err != nil {
+		return errors.Wrapf(err, "cannot announce the ip of the pod")
+	}
+
+	s.logger.Info("Pod has started", "ip", ip)
+
+	/*---------------------------------------------------
+	 * Run the Init Containers
+	 *---------------------------------------------------*/
+	for _, c := range s.spec.InitContainers {
+		p, err := s.start(c, true)
+		if err != nil {
+			return errors.Wrapf(err, "cannot start init container '%s'", c.Name)
+		}
+
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			s.terminate()
+			s.wait()
+
+			return nil
+		}
+
+		if p.exitCode != 0 {
+			s.logger.Info("Init container has failed. Stop the pod", "container", c.Name, "exitCode", p.exitCode)
+
+			return nil
+		}
+	}
+
+	/*---------------------------------------------------
+	 * Run the Main Containers
+	 *---------------------------------------------------*/
+	// the container with the tty runs in the foreground of the terminal, so it is started after the rest.
+	var tty []Container
+
+	for _, c := range s.spec.Containers {
+		if c.TTY {
+			tty = append(tty, c)
+
+			continue
+		}
+
+		if _, err := s.start(c, false); err != nil {
+			s.terminate()
+			s.wait()
+
+			return errors.Wrapf(err, "cannot start container '%s'", c.Name)
+		}
+	}
+
+	for _, c := range tty {
+		if _, err := s.start(c, false); err != nil {
+			s.terminate()
+			s.wait()
+
+			return errors.Wrapf(err, "cannot start container '%s'", c.Name)
+		}
+	}
+
+	/*---------------------------------------------------
+	 * Wait for the Containers
+	 *---------------------------------------------------*/
+	allDone := make(chan struct{})
+
+	go func() {
+		s.wait()
+		close(allDone)
+	}()
+
+	select {
+	case <-allDone:
+	case <-ctx.Done():
+		s.terminate()
+		<-allDone
+	}
+
+	s.logger.Info("All containers have terminated")
+
+	return nil
+}
+
+/*************************************************************
+
+		Container Processes
+
+*************************************************************/
+
+// containerProcess is a container that has been started by the supervisor.
+type containerProcess struct {
+	Container
+
+	// init is true for init containers, which are only restarted upon failure.
+	init bool
+
+	// cmd is the current run of the container. It is nil while the container waits to be restarted.
+	lock sync.Mutex
+	cmd  *exec.Cmd
+
+	// done is closed once the container has terminated for good, and its exit code has been written.
+	done     chan struct{}
+	exitCode int
+}
+
+// start starts the container, and keeps restarting it according to the restart policy of the pod.
+func (s *Supervisor) start(c Container, init bool) (*containerProcess, error) {
+	p := &containerProcess{
+		Container: c,
+		init:      init,
+		done:      make(chan struct{}),
+	}
+
+	cmd, logs, err := s.launch(p)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	s.containers = append(s.containers, p)
+	s.lock.Unlock()
+
+	go s.supervise(p, cmd, logs)
+
+	return p, nil
+}
+
+// launch runs the container once, and reports that it has started.
+func (s *Supervisor) launch(p *containerProcess) (*exec.Cmd, *os.File, error) {
+	if err := s.writeEnvFile(p.Container); err != nil {
+		return nil, nil, err
+	}
+
+	args := s.runtime.Run(p.Container.Container)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = os.Environ()
+
+	var logs *os.File
+
+	if p.TTY {
+		cmd.Stdin = s.Stdin
+		cmd.Stdout = s.Stdout
+		cmd.Stderr = s.Stdout
+	} else {
+		f, err := os.OpenFile(p.LogsPath+s.node.Suffix(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, endpoint.PodGlobalDirectoryPermissions)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot open logs")
+		}
+
+		logs = f
+		cmd.Stdout = logs
+		cmd.Stderr = logs
+
+		// termination signals are delivered to the supervisor, which forwards them to the containers.
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+
+	s.logger.V(1).Info("Run container", "container", p.Name, "args", args)
+
+	if err := cmd.Start(); err != nil {
+		if logs != nil {
+			logs.Close()
+		}
+
+		return nil, nil, errors.Wrapf(err, "cannot run '%s'", args[0])
+	}
+
+	p.lock.Lock()
+	p.cmd = cmd
+	p.lock.Unlock()
+
+	s.logger.Info("Container has started", "container", p.Name, "pid", cmd.Process.Pid)
+
+	/*-- the container is reported as running once its postStart hook has completed --*/
+	if len(p.PostStart) > 0 {
+		if p.PostStartErrorPath != "" {
+			if err := os.Remove(p.PostStartErrorPath + s.node.Suffix()); err != nil && !os.IsNotExist(err) {
+				s.logger.Error(err, "cannot remove the postStart error of container", "container", p.Name)
+			}
+		}
+
+		if err := s.hook(p.Container, p.PostStart); err != nil {
+			s.hookError(p, p.PostStartErrorPath, "PostStart", err)
+
+			// as with the kubelet, a failed postStart hook kills the container.
+			s.stop(p)
+
+			return cmd, logs, nil
+		}
+	}
+
+	if err := s.writeControlFile(p.IDPath, fmt.Sprintf("pid://%d", cmd.Process.Pid)); err != nil {
+		s.logger.Error(err, "cannot write the id of container", "container", p.Name)
+	}
+
+	return cmd, logs, nil
+}
+
+// supervise waits for the container to terminate, and restarts it with an exponential backoff
+// as long as the restart policy of the pod allows it.
+func (s *Supervisor) supervise(p *containerProcess, cmd *exec.Cmd, logs *os.File) {
+	defer close(p.done)
+
+	var restarts int
+	var delay time.Duration
+
+	for {
+		startedAt := time.Now()
+
+		/*-- the probes follow the current run of the container --*/
+		probes, stopProbes := context.WithCancel(context.Background())
+		probing := make(chan struct{})
+
+		go func() {
+			s.probe(probes, p)
+			close(probing)
+		}()
+
+		waitErr := cmd.Wait()
+
+		stopProbes()
+		<-probing
+
+		if waitErr != nil {
+			s.logger.Info("Container has failed", "container", p.Name, "err", waitErr.Error())
+			s.inspect(p.Container)
+		}
+
+		if logs != nil {
+			logs.Close()
+		}
+
+		p.lock.Lock()
+		p.cmd = nil
+		p.lock.Unlock()
+
+		exitCode := ExitCode(cmd.ProcessState)
+
+		if !s.shouldRestart(p, exitCode) {
+			s.exit(p, exitCode)
+
+			return
+		}
+
+		/*---------------------------------------------------
+		 * Back-off before restarting the container
+		 *---------------------------------------------------*/
+		restarts++
+		delay = s.Backoff.Next(delay, time.Since(startedAt))
+
+		s.logger.Info("Back-off restarting container", "container", p.Name, "exitCode", exitCode,
+			"restarts", restarts, "delay", delay)
+
+		s.reportRestart(p, restarts, exitCode)
+
+		select {
+		case <-time.After(delay):
+		case <-s.stopping:
+			s.exit(p, exitCode)
+
+			return
+		}
+
+		s.rotateLogs(p)
+
+		var err error
+
+		cmd, logs, err = s.launch(p)
+		if err != nil {
+			s.sysError(errors.Wrapf(err, "cannot restart container '%s'", p.Name))
+			s.exit(p, exitCode)
+
+			return
+		}
+
+		/*-- the termination may have been requested while the container was being restarted --*/
+		select {
+		case <-s.stopping:
+			s.stop(p)
+		default:
+		}
+	}
+}
+
+// shouldRestart applies the restart policy of the pod to a container that has terminated.
+// Init containers are only restarted upon failure, and no container is restarted once the pod is terminating.
+func (s *Supervisor) shouldRestart(p *containerProcess, exitCode int) bool {
+	select {
+	case <-s.stopping:
+		return false
+	default:
+	}
+
+	switch s.spec.Pod.Spec.RestartPolicy {
+	case corev1.RestartPolicyNever:
+		return false
+	case corev1.RestartPolicyOnFailure:
+		return exitCode != 0
+	default:
+		return exitCode != 0 || !p.init
+	}
+}
+
+// exit reports that the container has terminated for good.
+func (s *Supervisor) exit(p *containerProcess, exitCode int) {
+	p.exitCode = exitCode
+
+	s.logger.Info("Container has terminated", "container", p.Name, "exitCode", exitCode)
+
+	if err := s.writeControlFile(p.ExitCodePath, strconv.Itoa(exitCode)); err != nil {
+		s.logger.Error(err, "cannot write the exit code of container", "container", p.Name)
+	}
+}
+
+// reportRestart reports that the container waits to be restarted (i.e, CrashLoopBackOff).
+// The restart count is written last, since it notifies HPK.
+func (s *Supervisor) reportRestart(p *containerProcess, restarts int, exitCode int) {
+	if p.LastExitCodePath != "" {
+		if err := s.writeControlFile(p.LastExitCodePath, strconv.Itoa(exitCode)); err != nil {
+			s.logger.Error(err, "cannot write the last exit code of container", "container", p.Name)
+		}
+	}
+
+	// the next run of the container starts over, without an id or probe results.
+	for _, path := range []string{p.IDPath, p.StartedPath, p.ReadyPath} {
+		if path == "" {
+			continue
+		}
+
+		if err := os.Remove(path + s.node.Suffix()); err != nil && !os.IsNotExist(err) {
+			s.logger.Error(err, "cannot remove control file of container", "container", p.Name, "path", path)
+		}
+	}
+
+	if p.RestartCountPath != "" {
+		if err := s.writeControlFile(p.RestartCountPath, strconv.Itoa(restarts)); err != nil {
+			s.logger.Error(err, "cannot write the restart count of container", "container", p.Name)
+		}
+	}
+}
+
+// rotateLogs keeps the logs of the previous run, before the container is restarted.
+func (s *Supervisor) rotateLogs(p *containerProcess) {
+	if p.TTY || p.PreviousLogsPath == "" {
+		return
+	}
+
+	if err := os.Rename(p.LogsPath+s.node.Suffix(), p.PreviousLogsPath+s.node.Suffix()); err != nil && !os.IsNotExist(err) {
+		s.logger.Error(err, "cannot keep the previous logs of container", "container", p.Name)
+	}
+}
+
+// wait blocks until all the started containers have terminated.
+func (s *Supervisor) wait() {
+	for _, p := range s.started() {
+		<-p.done
+	}
+}
+
+// started returns the containers that have been started so far.
+func (s *Supervisor) started() []*containerProcess {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]*containerProcess(nil), s.containers...)
+}
+
+// terminate runs the preStop hooks of the running containers, and then stops them.
+// Containers that wait to be restarted are not restarted anymore.
+func (s *Supervisor) terminate() {
+	s.stopOnce.Do(func() { close(s.stopping) })
+
+	s.logger.Info("Termination has been requested. Running preStop hooks ...")
+
+	for _, p := range s.started() {
+		if len(p.PreStop) == 0 || !p.running() {
+			continue
+		}
+
+		if err := s.hook(p.Container, p.PreStop); err != nil {
+			s.hookError(p, p.PreStopErrorPath, "PreStop", err)
+		}
+	}
+
+	s.logger.Info("Stopping containers ...")
+
+	for _, p := range s.started() {
+		s.stop(p)
+	}
+}
+
+// hook runs a lifecycle hook of the container, with its output in the logs of the container.
+// The output is also given along with the failure of the hook.
+func (s *Supervisor) hook(c Container, command []string) error {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = os.Environ()
+
+	var out bytes.Buffer
+
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if !c.TTY {
+		logs, err := os.OpenFile(c.LogsPath+s.node.Suffix(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, endpoint.PodGlobalDirectoryPermissions)
+		if err != nil {
+			return errors.Wrapf(err, "cannot open logs")
+		}
+
+		defer logs.Close()
+
+		cmd.Stdout = io.MultiWriter(logs, &out)
+		cmd.Stderr = cmd.Stdout
+	}
+
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "command '%s' has failed. out: '%s'", strings.Join(command, " "), strings.TrimSpace(out.String()))
+	}
+
+	return nil
+}
+
+// hookError reports the failure of a lifecycle hook of the container.
+func (s *Supervisor) hookError(p *containerProcess, path string, hook string, err error) {
+	s.logger.Info(hook+" hook has failed", "container", p.Name, "err", err.Error())
+
+	if path == "" {
+		return
+	}
+
+	if werr := s.writeControlFile(path, err.Error()); werr != nil {
+		s.logger.Error(werr, "cannot write the hook error of container", "container", p.Name, "hook", hook)
+	}
+}
+
+// stop stops the container through the runtime, or by signaling its processes for runtimes without named containers.
+func (s *Supervisor) stop(p *containerProcess) {
+	p.lock.Lock()
+	cmd := p.cmd
+	p.lock.Unlock()
+
+	if cmd == nil {
+		return
+	}
+
+	if stop := s.runtime.Stop(p.Container.Container); stop != nil {
+		if out, err := exec.Command(stop[0], stop[1:]...).CombinedOutput(); err != nil {
+			s.logger.Info("Cannot stop container", "container", p.Name, "err", err.Error(), "out", string(out))
+		}
+
+		return
+	}
+
+	pid := cmd.Process.Pid
+	if !p.TTY {
+		// signal the whole process group of the container.
+		pid = -pid
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		s.logger.Info("Cannot signal container", "container", p.Name, "err", err.Error())
+	}
+}
+
+// running returns true if the container is currently running.
+func (p *containerProcess) running() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.cmd != nil
+}
+
+// ExitCode returns the exit code of the container, as reported by a shell (128+n for containers killed by signal n).
+func ExitCode(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+
+	return state.ExitCode()
+}
+
+/*************************************************************
+
+		Restart Backoff
+
+*************************************************************/
+
+// Backoff is the delay between the restarts of a container, which doubles on every restart up to a maximum,
+// as with the CrashLoopBackOff of the kubelet.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+
+	// Reset is how long a container must run, for the delay to start over from Initial.
+	Reset time.Duration
+}
+
+// DefaultBackoff matches the backoff of the kubelet.
+var DefaultBackoff = Backoff{
+	Initial: 10 * time.Second,
+	Max:     5 * time.Minute,
+	Reset:   10 * time.Minute,
+}
+
+// Next returns the delay before the next restart, given the previous delay and how long the container has run.
+func (b Backoff) Next(previous time.Duration, ran time.Duration) time.Duration {
+	if previous == 0 || ran >= b.Reset {
+		return b.Initial
+	}
+
+	if next := 2 * previous; next < b.Max {
+		return next
+	}
+
+	return b.Max
+}
+
+/*************************************************************
+
+		Helpers
+
+*************************************************************/
+
+// writeEnvFile generates the environment of the container, along with the placement of the pod within the allocation.
+func (s *Supervisor) writeEnvFile(c Container) error {
+	if c.EnvFile == "" {
+		return nil
+	}
+
+	var env []byte
+
+	if c.EnvFilePath != "" {
+		out, err := exec.Command("sh", "-c", c.EnvFilePath).Output()
+		if err != nil {
+			return errors.Wrapf(err, "cannot generate the environment of container '%s'", c.Name)
+		}
+
+		env = out
+	}
+
+	env = append(env, []byte(strings.Join(s.node.Env(), "\n")+"\n")...)
+
+	if err := os.MkdirAll(filepath.Dir(c.EnvFile), endpoint.PodGlobalDirectoryPermissions); err != nil {
+		return errors.Wrapf(err, "cannot create the directory of env file '%s'", c.EnvFile)
+	}
+
+	if err := os.WriteFile(c.EnvFile, env, endpoint.PodGlobalDirectoryPermissions); err != nil {
+		return errors.Wrapf(err, "cannot write env file '%s'", c.EnvFile)
+	}
+
+	return nil
+}
+
+// writeControlFile writes a control file of this node.
+func (s *Supervisor) writeControlFile(path string, content string) error {
+	return os.WriteFile(path+s.node.Suffix(), []byte(content), endpoint.PodGlobalDirectoryPermissions)
+}
+
+// inspect logs the state of a failed container, in debug mode.
+func (s *Supervisor) inspect(c Container) {
+	if !c.Debug {
+		return
+	}
+
+	inspect := s.runtime.Inspect(c.Container)
+
+	out, err := exec.Command(inspect[0], inspect[1:]...).CombinedOutput()
+	s.logger.Info("Inspect container", "container", c.Name, "out", string(out), "err", err)
+}
+
+// sysError reports a failure of the supervisor, which fails the pod.
+func (s *Supervisor) sysError(err error) {
+	s.logger.Error(err, "**SYSTEMERROR**")
+
+	if s.spec.SysErrorFilePath == "" {
+		return
+	}
+
+	if werr := os.WriteFile(s.spec.SysErrorFilePath, []byte(err.Error()), endpoint.PodGlobalDirectoryPermissions); werr != nil {
+		s.logger.Error(werr, "cannot write the syserror file")
+	}
+}
@@ -0,0 +1,600 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pause
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/runtime"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// shellRuntime runs the command of the container directly on the host.
+type shellRuntime struct{}
+
+func (shellRuntime) Name() string                          { return "shell" }
+func (shellRuntime) ImageRef(_ string, name string) string { return name }
+func (shellRuntime) Present(string) (bool, error)          { return true, nil }
+func (shellRuntime) Pull(string, string) error             { return nil }
+func (shellRuntime) Stop(runtime.Container) []string       { return nil }
+func (shellRuntime) Inspect(runtime.Container) []string    { return []string{"true"} }
+
+func (shellRuntime) Run(c runtime.Container) []string {
+	return append(append([]string{}, c.Command...), c.Args...)
+}
+
+func (shellRuntime) Exec(_ runtime.Container, command []string) []string {
+	return command
+}
+
+func newSpec(t *testing.T, initContainers []Container, containers []Container) *Spec {
+	dir := t.TempDir()
+
+	fill := func(list []Container) {
+		for i := range list {
+			list[i].LogsPath = filepath.Join(dir, list[i].Name+".log")
+			list[i].IDPath = filepath.Join(dir, list[i].Name+".jobid")
+			list[i].ExitCodePath = filepath.Join(dir, list[i].Name+".exitCode")
+			list[i].RestartCountPath = filepath.Join(dir, list[i].Name+".restartCount")
+			list[i].LastExitCodePath = filepath.Join(dir, list[i].Name+".lastExitCode")
+			list[i].PreviousLogsPath = filepath.Join(dir, list[i].Name+".previous.log")
+		}
+	}
+
+	fill(initContainers)
+	fill(containers)
+
+	// containers are not restarted, unless a test asks for it.
+	return &Spec{
+		Pod: &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "test"},
+			Spec:       corev1.PodSpec{RestartPolicy: corev1.RestartPolicyNever},
+		},
+		KubeDNS:          "10.96.0.10",
+		ScratchDir:       filepath.Join(dir, "scratch"),
+		IPAddressPath:    filepath.Join(dir, ".ip"),
+		SysErrorFilePath: filepath.Join(dir, ".syserror"),
+		InitContainers:   initContainers,
+		Containers:       containers,
+	}
+}
+
+func shell(name string, script string) Container {
+	return Container{Container: runtime.Container{Name: name, Command: []string{"sh", "-c", script}}}
+}
+
+func readFile(t *testing.T, path string) (string, bool) {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content), true
+}
+
+func TestSupervisorRun(t *testing.T) {
+	tests := []struct {
+		name           string
+		node           Node
+		initContainers []Container
+		containers     []Container
+
+		// expected contents of the control files, by container. Empty if the file should not exist.
+		logs      map[string]string
+		exitCodes map[string]string
+	}{
+		{
+			name:           "init and main containers",
+			initContainers: []Container{shell("init", "echo hello from init container")},
+			containers: []Container{
+				shell("main", "echo hello from main container"),
+				shell("sidecar", "exit 3"),
+			},
+			logs: map[string]string{
+				"init": "hello from init container\n",
+				"main": "hello from main container\n",
+			},
+			exitCodes: map[string]string{"init": "0", "main": "0", "sidecar": "3"},
+		},
+		{
+			name:           "failed init container stops the pod",
+			initContainers: []Container{shell("init0", "exit 2"), shell("init1", "true")},
+			containers:     []Container{shell("main", "true")},
+			exitCodes:      map[string]string{"init0": "2", "init1": "", "main": ""},
+		},
+		{
+			name:       "signaled container",
+			containers: []Container{shell("main", "kill -KILL $$")},
+			exitCodes:  map[string]string{"main": "137"},
+		},
+		{
+			name:       "secondary node",
+			node:       Node{Rank: 2, Count: 3},
+			containers: []Container{shell("main", "echo rank ${HPK_NODE_RANK:-unset}")},
+			logs:       map[string]string{"main": "rank unset\n"},
+			exitCodes:  map[string]string{"main": "0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newSpec(t, tt.initContainers, tt.containers)
+
+			if err := NewSupervisor(spec, shellRuntime{}, tt.node, logr.Discard()).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, exists := readFile(t, spec.IPAddressPath+tt.node.Suffix()); !exists {
+				t.Error("ip has not been announced")
+			}
+
+			if _, exists := readFile(t, spec.SysErrorFilePath); exists {
+				t.Error("unexpected syserror")
+			}
+
+			controlFile := func(name string, path func(Container) string) string {
+				for _, c := range append(spec.InitContainers, spec.Containers...) {
+					if c.Name == name {
+						return path(c) + tt.node.Suffix()
+					}
+				}
+
+				t.Fatalf("unknown container '%s'", name)
+
+				return ""
+			}
+
+			for name, expected := range tt.logs {
+				if logs, _ := readFile(t, controlFile(name, func(c Container) string { return c.LogsPath })); logs != expected {
+					t.Errorf("container '%s': expected logs '%s' but got '%s'", name, expected, logs)
+				}
+			}
+
+			for name, expected := range tt.exitCodes {
+				exitCode, _ := readFile(t, controlFile(name, func(c Container) string { return c.ExitCodePath }))
+				if exitCode != expected {
+					t.Errorf("container '%s': expected exit code '%s' but got '%s'", name, expected, exitCode)
+				}
+
+				jobID, started := readFile(t, controlFile(name, func(c Container) string { return c.IDPath }))
+				if started != (expected != "") {
+					t.Errorf("container '%s': expected started=%t but got '%s'", name, expected != "", jobID)
+				}
+			}
+		})
+	}
+}
+
+func TestSupervisorEnvFile(t *testing.T) {
+	c := shell("main", "")
+	spec := newSpec(t, nil, []Container{c})
+
+	envScript := filepath.Join(t.TempDir(), "main.env.sh")
+	if err := os.WriteFile(envScript, []byte("#!/bin/bash\necho GREETING=\\''hello world'\\'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	spec.Containers[0].EnvFilePath = envScript
+	spec.Containers[0].EnvFile = filepath.Join(spec.ScratchDir, "main.env")
+	spec.Containers[0].Command = []string{"cat", spec.Containers[0].EnvFile}
+
+	node := Node{Rank: 1, Count: 2, NodeList: "node[1-2]", MasterAddr: "node1"}
+
+	if err := NewSupervisor(spec, shellRuntime{}, node, logr.Discard()).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "GREETING='hello world'\nHPK_NODE_RANK=1\nHPK_NODE_COUNT=2\nHPK_NODELIST=node[1-2]\nHPK_MASTER_ADDR=node1\n"
+
+	if logs, _ := readFile(t, spec.Containers[0].LogsPath+node.Suffix()); logs != expected {
+		t.Errorf("expected env file '%s' but got '%s'", expected, logs)
+	}
+
+	if resolv, _ := readFile(t, filepath.Join(spec.ScratchDir, "etc", "resolv.conf")); !strings.Contains(resolv, "nameserver 10.96.0.10\n") {
+		t.Errorf("unexpected resolv.conf '%s'", resolv)
+	}
+}
+
+func TestSupervisorTermination(t *testing.T) {
+	main := shell("main", "exec 2>/dev/null; trap 'echo terminated; exit 0' TERM; while true; do sleep 0.1; done")
+	main.PreStop = []string{"sh", "-c", "echo draining"}
+
+	spec := newSpec(t, nil, []Container{main, shell("done", "true")})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- NewSupervisor(spec, shellRuntime{}, Node{}, logr.Discard()).Run(ctx)
+	}()
+
+	// wait for the container to start, before requesting the termination.
+	for i := 0; ; i++ {
+		if _, started := readFile(t, spec.Containers[0].IDPath); started {
+			break
+		}
+
+		if i == 100 {
+			t.Fatal("container has not started")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("pod has not terminated")
+	}
+
+	if logs, _ := readFile(t, spec.Containers[0].LogsPath); logs != "draining\nterminated\n" {
+		t.Errorf("unexpected logs '%s'", logs)
+	}
+
+	if exitCode, _ := readFile(t, spec.Containers[0].ExitCodePath); exitCode != "0" {
+		t.Errorf("unexpected exit code '%s'", exitCode)
+	}
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	tests := []struct {
+		name          string
+		restartPolicy corev1.RestartPolicy
+		init          bool
+		script        string
+
+		expectedRestarts     string
+		expectedLastExitCode string
+		expectedExitCode     string
+		expectedLogs         string
+		expectedPreviousLogs string
+	}{
+		{
+			name:          "on failure until success",
+			restartPolicy: corev1.RestartPolicyOnFailure,
+			script:        "echo run; [ -f $MARKER ] && exit 0; touch $MARKER; exit 3",
+
+			expectedRestarts:     "1",
+			expectedLastExitCode: "3",
+			expectedExitCode:     "0",
+			expectedLogs:         "run\n",
+			expectedPreviousLogs: "run\n",
+		},
+		{
+			name:          "on failure without failure",
+			restartPolicy: corev1.RestartPolicyOnFailure,
+			script:        "echo run",
+
+			expectedExitCode: "0",
+			expectedLogs:     "run\n",
+		},
+		{
+			name:          "never",
+			restartPolicy: corev1.RestartPolicyNever,
+			script:        "exit 3",
+
+			expectedExitCode: "3",
+		},
+		{
+			name:          "init container is restarted only upon failure",
+			restartPolicy: corev1.RestartPolicyAlways,
+			init:          true,
+			script:        "[ -f $MARKER ] && exit 0; touch $MARKER; exit 1",
+
+			expectedRestarts:     "1",
+			expectedLastExitCode: "1",
+			expectedExitCode:     "0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marker := filepath.Join(t.TempDir(), "marker")
+			c := shell("main", "MARKER="+marker+"; "+tt.script)
+
+			var spec *Spec
+			if tt.init {
+				spec = newSpec(t, []Container{c}, nil)
+			} else {
+				spec = newSpec(t, nil, []Container{c})
+			}
+
+			spec.Pod.Spec.RestartPolicy = tt.restartPolicy
+
+			supervisor := NewSupervisor(spec, shellRuntime{}, Node{}, logr.Discard())
+			supervisor.Backoff = Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Reset: time.Minute}
+
+			if err := supervisor.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			c = append(spec.InitContainers, spec.Containers...)[0]
+
+			expect := func(what string, path string, expected string) {
+				if actual, _ := readFile(t, path); actual != expected {
+					t.Errorf("expected %s '%s' but got '%s'", what, expected, actual)
+				}
+			}
+
+			expect("restart count", c.RestartCountPath, tt.expectedRestarts)
+			expect("last exit code", c.LastExitCodePath, tt.expectedLastExitCode)
+			expect("exit code", c.ExitCodePath, tt.expectedExitCode)
+			expect("logs", c.LogsPath, tt.expectedLogs)
+			expect("previous logs", c.PreviousLogsPath, tt.expectedPreviousLogs)
+		})
+	}
+}
+
+func TestSupervisorCrashLoopTermination(t *testing.T) {
+	spec := newSpec(t, nil, []Container{shell("main", "exit 1")})
+	spec.Pod.Spec.RestartPolicy = corev1.RestartPolicyAlways
+
+	supervisor := NewSupervisor(spec, shellRuntime{}, Node{}, logr.Discard())
+	supervisor.Backoff = Backoff{Initial: time.Hour, Max: time.Hour, Reset: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- supervisor.Run(ctx)
+	}()
+
+	// wait for the container to back-off, before requesting the termination.
+	for i := 0; ; i++ {
+		if restarts, _ := readFile(t, spec.Containers[0].RestartCountPath); restarts == "1" {
+			break
+		}
+
+		if i == 100 {
+			t.Fatal("container has not been restarted")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if _, started := readFile(t, spec.Containers[0].IDPath); started {
+		t.Error("container in back-off should not have an id")
+	}
+
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("pod has not terminated")
+	}
+
+	if exitCode, _ := readFile(t, spec.Containers[0].ExitCodePath); exitCode != "1" {
+		t.Errorf("unexpected exit code '%s'", exitCode)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Initial: 10 * time.Second, Max: 30 * time.Second, Reset: time.Minute}
+
+	tests := []struct {
+		previous time.Duration
+		ran      time.Duration
+		expected time.Duration
+	}{
+		{previous: 0, ran: 0, expected: 10 * time.Second},
+		{previous: 10 * time.Second, ran: time.Second, expected: 20 * time.Second},
+		{previous: 20 * time.Second, ran: time.Second, expected: 30 * time.Second},
+		{previous: 30 * time.Second, ran: time.Second, expected: 30 * time.Second},
+		{previous: 30 * time.Second, ran: time.Minute, expected: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if actual := b.Next(tt.previous, tt.ran); actual != tt.expected {
+			t.Errorf("Next(%s, %s): expected %s but got %s", tt.previous, tt.ran, tt.expected, actual)
+		}
+	}
+}
+
+func TestSupervisorHooks(t *testing.T) {
+	tests := []struct {
+		name      string
+		postStart string
+		preStop   string
+		cancel    bool
+
+		expectedStarted        bool
+		expectedExitCode       string
+		expectedLogs           string
+		expectedPostStartError string
+		expectedPreStopError   string
+	}{
+		{
+			name:      "postStart",
+			postStart: "echo registered",
+
+			expectedStarted:  true,
+			expectedExitCode: "0",
+			expectedLogs:     "registered\nrunning\n",
+		},
+		{
+			name:      "failed postStart kills the container",
+			postStart: "echo unreachable; exit 7",
+
+			expectedExitCode:       "143",
+			expectedLogs:           "unreachable\n",
+			expectedPostStartError: "command 'sh -c echo unreachable; exit 7' has failed. out: 'unreachable': exit status 7",
+		},
+		{
+			name:    "failed preStop",
+			preStop: "exit 1",
+			cancel:  true,
+
+			expectedStarted:      true,
+			expectedExitCode:     "143",
+			expectedLogs:         "running\n",
+			expectedPreStopError: "command 'sh -c exit 1' has failed. out: '': exit status 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the container waits for its postStart hook, before it writes to the logs.
+			c := shell("main", "exec 2>/dev/null; sleep 0.2; echo running; [ -n \"$WAIT\" ] && while true; do sleep 0.1; done; true")
+			if tt.postStart != "" {
+				c.PostStart = []string{"sh", "-c", tt.postStart}
+			}
+
+			if tt.preStop != "" {
+				c.PreStop = []string{"sh", "-c", tt.preStop}
+			}
+
+			if tt.cancel {
+				t.Setenv("WAIT", "true")
+			}
+
+			spec := newSpec(t, nil, []Container{c})
+			c = spec.Containers[0]
+			c.PostStartErrorPath = filepath.Join(t.TempDir(), "main.postStartError")
+			c.PreStopErrorPath = filepath.Join(t.TempDir(), "main.preStopError")
+			spec.Containers[0] = c
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			result := make(chan error, 1)
+
+			go func() {
+				result <- NewSupervisor(spec, shellRuntime{}, Node{}, logr.Discard()).Run(ctx)
+			}()
+
+			if tt.cancel {
+				time.Sleep(500 * time.Millisecond)
+				cancel()
+			}
+
+			select {
+			case err := <-result:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("pod has not terminated")
+			}
+
+			expect := func(what string, path string, expected string) {
+				if actual, _ := readFile(t, path); actual != expected {
+					t.Errorf("expected %s '%s' but got '%s'", what, expected, actual)
+				}
+			}
+
+			if _, started := readFile(t, c.IDPath); started != tt.expectedStarted {
+				t.Errorf("expected started=%t", tt.expectedStarted)
+			}
+
+			expect("exit code", c.ExitCodePath, tt.expectedExitCode)
+			expect("logs", c.LogsPath, tt.expectedLogs)
+			expect("postStart error", c.PostStartErrorPath, tt.expectedPostStartError)
+			expect("preStop error", c.PreStopErrorPath, tt.expectedPreStopError)
+		})
+	}
+}
+
+func TestSupervisorSysError(t *testing.T) {
+	spec := newSpec(t, nil, []Container{{Container: runtime.Container{Name: "main", Command: []string{"/does/not/exist"}}}})
+
+	if err := NewSupervisor(spec, shellRuntime{}, Node{}, logr.Discard()).Run(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if reason, exists := readFile(t, spec.SysErrorFilePath); !exists || !strings.Contains(reason, "cannot start container 'main'") {
+		t.Errorf("unexpected syserror '%s'", reason)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		script   string
+		expected int
+	}{
+		{script: "exit 0", expected: 0},
+		{script: "exit 42", expected: 42},
+		{script: "kill -TERM $$", expected: 143},
+	}
+
+	for _, tt := range tests {
+		cmd := exec.Command("sh", "-c", tt.script)
+		_ = cmd.Run()
+
+		if actual := ExitCode(cmd.ProcessState); actual != tt.expected {
+			t.Errorf("'%s': expected exit code %d but got %d", tt.script, tt.expected, actual)
+		}
+	}
+}
+
+func TestSpecRoundTrip(t *testing.T) {
+	spec := newSpec(t, nil, []Container{shell("main", "true")})
+	spec.Runtime = runtime.NamePodmanHPC
+	spec.Containers[0].Binds = []string{"/a:/b:ro"}
+	spec.Containers[0].PreStop = []string{"echo"}
+
+	path := filepath.Join(t.TempDir(), "pause.json")
+
+	if err := spec.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(spec.Containers, loaded.Containers) || loaded.Runtime != spec.Runtime || loaded.Pod.Name != "pod" {
+		t.Errorf("expected %+v but got %+v", spec, loaded)
+	}
+}
+
+func TestNodeSuffix(t *testing.T) {
+	if suffix := (Node{Rank: 0}).Suffix(); suffix != "" {
+		t.Errorf("unexpected suffix '%s' for rank 0", suffix)
+	}
+
+	if suffix := (Node{Rank: 3}).Suffix(); suffix != ".node3" {
+		t.Errorf("unexpected suffix '%s' for rank 3", suffix)
+	}
+}
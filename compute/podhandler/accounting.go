@@ -0,0 +1,194 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+/************************************************************
+
+			Accounting of Terminated Pods
+
+************************************************************/
+
+// The annotations that record the accounting of the job, once the pod has terminated.
+const (
+	SlurmElapsed  = "slurm.hpk.io/elapsed"
+	SlurmNodeList = "slurm.hpk.io/nodelist"
+	SlurmMaxRSS   = "slurm.hpk.io/max-rss"
+	SlurmState    = "slurm.hpk.io/state"
+	SlurmExitCode = "slurm.hpk.io/exit-code"
+)
+
+var (
+	// AccountingPollInterval is how often to check if the accounting has recorded the end of the job.
+	AccountingPollInterval = 5 * time.Second
+
+	// AccountingTimeout is how long to wait for the accounting, after the pod has terminated.
+	AccountingTimeout = 5 * time.Minute
+)
+
+// accountingInProgress holds the pods whose accounting is being collected.
+var accountingInProgress sync.Map
+
+// AccountingAnnotations translates the accounting of the job into the annotations of the pod.
+func AccountingAnnotations(accounting slurm.Accounting) map[string]string {
+	return map[string]string{
+		SlurmElapsed:  accounting.Elapsed.String(),
+		SlurmNodeList: accounting.NodeList,
+		SlurmMaxRSS:   resource.NewQuantity(accounting.MaxRSS, resource.BinarySI).String(),
+		SlurmState:    string(accounting.State),
+		SlurmExitCode: fmt.Sprintf("%d:%d", accounting.ExitCode, accounting.Signal),
+	}
+}
+
+// HasAccounting returns true if the accounting of the job has been recorded on the pod.
+func HasAccounting(pod *corev1.Pod) bool {
+	_, exists := pod.GetAnnotations()[SlurmState]
+
+	return exists
+}
+
+/*
+RecordAccounting collects the accounting of the job, once the pod has reached a terminal phase, and records it
+in the annotations of the pod. The annotations are persisted in the local copy of the pod, and are patched to the
+remote copy, so that they remain available for as long as the pod exists in Kubernetes.
+
+The accounting is finalized by Slurm some time after the containers have exited, so it is collected asynchronously.
+*/
+func RecordAccounting(ctx context.Context, pod *corev1.Pod) {
+	if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+		return
+	}
+
+	if !slurm.HasJobID(pod) || HasAccounting(pod) {
+		return
+	}
+
+	accountingScheduler, ok := scheduler.Default.(scheduler.AccountingScheduler)
+	if !ok {
+		return
+	}
+
+	podKey := client.ObjectKeyFromObject(pod)
+
+	if _, inProgress := accountingInProgress.LoadOrStore(podKey, struct{}{}); inProgress {
+		return
+	}
+
+	go func(pod *corev1.Pod) {
+		defer accountingInProgress.Delete(podKey)
+
+		logger := compute.DefaultLogger.WithValues("pod", podKey)
+
+		accounting, err := waitForAccounting(ctx, accountingScheduler, slurm.GetJobID(pod))
+		if err != nil {
+			logger.Error(err, "Unable to collect the accounting of the job")
+
+			return
+		}
+
+		annotations := AccountingAnnotations(accounting)
+
+		if err := saveAccounting(podKey, annotations); err != nil {
+			logger.Error(err, "Unable to record the accounting of the job")
+
+			return
+		}
+
+		if err := patchAnnotations(ctx, podKey, annotations); err != nil {
+			logger.Error(err, "Unable to record the accounting of the job on Kubernetes")
+
+			return
+		}
+
+		logger.Info("Accounting of the job has been recorded", "accounting", annotations)
+	}(pod.DeepCopy())
+}
+
+// waitForAccounting polls the accounting until it records the end of the job.
+func waitForAccounting(ctx context.Context, s scheduler.AccountingScheduler, jobID string) (slurm.Accounting, error) {
+	timeout := time.After(AccountingTimeout)
+
+	for {
+		accounting, err := s.Accounting(jobID)
+
+		switch {
+		case err == nil && accounting.State.IsTerminal():
+			return accounting, nil
+		case err != nil && !errors.Is(err, slurm.ErrInvalidJob):
+			// the accounting may lag behind the controller, so unknown jobs are retried.
+			return slurm.Accounting{}, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return slurm.Accounting{}, ctx.Err()
+		case <-timeout:
+			return slurm.Accounting{}, errors.Errorf("job '%s' has not been finalized in the accounting after %s", jobID, AccountingTimeout)
+		case <-time.After(AccountingPollInterval):
+		}
+	}
+}
+
+// saveAccounting sets the annotations on the local copy of the pod. The rest of the local copy is kept as is,
+// since it may have been updated while the accounting was collected.
+func saveAccounting(podKey client.ObjectKey, annotations map[string]string) error {
+	local, err := LoadPodFromKey(podKey)
+	if err != nil {
+		// the pod has been deleted in the meantime.
+		return err
+	}
+
+	for key, value := range annotations {
+		metav1.SetMetaDataAnnotation(&local.ObjectMeta, key, value)
+	}
+
+	return SavePodToFile(context.Background(), local)
+}
+
+// patchAnnotations sets the annotations on the remote copy of the pod.
+func patchAnnotations(ctx context.Context, podKey client.ObjectKey, annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": annotations},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode patch")
+	}
+
+	remote := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: podKey.Namespace, Name: podKey.Name}}
+
+	if err := compute.K8SClient.Patch(ctx, remote, client.RawPatch(types.MergePatchType, patch)); err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
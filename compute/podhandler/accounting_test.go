@@ -0,0 +1,46 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+)
+
+func TestAccountingAnnotations(t *testing.T) {
+	accounting := slurm.Accounting{
+		JobID:    "1001",
+		State:    slurm.JobStateCompleted,
+		ExitCode: 1,
+		Elapsed:  time.Hour + 5*time.Second,
+		NodeList: "node[01-02]",
+		MaxRSS:   3 << 29,
+	}
+
+	want := map[string]string{
+		SlurmElapsed:  "1h0m5s",
+		SlurmNodeList: "node[01-02]",
+		SlurmMaxRSS:   "1536Mi",
+		SlurmState:    "COMPLETED",
+		SlurmExitCode: "1:0",
+	}
+
+	if got := AccountingAnnotations(accounting); !reflect.DeepEqual(got, want) {
+		t.Errorf("AccountingAnnotations() = %v, want %v", got, want)
+	}
+}
@@ -18,11 +18,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/carv-ics-forth/hpk/compute"
 	"github.com/carv-ics-forth/hpk/compute/endpoint"
 	"github.com/carv-ics-forth/hpk/compute/image"
+	"github.com/carv-ics-forth/hpk/compute/pause"
+	"github.com/carv-ics-forth/hpk/compute/runtime"
 	"github.com/carv-ics-forth/hpk/compute/slurm"
 	kubecontainer "github.com/carv-ics-forth/hpk/pkg/container"
 	"github.com/carv-ics-forth/hpk/pkg/hostutil"
@@ -35,7 +38,7 @@ import (
 
 // buildContainer replicates the behavior of
 // https://github.com/kubernetes/kubernetes/blob/master/pkg/kubelet/kuberuntime/kuberuntime_container.go
-func (h *PodHandler) buildContainer(container *corev1.Container, containerStatus *corev1.ContainerStatus) (Container, error) {
+func (h *PodHandler) buildContainer(container *corev1.Container, containerStatus *corev1.ContainerStatus) (pause.Container, error) {
 	/*---------------------------------------------------
 	 * Determine the effective security context
 	 *---------------------------------------------------*/
@@ -86,7 +89,7 @@ func (h *PodHandler) buildContainer(container *corev1.Container, containerStatus
 
 		if subPath != "" {
 			if filepath.IsAbs(subPath) {
-				return Container{}, errors.Errorf("error SubPath '%s' must not be an absolute path", subPath)
+				return pause.Container{}, errors.Errorf("error SubPath '%s' must not be an absolute path", subPath)
 			}
 
 			subPathFile := filepath.Join(hostPath, subPath)
@@ -135,36 +138,94 @@ func (h *PodHandler) buildContainer(container *corev1.Container, containerStatus
 	/*---------------------------------------------------
 	 * Prepare Container Image
 	 *---------------------------------------------------*/
-	img, err := image.Pull(compute.HPK.ImageDir(), image.Docker, container.Image)
+	img, err := image.Pull(h.containerRuntime, compute.HPK.ImageDir(), container.Image)
 	if err != nil {
 		compute.SystemPanic(err, "ImagePull error. Image:%s ", container.Image)
 	}
 
-	// if there is no command, use the run mode, which will execute the runscript
-	// defined in the Entrypoint of the image.
-	executionMode := "exec"
-	if container.Command == nil {
-		executionMode = "run"
-	}
-
 	/*---------------------------------------------------
 	 * Prepare fields for Container Template
 	 *---------------------------------------------------*/
 	containerPath := h.podDirectory.Container(container.Name)
 
-	c := Container{
-		InstanceName:  containerID,
-		RunAsUser:     uid,
-		RunAsGroup:    gid,
-		ImageName: img.ImageName,
-		EnvFilePath:   containerPath.EnvFilePath(),
-		Binds:         binds,
-		Command:       kubecontainer.ExpandContainerCommandOnlyStatic(container.Command, container.Env),
-		Args:          kubecontainer.ExpandContainerCommandOnlyStatic(container.Args, container.Env),
-		ExecutionMode: executionMode,
-		LogsPath:      containerPath.LogsPath(),
-		JobIDPath:     containerPath.IDPath(),
-		ExitCodePath:  containerPath.ExitCodePath(),
+	spec := runtime.Container{
+		Name:    containerID,
+		Image:   img.ImageName,
+		Command: kubecontainer.ExpandContainerCommandOnlyStatic(container.Command, container.Env),
+		Args:    kubecontainer.ExpandContainerCommandOnlyStatic(container.Args, container.Env),
+		// hpk-pause prepares the dns of the pod under the scratch directory of the node.
+		Binds: append([]string{
+			pause.ScratchDir + "/etc/resolv.conf:/etc/resolv.conf:ro",
+			pause.ScratchDir + "/etc/hosts:/etc/hosts:ro",
+		}, binds...),
+		EnvFile:    filepath.Join(pause.ScratchDir, containerID+".env"),
+		WorkingDir: container.WorkingDir,
+		Hostname:   h.Pod.GetName(),
+		RunAsUser:  uid,
+		RunAsGroup: gid,
+		GPU:        h.gpu,
+		TTY:        container.Name == h.interactive,
+	}
+
+	/*---------------------------------------------------
+	 * Prepare Lifecycle Hooks
+	 *---------------------------------------------------*/
+	var postStart, preStop []string
+
+	if container.Lifecycle != nil && container.Lifecycle.PostStart != nil {
+		var hookErr error
+
+		postStart, hookErr = hookCommand(h.containerRuntime, spec, container, container.Lifecycle.PostStart)
+		if hookErr != nil {
+			h.logger.Info("Ignore postStart hook", "container", container.Name, "reason", hookErr.Error())
+		}
+	}
+
+	if container.Lifecycle != nil && container.Lifecycle.PreStop != nil {
+		var hookErr error
+
+		preStop, hookErr = hookCommand(h.containerRuntime, spec, container, container.Lifecycle.PreStop)
+		if hookErr != nil {
+			h.logger.Info("Ignore preStop hook", "container", container.Name, "reason", hookErr.Error())
+		}
+	}
+
+	/*---------------------------------------------------
+	 * Prepare Probes
+	 *---------------------------------------------------*/
+	startupProbe, err := probeSpec(h.containerRuntime, spec, container, container.StartupProbe)
+	if err != nil {
+		return pause.Container{}, errors.Wrapf(err, "invalid startupProbe")
+	}
+
+	livenessProbe, err := probeSpec(h.containerRuntime, spec, container, container.LivenessProbe)
+	if err != nil {
+		return pause.Container{}, errors.Wrapf(err, "invalid livenessProbe")
+	}
+
+	readinessProbe, err := probeSpec(h.containerRuntime, spec, container, container.ReadinessProbe)
+	if err != nil {
+		return pause.Container{}, errors.Wrapf(err, "invalid readinessProbe")
+	}
+
+	c := pause.Container{
+		Container:          spec,
+		EnvFilePath:        containerPath.EnvFilePath(),
+		LogsPath:           containerPath.LogsPath(),
+		IDPath:             containerPath.IDPath(),
+		ExitCodePath:       containerPath.ExitCodePath(),
+		RestartCountPath:   containerPath.RestartCountPath(),
+		LastExitCodePath:   containerPath.LastExitCodePath(),
+		PreviousLogsPath:   containerPath.PreviousLogsPath(),
+		PostStart:          postStart,
+		PreStop:            preStop,
+		PostStartErrorPath: containerPath.PostStartErrorPath(),
+		PreStopErrorPath:   containerPath.PreStopErrorPath(),
+		StartupProbe:       startupProbe,
+		LivenessProbe:      livenessProbe,
+		ReadinessProbe:     readinessProbe,
+		StartedPath:        containerPath.StartedPath(),
+		ReadyPath:          containerPath.ReadyPath(),
 	}
 
 	/*---------------------------------------------------
@@ -176,7 +237,7 @@ func (h *PodHandler) buildContainer(container *corev1.Container, containerStatus
 	containerStatus.Image = container.Image
 	containerStatus.ImageID = img.ImageName
 
-	return c, err
+	return c, nil
 }
 
 /*************************************************************
@@ -189,62 +250,81 @@ func SyncContainerStatuses(pod *corev1.Pod) {
 	podKey := client.ObjectKeyFromObject(pod)
 	podDir := compute.HPK.Pod(podKey)
 
+	// containers of multi-node pods terminate once they have exited on every node.
+	nodes, err := RequestedNodes(pod)
+	if err != nil {
+		nodes = 1
+	}
+
 	/*---------------------------------------------------
 	 * Generic Handler for ContainerStatus
 	 *---------------------------------------------------*/
-	handleStatus := func(containerStatus *corev1.ContainerStatus) {
-		/*-- Presence of Exit Code indicates Terminated  State--*/
-		exitCodePath := podDir.Container(containerStatus.Name).ExitCodePath()
-		exitCode, exitCodeExists := readIntFromFile(exitCodePath)
+	handleStatus := func(container *corev1.Container, containerStatus *corev1.ContainerStatus) {
+		containerPath := podDir.Container(containerStatus.Name)
+
+		/*-- Restarts within the allocation are reported by the supervisor --*/
+		if restarts := restartCount(podDir, slurm.GetPodAttempt(pod), containerStatus.Name); restarts > containerStatus.RestartCount {
+			containerStatus.RestartCount = restarts
+
+			if lastExitCode, ok := readIntFromFile(containerPath.LastExitCodePath()); ok {
+				lastTerminated := &corev1.ContainerStateTerminated{
+					ExitCode:    int32(lastExitCode),
+					Reason:      terminationReason(containerStatus.Name, lastExitCode),
+					Message:     HumanReadableCode(lastExitCode),
+					StartedAt:   runningSince(containerStatus),
+					FinishedAt:  metav1.Now(), // fixme: get it from the file's ctime
+					ContainerID: containerStatus.ContainerID,
+				}
+
+				withHookFailures(lastTerminated, containerPath)
+
+				containerStatus.LastTerminationState = corev1.ContainerState{Terminated: lastTerminated}
+			}
+
+			// the next run of the container is a new container.
+			containerStatus.State.Running = nil
+		}
+
+		/*-- Presence of Exit Code (on every node) indicates Terminated  State--*/
+		exitCode, failedRank, exitCodeExists := nodesExitCode(containerPath.ExitCodePath(), nodes)
 
 		if exitCodeExists {
-			// prepare some messages
-			var reason, message string
-			var restartCount int32
-
-			if exitCode == 0 {
-				reason = "Completed"
-				message = "Container successfully terminated"
-			} else {
-				reason = "Error(" + containerStatus.Name + ")"
+			message := "Container successfully terminated"
+			if exitCode != 0 {
 				message = HumanReadableCode(exitCode)
-				restartCount = containerStatus.RestartCount + 1
+
+				if failedRank > 0 {
+					message += fmt.Sprintf(" (node %d)", failedRank)
+				}
 			}
 
 			// set current status to terminate.
-			containerStatus.State.Waiting = nil
-			containerStatus.State.Running = nil
-			containerStatus.State.Terminated = &corev1.ContainerStateTerminated{
-				ExitCode: int32(exitCode),
-				Signal:   0,
-				Reason:   reason,
-				Message:  message,
-				StartedAt: func() metav1.Time {
-					if containerStatus.State.Running != nil {
-						return containerStatus.State.Running.StartedAt
-					} else {
-						return metav1.Time{}
-					}
-				}(),
+			terminated := &corev1.ContainerStateTerminated{
+				ExitCode:    int32(exitCode),
+				Signal:      0,
+				Reason:      terminationReason(containerStatus.Name, exitCode),
+				Message:     message,
+				StartedAt:   runningSince(containerStatus),
 				FinishedAt:  metav1.Now(), // fixme: get it from the file's ctime
 				ContainerID: containerStatus.ContainerID,
 			}
 
-			// update the last status.
-			containerStatus.LastTerminationState = containerStatus.State
+			withHookFailures(terminated, containerPath)
 
-			// increase the restart counter.
-			containerStatus.RestartCount = restartCount
+			containerStatus.State.Waiting = nil
+			containerStatus.State.Running = nil
+			containerStatus.State.Terminated = terminated
+
+			containerStatus.Ready = false
 
 			return
 		}
 
-		jobIDPath := podDir.Container(containerStatus.Name).IDPath()
-		jobID, jobIDExists := readStringFromFile(jobIDPath)
+		jobID, jobIDExists := readStringFromFile(containerPath.IDPath())
 
-		/*-- Presence of Job ID indicated Running state (need to be set only once)--*/
+		/*-- Presence of Job ID indicated Running state (need to be set only once per run)--*/
 		if jobIDExists {
-			if containerStatus.State.Running == nil {
+			if containerStatus.State.Running == nil || containerStatus.ContainerID != jobID {
 				slurm.SetContainerStatusID(containerStatus, jobID)
 
 				containerStatus.State.Waiting = nil
@@ -253,20 +333,46 @@ func SyncContainerStatuses(pod *corev1.Pod) {
 				}
 				containerStatus.State.Terminated = nil
 
-				/*-- todo: since we do not support probes, make everything to look ok --*/
-				started := true
-				containerStatus.Started = &started
-				containerStatus.Ready = true
+				// every run of the container starts unready.
+				containerStatus.Ready = false
 			}
 
+			/*-- Started and Ready follow the probes of the running container --*/
+			started, ready := probeResults(container, containerPath.StartedPath(), containerPath.ReadyPath())
+
+			if containerStatus.Ready && !ready {
+				compute.EventRecorder.Eventf(pod, corev1.EventTypeWarning, "Unhealthy",
+					"Readiness probe failed for container %s", containerStatus.Name)
+			}
+
+			containerStatus.Started = &started
+			containerStatus.Ready = ready
+
 			return
 		}
 
-		/*-- Lack of jobID indicates Waiting state --*/
-		containerStatus.State.Waiting = &corev1.ContainerStateWaiting{
-			Reason:  "InSlurmQueue",
-			Message: "Job waiting in the Slurm queue",
+		/*-- Lack of jobID on a container restarted by the supervisor indicates that it waits to be restarted --*/
+		if containerStatus.RestartCount > 0 && restartedInAttempt(containerPath) {
+			if waiting := containerStatus.State.Waiting; waiting == nil || waiting.Reason != ReasonCrashLoopBackOff {
+				compute.EventRecorder.Eventf(pod, corev1.EventTypeWarning, "BackOff",
+					"Back-off restarting failed container %s", containerStatus.Name)
+			}
+
+			started := false
+			containerStatus.Started = &started
+			containerStatus.Ready = false
+			containerStatus.State.Waiting = &corev1.ContainerStateWaiting{
+				Reason:  ReasonCrashLoopBackOff,
+				Message: "back-off restarting failed container=" + containerStatus.Name,
+			}
+			containerStatus.State.Running = nil
+			containerStatus.State.Terminated = nil
+
+			return
 		}
+
+		/*-- Lack of jobID indicates Waiting state, for the reason that Slurm reports --*/
+		containerStatus.State.Waiting = slurm.QueuedWaitingState(pod)
 		containerStatus.State.Running = nil
 		containerStatus.State.Terminated = nil
 	}
@@ -274,11 +380,127 @@ func SyncContainerStatuses(pod *corev1.Pod) {
 	/*---------------------------------------------------
 	 * Iterate containers and call the Generic Handler
 	 *---------------------------------------------------*/
+	specOf := func(containers []corev1.Container, name string) *corev1.Container {
+		for i := range containers {
+			if containers[i].Name == name {
+				return &containers[i]
+			}
+		}
+
+		return nil
+	}
+
 	for i := 0; i < len(pod.Status.InitContainerStatuses); i++ {
-		handleStatus(&pod.Status.InitContainerStatuses[i])
+		containerStatus := &pod.Status.InitContainerStatuses[i]
+
+		handleStatus(specOf(pod.Spec.InitContainers, containerStatus.Name), containerStatus)
 	}
 
 	for i := 0; i < len(pod.Status.ContainerStatuses); i++ {
-		handleStatus(&pod.Status.ContainerStatuses[i])
+		containerStatus := &pod.Status.ContainerStatuses[i]
+
+		handleStatus(specOf(pod.Spec.Containers, containerStatus.Name), containerStatus)
+	}
+}
+
+// ReasonPostStartHookError is the termination reason of containers that have been killed by their postStart hook.
+const ReasonPostStartHookError = "PostStartHookError"
+
+// ReasonCrashLoopBackOff is the waiting reason of containers that have failed, and wait to be restarted
+// within the allocation of the pod.
+const ReasonCrashLoopBackOff = "CrashLoopBackOff"
+
+// restartCount returns how many times the container has been restarted, across all the attempts of the pod.
+// Every requeued attempt in which the container has started counts as a restart (see slurm.ApplyRequeue),
+// along with the restarts that the supervisor has performed within each attempt.
+func restartCount(podDir endpoint.PodPath, attempt int, containerName string) int32 {
+	containerPath := podDir.Container(containerName)
+
+	var restarts int
+
+	for i := 0; i < attempt; i++ {
+		archived := func(path string) string {
+			return filepath.Join(podDir.AttemptDir(i), filepath.Base(path))
+		}
+
+		if _, started := readStringFromFile(archived(containerPath.IDPath())); started {
+			restarts++
+		}
+
+		if n, ok := readIntFromFile(archived(containerPath.RestartCountPath())); ok {
+			restarts += n
+		}
+	}
+
+	if n, ok := readIntFromFile(containerPath.RestartCountPath()); ok {
+		restarts += n
+	}
+
+	return int32(restarts)
+}
+
+// restartedInAttempt returns true if the supervisor has restarted the container within the current attempt of the pod.
+// The restarts of previous attempts are archived, so a requeued pod waits in the queue instead of in back-off.
+func restartedInAttempt(containerPath endpoint.ContainerPath) bool {
+	for _, path := range []string{containerPath.RestartCountPath(), containerPath.LastExitCodePath()} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runningSince returns when the current run of the container has started, if known.
+func runningSince(containerStatus *corev1.ContainerStatus) metav1.Time {
+	if containerStatus.State.Running != nil {
+		return containerStatus.State.Running.StartedAt
+	}
+
+	return metav1.Time{}
+}
+
+// terminationReason follows the reasons of the kubelet.
+func terminationReason(containerName string, exitCode int) string {
+	if exitCode == 0 {
+		return "Completed"
+	}
+
+	return "Error(" + containerName + ")"
+}
+
+// withHookFailures reports the failed lifecycle hooks of the container in its terminated state.
+// A failed postStart hook is the reason of the termination, as it kills the container.
+func withHookFailures(terminated *corev1.ContainerStateTerminated, containerPath endpoint.ContainerPath) {
+	if reason, failed := readStringFromFile(containerPath.PostStartErrorPath()); failed {
+		terminated.Reason = ReasonPostStartHookError
+		terminated.Message = "PostStartHook failed: " + reason
+	}
+
+	if reason, failed := readStringFromFile(containerPath.PreStopErrorPath()); failed {
+		terminated.Message += "; PreStopHook failed: " + reason
 	}
 }
+
+// nodesExitCode returns the exit code of a container that runs on the given number of nodes, along with
+// the rank of the node that has failed. The container has exited only once it has exited on every node,
+// and its exit code is that of the first failed node, in rank order.
+func nodesExitCode(exitCodePath string, nodes int) (exitCode int, failedRank int, exists bool) {
+	for rank := 0; rank < nodes; rank++ {
+		path := exitCodePath
+		if rank > 0 {
+			path += endpoint.NodeSuffix + strconv.Itoa(rank)
+		}
+
+		code, ok := readIntFromFile(path)
+		if !ok {
+			return -1, 0, false
+		}
+
+		if exitCode == 0 && code != 0 {
+			exitCode, failedRank = code, rank
+		}
+	}
+
+	return exitCode, failedRank, true
+}
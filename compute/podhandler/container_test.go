@@ -1,7 +1,17 @@
 package podhandler
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func Test_PodHandler_buildContainer(t *testing.T) {
@@ -53,3 +63,130 @@ func Test_PodHandler_buildContainer(t *testing.T) {
 
 	*/
 }
+
+func Test_nodesExitCode(t *testing.T) {
+	tests := []struct {
+		name         string
+		exitCodes    map[string]string
+		nodes        int
+		wantExitCode int
+		wantRank     int
+		wantExists   bool
+	}{
+		{
+			name:       "single node",
+			exitCodes:  map[string]string{"": "0"},
+			nodes:      1,
+			wantExists: true,
+		},
+		{
+			name:      "secondary node still running",
+			exitCodes: map[string]string{"": "0"},
+			nodes:     2,
+		},
+		{
+			name:         "secondary node failed",
+			exitCodes:    map[string]string{"": "0", ".node1": "0", ".node2": "137"},
+			nodes:        3,
+			wantExitCode: 137,
+			wantRank:     2,
+			wantExists:   true,
+		},
+		{
+			name:         "first failure wins",
+			exitCodes:    map[string]string{"": "1", ".node1": "2"},
+			nodes:        2,
+			wantExitCode: 1,
+			wantExists:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exitCodePath := filepath.Join(t.TempDir(), "main.exitCode")
+
+			for suffix, code := range tt.exitCodes {
+				if err := os.WriteFile(exitCodePath+suffix, []byte(code), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			exitCode, rank, exists := nodesExitCode(exitCodePath, tt.nodes)
+			if exists != tt.wantExists || (exists && (exitCode != tt.wantExitCode || rank != tt.wantRank)) {
+				t.Errorf("nodesExitCode() = (%d, %d, %t), want (%d, %d, %t)",
+					exitCode, rank, exists, tt.wantExitCode, tt.wantRank, tt.wantExists)
+			}
+		})
+	}
+}
+
+func TestSyncContainerStatusesBackOff(t *testing.T) {
+	previousHPK := compute.HPK
+	compute.HPK = endpoint.HPK(t.TempDir())
+
+	t.Cleanup(func() { compute.HPK = previousHPK })
+
+	tests := []struct {
+		name string
+
+		// attempt is the current attempt of the pod. The container has started in every previous attempt.
+		attempt int
+
+		// restarts is the restart count of the container within the current attempt.
+		restarts string
+
+		expectedRestarts int32
+		expectedBackOff  bool
+	}{
+		{name: "requeued", attempt: 1, expectedRestarts: 1},
+		{name: "restarted by the supervisor", restarts: "2", expectedRestarts: 2, expectedBackOff: true},
+		{name: "restarted after requeue", attempt: 1, restarts: "1", expectedRestarts: 2, expectedBackOff: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "backoff", Name: strings.ReplaceAll(tt.name, " ", "-")},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "main"}}},
+				Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "main"}}},
+			}
+
+			slurm.SetPodAttempt(pod, tt.attempt)
+
+			podDir := compute.HPK.Pod(client.ObjectKeyFromObject(pod))
+			containerPath := podDir.Container("main")
+
+			write := func(path string, content string) {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for i := 0; i < tt.attempt; i++ {
+				write(filepath.Join(podDir.AttemptDir(i), filepath.Base(containerPath.IDPath())), "slurm://1001")
+			}
+
+			if tt.restarts != "" {
+				write(containerPath.RestartCountPath(), tt.restarts)
+				write(containerPath.LastExitCodePath(), "1")
+			}
+
+			SyncContainerStatuses(pod)
+
+			status := pod.Status.ContainerStatuses[0]
+
+			if status.RestartCount != tt.expectedRestarts {
+				t.Errorf("expected %d restarts but got %d", tt.expectedRestarts, status.RestartCount)
+			}
+
+			backOff := status.State.Waiting != nil && status.State.Waiting.Reason == ReasonCrashLoopBackOff
+			if backOff != tt.expectedBackOff {
+				t.Errorf("expected back-off '%t' but got state %+v", tt.expectedBackOff, status.State)
+			}
+		})
+	}
+}
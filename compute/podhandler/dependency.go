@@ -0,0 +1,302 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+/************************************************************
+
+			Inter-Pod Job Dependencies
+
+************************************************************/
+
+// SlurmDependsOn lists the pods that must reach a given state before the pod starts,
+// in the form '<type>:<namespace>/<pod>,...' (e.g, 'afterok:ns/pod-a,afterany:ns/pod-b').
+// The namespace may be omitted for pods in the same namespace.
+const SlurmDependsOn = "slurm.hpk.io/depends-on"
+
+// The dependency types of sbatch that are supported between pods.
+// https://slurm.schedmd.com/sbatch.html#OPT_dependency
+const (
+	DependencyAfter      = "after"
+	DependencyAfterAny   = "afterany"
+	DependencyAfterOK    = "afterok"
+	DependencyAfterNotOK = "afternotok"
+)
+
+var (
+	// DependencyPollInterval is how often to check if the referenced pods have been submitted.
+	DependencyPollInterval = 2 * time.Second
+
+	// DependencyGracePeriod is how long to wait for referenced pods that do not exist in Kubernetes.
+	DependencyGracePeriod = time.Minute
+)
+
+var (
+	errDependencyPending = errors.New("dependency is not yet submitted")
+
+	errPodDeleted = errors.New("pod has been deleted while waiting for its dependencies")
+
+	ErrDependencyNeverSatisfied = errors.New("dependency can never be satisfied")
+)
+
+// Dependency is a reference to a pod that must reach a given state before the dependent pod starts.
+type Dependency struct {
+	Type string
+	Pod  client.ObjectKey
+}
+
+func (d Dependency) String() string {
+	return d.Type + ":" + d.Pod.String()
+}
+
+// ParseDependencies parses the 'slurm.hpk.io/depends-on' annotation of the pod.
+func ParseDependencies(pod *corev1.Pod) ([]Dependency, error) {
+	raw, exists := pod.GetAnnotations()[SlurmDependsOn]
+	if !exists {
+		return nil, nil
+	}
+
+	var dependencies []Dependency
+
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		depType, ref, found := strings.Cut(entry, ":")
+		if !found || ref == "" {
+			return nil, errors.Errorf("invalid dependency '%s' in annotation '%s'. expected <type>:<namespace>/<pod>", entry, SlurmDependsOn)
+		}
+
+		switch depType {
+		case DependencyAfter, DependencyAfterAny, DependencyAfterOK, DependencyAfterNotOK:
+		default:
+			return nil, errors.Errorf("unsupported dependency type '%s' in annotation '%s'", depType, SlurmDependsOn)
+		}
+
+		key := client.ObjectKey{Namespace: pod.GetNamespace(), Name: ref}
+
+		if namespace, name, qualified := strings.Cut(ref, "/"); qualified {
+			key = client.ObjectKey{Namespace: namespace, Name: name}
+		}
+
+		if key.Name == "" || key.Namespace == "" {
+			return nil, errors.Errorf("invalid pod reference '%s' in annotation '%s'", ref, SlurmDependsOn)
+		}
+
+		dependencies = append(dependencies, Dependency{Type: depType, Pod: key})
+	}
+
+	return dependencies, nil
+}
+
+// ResolveDependency translates the dependency into a Slurm dependency (e.g, 'afterok:1001'), given the
+// most recent view of the referenced pod. Dependencies on pods that have already terminated cannot be given
+// to Slurm (their jobs may have been purged), so they are either satisfied (empty string),
+// or ErrDependencyNeverSatisfied. Dependencies on pods that run in a pilot are resolved the same way,
+// once the pods have terminated.
+func ResolveDependency(dep Dependency, target *corev1.Pod) (string, error) {
+	switch target.Status.Phase {
+	case corev1.PodSucceeded:
+		if dep.Type == DependencyAfterNotOK {
+			return "", errors.Wrapf(ErrDependencyNeverSatisfied, "pod '%s' has succeeded", dep.Pod)
+		}
+
+		return "", nil
+
+	case corev1.PodFailed:
+		if dep.Type == DependencyAfterOK {
+			return "", errors.Wrapf(ErrDependencyNeverSatisfied, "pod '%s' has failed", dep.Pod)
+		}
+
+		return "", nil
+	}
+
+	if !slurm.HasJobID(target) {
+		return "", errDependencyPending
+	}
+
+	jobID := slurm.GetJobID(target)
+
+	// tasks of pilots are not known to Slurm, so the pod waits until the task has started or terminated instead.
+	if scheduler.IsPilotTask(jobID) {
+		if dep.Type == DependencyAfter && target.Status.Phase == corev1.PodRunning {
+			return "", nil
+		}
+
+		return "", errDependencyPending
+	}
+
+	return dep.Type + ":" + jobID, nil
+}
+
+// resolveDependencies blocks until every referenced pod has either been submitted or terminated,
+// and returns the respective '--dependency' flag. The flag is empty if all dependencies are satisfied.
+func (h *PodHandler) resolveDependencies(ctx context.Context, dependencies []Dependency) (string, error) {
+	firstSeen := time.Now()
+
+	for {
+		var (
+			resolved []string
+			pending  []Dependency
+		)
+
+		for _, dep := range dependencies {
+			target, err := lookupDependency(ctx, dep.Pod)
+			if err != nil {
+				// transient errors of the api server only delay the pod.
+				if !k8serrors.IsNotFound(err) {
+					h.logger.Info(" * Cannot look up dependency. Retry", "dependency", dep.String(), "err", err.Error())
+
+					pending = append(pending, dep)
+
+					continue
+				}
+
+				if time.Since(firstSeen) > DependencyGracePeriod {
+					return "", errors.Wrapf(ErrDependencyNeverSatisfied, "pod '%s' does not exist", dep.Pod)
+				}
+
+				pending = append(pending, dep)
+
+				continue
+			}
+
+			slurmDep, err := ResolveDependency(dep, target)
+			switch {
+			case errors.Is(err, errDependencyPending):
+				pending = append(pending, dep)
+			case err != nil:
+				return "", err
+			case slurmDep != "":
+				resolved = append(resolved, slurmDep)
+			}
+		}
+
+		if len(pending) == 0 {
+			if len(resolved) == 0 {
+				return "", nil
+			}
+
+			return "--dependency=" + strings.Join(resolved, ","), nil
+		}
+
+		// pods that wait on each other would never be submitted.
+		if cycle := DependencyCycle(h.podKey, pending, func(key client.ObjectKey) (*corev1.Pod, error) {
+			return lookupDependency(ctx, key)
+		}); cycle != nil {
+			return "", errors.Wrapf(ErrDependencyNeverSatisfied, "circular dependency '%s'", formatCycle(cycle))
+		}
+
+		h.logger.Info(" * Waiting for dependencies to be submitted", "pending", fmt.Sprint(pending))
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(DependencyPollInterval):
+		}
+
+		// stop waiting if the dependent pod has been deleted in the meantime.
+		var self corev1.Pod
+
+		if err := compute.K8SClient.Get(ctx, h.podKey, &self); k8serrors.IsNotFound(err) || self.GetDeletionTimestamp() != nil {
+			return "", errPodDeleted
+		}
+	}
+}
+
+// DependencyCycle returns the chain of pods that leads from the dependencies back to the pod (e.g, [a b a]),
+// or nil if there is none. Only the pods that have not been submitted are followed, as the rest cannot wait on the pod.
+func DependencyCycle(self client.ObjectKey, dependencies []Dependency, lookup func(client.ObjectKey) (*corev1.Pod, error)) []client.ObjectKey {
+	visited := make(map[client.ObjectKey]bool)
+
+	var walk func(dependencies []Dependency, chain []client.ObjectKey) []client.ObjectKey
+
+	walk = func(dependencies []Dependency, chain []client.ObjectKey) []client.ObjectKey {
+		for _, dep := range dependencies {
+			next := append(append([]client.ObjectKey{}, chain...), dep.Pod)
+
+			if dep.Pod == self {
+				return next
+			}
+
+			if visited[dep.Pod] {
+				continue
+			}
+
+			visited[dep.Pod] = true
+
+			target, err := lookup(dep.Pod)
+			if err != nil || slurm.HasJobID(target) ||
+				target.Status.Phase == corev1.PodSucceeded || target.Status.Phase == corev1.PodFailed {
+				continue
+			}
+
+			targetDependencies, err := ParseDependencies(target)
+			if err != nil {
+				continue
+			}
+
+			if cycle := walk(targetDependencies, next); cycle != nil {
+				return cycle
+			}
+		}
+
+		return nil
+	}
+
+	return walk(dependencies, []client.ObjectKey{self})
+}
+
+func formatCycle(cycle []client.ObjectKey) string {
+	names := make([]string, 0, len(cycle))
+
+	for _, key := range cycle {
+		names = append(names, key.String())
+	}
+
+	return strings.Join(names, " -> ")
+}
+
+// lookupDependency returns the local copy of the referenced pod, which holds its job id,
+// or the copy from Kubernetes if the pod has not been submitted yet.
+func lookupDependency(ctx context.Context, key client.ObjectKey) (*corev1.Pod, error) {
+	if local, err := LoadPodFromKey(key); err == nil {
+		return local, nil
+	}
+
+	var remote corev1.Pod
+
+	if err := compute.K8SClient.Get(ctx, key, &remote); err != nil {
+		return nil, err
+	}
+
+	return &remote, nil
+}
@@ -0,0 +1,187 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/carv-ics-forth/hpk/compute/podhandler"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestParseDependencies(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		want       []podhandler.Dependency
+		wantErr    bool
+	}{
+		{
+			name:       "qualified and local references",
+			annotation: "afterok:ns/pod-a, afterany:pod-b",
+			want: []podhandler.Dependency{
+				{Type: podhandler.DependencyAfterOK, Pod: client.ObjectKey{Namespace: "ns", Name: "pod-a"}},
+				{Type: podhandler.DependencyAfterAny, Pod: client.ObjectKey{Namespace: "default", Name: "pod-b"}},
+			},
+		},
+		{name: "missing type", annotation: "ns/pod-a", wantErr: true},
+		{name: "unsupported type", annotation: "aftercorr:ns/pod-a", wantErr: true},
+		{name: "empty pod", annotation: "afterok:ns/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "default",
+					Name:        "dependent",
+					Annotations: map[string]string{podhandler.SlurmDependsOn: tt.annotation},
+				},
+			}
+
+			got, err := podhandler.ParseDependencies(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDependencies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDependencies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveDependency(t *testing.T) {
+	newPod := func(phase corev1.PodPhase, jobID string) *corev1.Pod {
+		pod := &corev1.Pod{Status: corev1.PodStatus{Phase: phase}}
+
+		if jobID != "" {
+			slurm.SetPodID(pod, slurm.JobIDTypeSlurm, jobID)
+		}
+
+		return pod
+	}
+
+	ref := client.ObjectKey{Namespace: "ns", Name: "pod-a"}
+
+	tests := []struct {
+		name      string
+		depType   string
+		target    *corev1.Pod
+		want      string
+		wantNever bool
+		wantErr   bool
+	}{
+		{name: "submitted", depType: podhandler.DependencyAfterOK, target: newPod(corev1.PodPending, "1001"), want: "afterok:1001"},
+		{name: "not yet submitted", depType: podhandler.DependencyAfterOK, target: newPod(corev1.PodPending, ""), wantErr: true},
+		{name: "afterok on succeeded", depType: podhandler.DependencyAfterOK, target: newPod(corev1.PodSucceeded, "1001"), want: ""},
+		{name: "afterok on failed", depType: podhandler.DependencyAfterOK, target: newPod(corev1.PodFailed, "1001"), wantNever: true},
+		{name: "afternotok on succeeded", depType: podhandler.DependencyAfterNotOK, target: newPod(corev1.PodSucceeded, ""), wantNever: true},
+		{name: "afterany on failed", depType: podhandler.DependencyAfterAny, target: newPod(corev1.PodFailed, ""), want: ""},
+		{name: "pilot task", depType: podhandler.DependencyAfterOK, target: newPod(corev1.PodRunning, "1001.3"), wantErr: true},
+		{name: "after on running pilot task", depType: podhandler.DependencyAfter, target: newPod(corev1.PodRunning, "1001.3"), want: ""},
+		{name: "afterok on succeeded pilot task", depType: podhandler.DependencyAfterOK, target: newPod(corev1.PodSucceeded, "1001.3"), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := podhandler.ResolveDependency(podhandler.Dependency{Type: tt.depType, Pod: ref}, tt.target)
+
+			if never := errors.Is(err, podhandler.ErrDependencyNeverSatisfied); never != tt.wantNever {
+				t.Fatalf("ResolveDependency() error = %v, want never satisfied = %v", err, tt.wantNever)
+			}
+
+			if !tt.wantNever && (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveDependency() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ResolveDependency() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDependencyCycle(t *testing.T) {
+	key := func(name string) client.ObjectKey {
+		return client.ObjectKey{Namespace: "ns", Name: name}
+	}
+
+	newPod := func(dependsOn string, jobID string) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns"}}
+
+		if dependsOn != "" {
+			pod.Annotations = map[string]string{podhandler.SlurmDependsOn: dependsOn}
+		}
+
+		if jobID != "" {
+			slurm.SetPodID(pod, slurm.JobIDTypeSlurm, jobID)
+		}
+
+		return pod
+	}
+
+	pods := map[client.ObjectKey]*corev1.Pod{
+		key("b"):         newPod("afterok:a", ""),
+		key("c"):         newPod("afterok:d", ""),
+		key("d"):         newPod("afterany:b", ""),
+		key("submitted"): newPod("afterok:a", "1001"),
+		key("leaf"):      newPod("", ""),
+		key("loop-x"):    newPod("afterok:loop-y", ""),
+		key("loop-y"):    newPod("afterok:loop-x", ""),
+	}
+
+	lookup := func(k client.ObjectKey) (*corev1.Pod, error) {
+		if pod, exists := pods[k]; exists {
+			return pod, nil
+		}
+
+		return nil, errors.New("not found")
+	}
+
+	tests := []struct {
+		name      string
+		dependsOn string
+		want      []client.ObjectKey
+	}{
+		{name: "self", dependsOn: "afterok:a", want: []client.ObjectKey{key("a"), key("a")}},
+		{name: "direct", dependsOn: "afterok:b", want: []client.ObjectKey{key("a"), key("b"), key("a")}},
+		{name: "transitive", dependsOn: "afterok:leaf,afterok:c", want: []client.ObjectKey{key("a"), key("c"), key("d"), key("b"), key("a")}},
+		{name: "submitted", dependsOn: "afterok:submitted"},
+		{name: "missing", dependsOn: "afterok:missing"},
+		{name: "unrelated loop", dependsOn: "afterok:loop-x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newPod(tt.dependsOn, "")
+			pod.Name = "a"
+
+			dependencies, err := podhandler.ParseDependencies(pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := podhandler.DependencyCycle(key("a"), dependencies, lookup); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DependencyCycle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/carv-ics-forth/hpk/pkg/pty"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TerminalAnnotation marks the pods that have been submitted on a terminal, with the name of the interactive container.
+const TerminalAnnotation = "pod.hpk/terminal"
+
+/************************************************************
+
+			Interactive Pods
+
+************************************************************/
+
+var (
+	// ErrNotInteractive is returned when attaching to a container that does not run on a terminal.
+	ErrNotInteractive = errors.New("container is not interactive")
+
+	// ErrNoTerminal is returned when the terminal of an interactive pod is gone (e.g, the pod has terminated,
+	// or HPK has been restarted since the pod was created).
+	ErrNoTerminal = errors.New("terminal of the pod is not available")
+)
+
+// InteractiveContainer returns the name of the container that is attached to the terminal of the pod,
+// namely the first container with both stdin and tty. Pods without such a container are not interactive.
+func InteractiveContainer(pod *corev1.Pod) (string, bool) {
+	for _, container := range pod.Spec.Containers {
+		if container.Stdin && container.TTY {
+			return container.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// interactiveContainer returns the container of the pod that will run on a terminal, if any.
+// Interactive pods that cannot run on a terminal fall back to batch jobs, and cannot be attached to.
+func (h *PodHandler) interactiveContainer(nodes int) string {
+	name, interactive := InteractiveContainer(h.Pod)
+	if !interactive {
+		return ""
+	}
+
+	if _, ok := scheduler.Default.(scheduler.InteractiveScheduler); !ok {
+		h.logger.Info("Scheduler does not support interactive pods. Run as batch job", "container", name)
+
+		return ""
+	}
+
+	if nodes > 1 {
+		h.logger.Info("Multi-node pods cannot be interactive. Run as batch job", "container", name)
+
+		return ""
+	}
+
+	return name
+}
+
+// session is the terminal of an interactive pod.
+type session struct {
+	terminal *pty.Terminal
+
+	container string
+
+	// stdinOnce closes the stdin of the container once the first attached client detaches.
+	stdinOnce   bool
+	stdinClosed bool
+	lock        sync.Mutex
+}
+
+// sessions holds the terminals of the interactive pods, by pod key.
+var sessions sync.Map
+
+// submitInteractive submits the script on a pseudo-terminal, and keeps the terminal for attaching to the pod.
+// The output of the terminal is recorded as the logs of the interactive container.
+func (h *PodHandler) submitInteractive(scriptFile string) (string, error) {
+	interactive := scheduler.Default.(scheduler.InteractiveScheduler)
+
+	jobID, terminal, err := interactive.SubmitInteractive(scriptFile, h.podDirectory.Container(h.interactive).LogsPath())
+	if err != nil {
+		return "", err
+	}
+
+	s := &session{terminal: terminal, container: h.interactive}
+
+	for _, container := range h.Pod.Spec.Containers {
+		if container.Name == h.interactive {
+			s.stdinOnce = container.StdinOnce
+		}
+	}
+
+	sessions.Store(h.podKey, s)
+
+	// the terminal does not survive a restart of HPK. See FailOrphanedInteractivePods.
+	metav1.SetMetaDataAnnotation(&h.Pod.ObjectMeta, TerminalAnnotation, h.interactive)
+
+	go func() {
+		<-terminal.Done()
+
+		sessions.CompareAndDelete(h.podKey, s)
+
+		h.logger.Info("Terminal of interactive pod has exited", "jobID", jobID, "err", terminal.Err())
+	}()
+
+	return jobID, nil
+}
+
+// FailOrphanedInteractivePods fails the active interactive pods that have no terminal. It is meant to run once HPK has
+// restarted, since salloc runs as a child of HPK and is terminated along with it (e.g, by SIGHUP). The pods can
+// neither continue nor be attached to, so their jobs are cancelled. It returns the pods that have been failed.
+func FailOrphanedInteractivePods(ctx context.Context) ([]*corev1.Pod, error) {
+	pods, err := LoadPods()
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []*corev1.Pod
+
+	for _, pod := range pods {
+		podKey := client.ObjectKeyFromObject(pod)
+
+		if _, onTerminal := pod.GetAnnotations()[TerminalAnnotation]; !onTerminal {
+			continue
+		}
+
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		if _, exists := sessions.Load(podKey); exists {
+			continue
+		}
+
+		if slurm.HasJobID(pod) {
+			if out, err := scheduler.Default.Cancel(slurm.GetJobID(pod)); err != nil && !errors.Is(err, slurm.ErrInvalidJob) {
+				compute.DefaultLogger.Error(err, "Unable to cancel the job of orphaned interactive pod", "pod", podKey, "out", out)
+			}
+		}
+
+		compute.PodError(pod, compute.ReasonTerminalLost, "the terminal of the interactive pod has been lost, since HPK has been restarted")
+		compute.EventRecorder.Event(pod, corev1.EventTypeWarning, compute.ReasonTerminalLost, pod.Status.Message)
+
+		if err := SavePodToFile(ctx, pod); err != nil {
+			return failed, errors.Wrapf(err, "failed to persist pod '%s'", podKey)
+		}
+
+		compute.DefaultLogger.Info("Interactive pod has lost its terminal", "pod", podKey)
+
+		failed = append(failed, pod)
+	}
+
+	return failed, nil
+}
+
+// AttachToContainer streams the terminal of an interactive pod, until the client detaches or the pod exits.
+// Clients that attach before the allocation starts see the output of the container once it starts.
+func AttachToContainer(ctx context.Context, podKey client.ObjectKey, containerName string,
+	stdin io.Reader, stdout io.Writer, resize <-chan pty.Size,
+) error {
+	value, exists := sessions.Load(podKey)
+	if !exists {
+		pod, err := LoadPodFromKey(podKey)
+		if err != nil {
+			return errors.Wrapf(err, "cannot load pod '%s'", podKey)
+		}
+
+		if name, interactive := InteractiveContainer(pod); !interactive || name != containerName {
+			return errors.Wrapf(ErrNotInteractive, "container '%s' of pod '%s' has no stdin and tty", containerName, podKey)
+		}
+
+		return errors.Wrapf(ErrNoTerminal, "pod '%s'", podKey)
+	}
+
+	s := value.(*session)
+
+	if s.container != containerName {
+		return errors.Wrapf(ErrNotInteractive, "container '%s' of pod '%s' is not attached to the terminal", containerName, podKey)
+	}
+
+	s.lock.Lock()
+	if s.stdinClosed {
+		// the container has already consumed its stdin.
+		stdin = nil
+	}
+	s.lock.Unlock()
+
+	if err := s.terminal.Attach(ctx, stdin, stdout, resize); err != nil {
+		return errors.Wrapf(err, "cannot attach to pod '%s'", podKey)
+	}
+
+	if s.stdinOnce && stdin != nil {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		if !s.stdinClosed {
+			s.stdinClosed = true
+
+			return s.terminal.CloseStdin()
+		}
+	}
+
+	return nil
+}
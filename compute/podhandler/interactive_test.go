@@ -0,0 +1,109 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler_test
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/compute/podhandler"
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// cancelRecorder records the jobs that are cancelled, in place of the batch system.
+type cancelRecorder struct {
+	scheduler.Scheduler
+
+	cancelled []string
+}
+
+func (s *cancelRecorder) Cancel(jobID string) (string, error) {
+	s.cancelled = append(s.cancelled, jobID)
+
+	return "", nil
+}
+
+func TestFailOrphanedInteractivePods(t *testing.T) {
+	recorder := &cancelRecorder{}
+
+	previousScheduler, previousHPK := scheduler.Default, compute.HPK
+	scheduler.Default, compute.HPK = recorder, endpoint.HPK(t.TempDir())
+
+	t.Cleanup(func() { scheduler.Default, compute.HPK = previousScheduler, previousHPK })
+
+	savePod := func(name string, jobID string, phase corev1.PodPhase) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "interactive", Name: name},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+
+		// only interactive pods are given a job on a terminal.
+		if jobID != "" {
+			metav1.SetMetaDataAnnotation(&pod.ObjectMeta, podhandler.TerminalAnnotation, "shell")
+			slurm.SetPodID(pod, slurm.JobIDTypeSlurm, jobID)
+		}
+
+		podDir := compute.HPK.Pod(client.ObjectKeyFromObject(pod))
+
+		if err := os.MkdirAll(podDir.JobDir(), endpoint.PodGlobalDirectoryPermissions); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := podhandler.SavePodToFile(context.Background(), pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	savePod("orphaned", "1001", corev1.PodRunning)
+	savePod("completed", "1002", corev1.PodSucceeded)
+	savePod("batch", "", corev1.PodRunning)
+
+	failed, err := podhandler.FailOrphanedInteractivePods(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) != 1 || failed[0].GetName() != "orphaned" {
+		t.Fatalf("expected only the orphaned pod to fail, got %v", failed)
+	}
+
+	if !reflect.DeepEqual(recorder.cancelled, []string{"1001"}) {
+		t.Errorf("expected only the job of the orphaned pod to be cancelled, got %v", recorder.cancelled)
+	}
+
+	expectPhase := func(name string, phase corev1.PodPhase, reason string) {
+		pod, err := podhandler.LoadPodFromKey(client.ObjectKey{Namespace: "interactive", Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pod.Status.Phase != phase || pod.Status.Reason != reason {
+			t.Errorf("pod '%s': expected phase '%s' and reason '%s', got '%s' and '%s'",
+				name, phase, reason, pod.Status.Phase, pod.Status.Reason)
+		}
+	}
+
+	expectPhase("orphaned", corev1.PodFailed, compute.ReasonTerminalLost)
+	expectPhase("completed", corev1.PodSucceeded, "")
+	expectPhase("batch", corev1.PodRunning, "")
+}
@@ -0,0 +1,82 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"strconv"
+
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// JobCompletionIndexAnnotation is set by the Job controller on the pods of Indexed Jobs.
+const JobCompletionIndexAnnotation = "batch.kubernetes.io/job-completion-index"
+
+// IndexedJobTask returns the array group and the completion index of a pod that belongs to an Indexed Job.
+// The group is unique per Job, so that pods of different Jobs are never coalesced together.
+func IndexedJobTask(pod *corev1.Pod) (group string, index int, indexed bool) {
+	rawIndex, exists := pod.GetAnnotations()[JobCompletionIndexAnnotation]
+	if !exists {
+		return "", 0, false
+	}
+
+	index, err := strconv.Atoi(rawIndex)
+	if err != nil || index < 0 {
+		return "", 0, false
+	}
+
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "Job" {
+		return "", 0, false
+	}
+
+	return pod.GetNamespace() + "_" + owner.Name, index, true
+}
+
+// submitJob submits the pod's script to the Default scheduler. Pods of Indexed Jobs are submitted as tasks
+// of a job array, if the scheduler supports it. Transient errors are retried with backoff.
+func (h *PodHandler) submitJob(scriptFile string) (jobID string, err error) {
+	err = retry.OnError(slurm.SubmitBackoff, slurm.IsTransient, func() error {
+		jobID, err = h.submit(scriptFile)
+		if slurm.IsTransient(err) {
+			h.logger.Info(" * Slurm submission has failed. Retry", "err", err.Error())
+		}
+
+		return err
+	})
+
+	return jobID, err
+}
+
+func (h *PodHandler) submit(scriptFile string) (string, error) {
+	if h.interactive != "" {
+		h.logger.Info(" * Pod is interactive. Submit on a terminal", "container", h.interactive)
+
+		return h.submitInteractive(scriptFile)
+	}
+
+	if arrays, ok := scheduler.Default.(scheduler.ArrayScheduler); ok {
+		if group, index, indexed := IndexedJobTask(h.Pod); indexed {
+			h.logger.Info(" * Pod belongs to an Indexed Job. Submit as array task", "group", group, "index", index)
+
+			return arrays.SubmitArrayTask(group, index, scriptFile)
+		}
+	}
+
+	return scheduler.Default.Submit(scriptFile)
+}
@@ -0,0 +1,72 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler_test
+
+import (
+	"testing"
+
+	"github.com/carv-ics-forth/hpk/compute/podhandler"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestIndexedJobTask(t *testing.T) {
+	newPod := func(index string, ownerKind string) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "sweep-3-abcde",
+			},
+		}
+
+		if index != "" {
+			pod.Annotations = map[string]string{podhandler.JobCompletionIndexAnnotation: index}
+		}
+
+		if ownerKind != "" {
+			pod.OwnerReferences = []metav1.OwnerReference{
+				{APIVersion: "batch/v1", Kind: ownerKind, Name: "sweep", Controller: pointer.Bool(true)},
+			}
+		}
+
+		return pod
+	}
+
+	tests := []struct {
+		name      string
+		pod       *corev1.Pod
+		wantGroup string
+		wantIndex int
+		indexed   bool
+	}{
+		{name: "indexed job", pod: newPod("3", "Job"), wantGroup: "default_sweep", wantIndex: 3, indexed: true},
+		{name: "non-indexed job", pod: newPod("", "Job")},
+		{name: "standalone pod", pod: newPod("3", "")},
+		{name: "other owner", pod: newPod("3", "StatefulSet")},
+		{name: "malformed index", pod: newPod("three", "Job")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group, index, indexed := podhandler.IndexedJobTask(tt.pod)
+
+			if indexed != tt.indexed || group != tt.wantGroup || index != tt.wantIndex {
+				t.Errorf("IndexedJobTask() = (%s, %d, %v), want (%s, %d, %v)",
+					group, index, indexed, tt.wantGroup, tt.wantIndex, tt.indexed)
+			}
+		})
+	}
+}
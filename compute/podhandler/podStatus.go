@@ -21,8 +21,10 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
 	"github.com/carv-ics-forth/hpk/pkg/crdtools"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
@@ -58,9 +60,17 @@ func UpdateStatusFromRuntime(pod *corev1.Pod) {
 		if ok {
 			pod.Status.PodIP = ip
 			pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: ip})
+
+			/*-- the ip is announced as soon as the Slurm job starts --*/
+			if pod.Status.StartTime == nil {
+				now := metav1.Now()
+				pod.Status.StartTime = &now
+			}
 		}
 	}
 
+	syncNodeIPs(pod, podDir)
+
 	/*---------------------------------------------------
 	 * Load Container Statuses
 	 *---------------------------------------------------*/
@@ -133,6 +143,11 @@ func UpdateStatusFromRuntime(pod *corev1.Pod) {
 				status.Reason = "ContainerFailed"
 				status.Message = fmt.Sprintf("Failed containers: %s", state.ListFailedJobs())
 
+				if DeadlineExceeded(pod, time.Now()) {
+					status.Reason = compute.ReasonDeadlineExceeded
+					status.Message = compute.MessageDeadlineExceeded
+				}
+
 				setTerminationConditions(pod)
 			},
 		},
@@ -155,7 +170,21 @@ func UpdateStatusFromRuntime(pod *corev1.Pod) {
 				status.Reason = "Running"
 				status.Message = "at least one pod is still running"
 
-				/*-- ContainersReady: all containers in the pod are ready. --*/
+				/*-- ContainersReady: all containers in the pod are ready, as reported by their probes. --*/
+				if unready := unreadyContainers(pod); len(unready) > 0 {
+					for _, conditionType := range []corev1.PodConditionType{corev1.ContainersReady, corev1.PodReady} {
+						crdtools.SetPodStatusCondition(&pod.Status.Conditions, corev1.PodCondition{
+							Type:               conditionType,
+							Status:             corev1.ConditionFalse,
+							LastTransitionTime: metav1.Now(),
+							Reason:             "ContainersNotReady",
+							Message:            "containers with unready status: " + strings.Join(unready, ","),
+						})
+					}
+
+					return
+				}
+
 				crdtools.SetPodStatusCondition(&pod.Status.Conditions, corev1.PodCondition{
 					Type:   corev1.ContainersReady,
 					Status: corev1.ConditionTrue,
@@ -221,6 +250,78 @@ func UpdateStatusFromRuntime(pod *corev1.Pod) {
 		 `, pod.Status.Phase, totalJobs, state.ListAll()))
 }
 
+// DeadlineSignalLead is how long before the time limit Slurm signals the job to terminate.
+// It must match the '--signal' directive of the HostScriptTemplate.
+const DeadlineSignalLead = 60 * time.Second
+
+// DeadlineExceeded returns true if the pod has reached the termination window of its activeDeadlineSeconds.
+func DeadlineExceeded(pod *corev1.Pod, now time.Time) bool {
+	if pod.Spec.ActiveDeadlineSeconds == nil || pod.Status.StartTime == nil {
+		return false
+	}
+
+	deadline := pod.Status.StartTime.Add(time.Duration(*pod.Spec.ActiveDeadlineSeconds) * time.Second)
+
+	return !now.Before(deadline.Add(-DeadlineSignalLead))
+}
+
+// PodNodesReady is set on multi-node pods, and lists the ip of every node in its message.
+const PodNodesReady corev1.PodConditionType = "slurm.hpk.io/NodesReady"
+
+// syncNodeIPs collects the ips announced by the nodes of a multi-node pod.
+// Status.PodIPs may hold at most one ip per family, so it only holds the ip of the first node,
+// and the ips of all nodes are reported through the PodNodesReady condition.
+func syncNodeIPs(pod *corev1.Pod, podDir endpoint.PodPath) {
+	nodes, err := RequestedNodes(pod)
+	if err != nil || nodes <= 1 {
+		return
+	}
+
+	if crdtools.IsStatusConditionTrue(pod.Status.Conditions, PodNodesReady) {
+		return
+	}
+
+	nodeIPs := make([]string, 0, nodes)
+
+	for rank := 0; rank < nodes; rank++ {
+		if ip, ok := readStringFromFile(podDir.NodeIPAddressPath(rank)); ok {
+			nodeIPs = append(nodeIPs, fmt.Sprintf("%d=%s", rank, ip))
+		}
+	}
+
+	condition := corev1.PodCondition{
+		Type:               PodNodesReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             "NodesPending",
+		Message:            strings.Join(nodeIPs, ","),
+	}
+
+	if len(nodeIPs) == nodes {
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = "NodesReady"
+	}
+
+	crdtools.SetPodStatusCondition(&pod.Status.Conditions, condition)
+}
+
+// unreadyContainers lists the containers that have not terminated successfully, and are not ready.
+func unreadyContainers(pod *corev1.Pod) []string {
+	var unready []string
+
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if terminated := containerStatus.State.Terminated; terminated != nil && terminated.ExitCode == 0 {
+			continue
+		}
+
+		if !containerStatus.Ready {
+			unready = append(unready, containerStatus.Name)
+		}
+	}
+
+	return unready
+}
+
 func setTerminationConditions(pod *corev1.Pod) {
 	crdtools.SetPodStatusCondition(&pod.Status.Conditions, corev1.PodCondition{
 		Type:   corev1.ContainersReady,
@@ -273,21 +374,6 @@ func podWithExplicitlyUnsupportedFields(logger logr.Logger, pod *corev1.Pod) boo
 			logger.Info(fmt.Sprintf("Ignore .Spec.Containers[%d].SecurityContext", i))
 			// unsupportedFields = append(unsupportedFields, fmt.Sprintf(".Spec.Containers[%d].SecurityContext", i))
 		}
-
-		if container.StartupProbe != nil {
-			logger.Info(fmt.Sprintf("Ignore .Spec.Containers[%d].StartupProbe", i))
-			// unsupportedFields = append(unsupportedFields, fmt.Sprintf(".Spec.Containers[%d].StartupProbe", i))
-		}
-
-		if container.LivenessProbe != nil {
-			logger.Info(fmt.Sprintf("Ignore .Spec.Containers[%d].LivenessProbe", i))
-			// unsupportedFields = append(unsupportedFields, fmt.Sprintf(".Spec.Containers[%d].LivenessProbe", i))
-		}
-
-		if container.ReadinessProbe != nil {
-			logger.Info(fmt.Sprintf("Ignore .Spec.Containers[%d].ReadinessProbe", i))
-			// unsupportedFields = append(unsupportedFields, fmt.Sprintf(".Spec.Containers[%d].ReadinessProbe", i))
-		}
 	}
 
 	/*---------------------------------------------------
@@ -407,6 +493,9 @@ func (in *Classifier) Classify(name string, status *corev1.ContainerStatus) {
 		}
 	case status.State.Running != nil:
 		in.runningJobs[name] = status
+	case status.State.Waiting != nil && status.State.Waiting.Reason == ReasonCrashLoopBackOff:
+		/*-- the container waits to be restarted within the allocation --*/
+		in.runningJobs[name] = status
 	case status.State.Waiting != nil:
 		in.pendingJobs[name] = status
 	default:
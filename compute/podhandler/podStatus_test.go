@@ -0,0 +1,107 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/podhandler"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestDeadlineExceeded(t *testing.T) {
+	startTime := metav1.NewTime(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name      string
+		deadline  *int64
+		startTime *metav1.Time
+		elapsed   time.Duration
+		want      bool
+	}{
+		{name: "no deadline", startTime: &startTime, elapsed: time.Hour, want: false},
+		{name: "not started", deadline: pointer.Int64(600), elapsed: time.Hour, want: false},
+		{name: "before the deadline", deadline: pointer.Int64(600), startTime: &startTime, elapsed: 5 * time.Minute, want: false},
+		{name: "within the signal lead", deadline: pointer.Int64(600), startTime: &startTime, elapsed: 9*time.Minute + 30*time.Second, want: true},
+		{name: "after the deadline", deadline: pointer.Int64(600), startTime: &startTime, elapsed: 11 * time.Minute, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				Spec:   corev1.PodSpec{ActiveDeadlineSeconds: tt.deadline},
+				Status: corev1.PodStatus{StartTime: tt.startTime},
+			}
+
+			if got := podhandler.DeadlineExceeded(pod, startTime.Add(tt.elapsed)); got != tt.want {
+				t.Errorf("DeadlineExceeded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      corev1.ContainerState
+		running    int
+		pending    int
+		failed     int
+		successful int
+	}{
+		{
+			name:    "queued",
+			state:   corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "InSlurmQueue"}},
+			pending: 1,
+		},
+		{
+			name:    "back-off",
+			state:   corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: podhandler.ReasonCrashLoopBackOff}},
+			running: 1,
+		},
+		{
+			name:    "running",
+			state:   corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			running: 1,
+		},
+		{
+			name:   "failed",
+			state:  corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}},
+			failed: 1,
+		},
+		{
+			name:       "completed",
+			state:      corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+			successful: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state podhandler.Classifier
+			state.Reset()
+
+			state.Classify("main", &corev1.ContainerStatus{Name: "main", State: tt.state})
+
+			if state.NumRunningJobs() != tt.running || state.NumPendingJobs() != tt.pending ||
+				state.NumFailedJobs() != tt.failed || state.NumSuccessfulJobs() != tt.successful {
+				t.Errorf("unexpected classification: %s", state.NumAll())
+			}
+		})
+	}
+}
@@ -22,10 +22,15 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/carv-ics-forth/hpk/compute"
 	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/compute/image"
+	"github.com/carv-ics-forth/hpk/compute/pause"
+	"github.com/carv-ics-forth/hpk/compute/runtime"
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
 	"github.com/carv-ics-forth/hpk/compute/slurm"
 	"github.com/carv-ics-forth/hpk/pkg/filenotify"
 	"github.com/carv-ics-forth/hpk/pkg/resources"
@@ -39,8 +44,24 @@ import (
 const (
 	CustomSlurmFlags = "slurm.hpk.io/flags"
 	DefaultSlurmType = "slurm.hpk.io/type"
+	SlurmNodes       = "slurm.hpk.io/nodes"
 )
 
+// RequestedNodes returns the number of Slurm nodes that the pod spans, as given by the 'slurm.hpk.io/nodes' annotation.
+func RequestedNodes(pod *corev1.Pod) (int, error) {
+	raw, exists := pod.GetAnnotations()[SlurmNodes]
+	if !exists {
+		return 1, nil
+	}
+
+	nodes, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || nodes < 1 {
+		return 0, errors.Errorf("invalid value '%s' for annotation '%s'. expected a positive integer", raw, SlurmNodes)
+	}
+
+	return nodes, nil
+}
+
 // LoadPodFromKey waits LoadPodFromFile with filePath discovery.
 func LoadPodFromKey(podRef client.ObjectKey) (*corev1.Pod, error) {
 	filePath := compute.HPK.Pod(podRef).EncodedJSONPath()
@@ -72,6 +93,27 @@ func LoadPodFromFile(filePath string) (*corev1.Pod, error) {
 	return &pod, nil
 }
 
+// LoadPods returns all the pods that have a valid description on the local filesystem.
+func LoadPods() ([]*corev1.Pod, error) {
+	var pods []*corev1.Pod
+
+	if err := compute.HPK.WalkPodDirectories(func(path endpoint.PodPath) error {
+		pod, err := LoadPodFromFile(path.EncodedJSONPath())
+		if err != nil {
+			// the pod may be in the middle of creation or deletion.
+			return nil
+		}
+
+		pods = append(pods, pod)
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to traverse pods")
+	}
+
+	return pods, nil
+}
+
 func SavePodToFile(_ context.Context, pod *corev1.Pod) error {
 	
 	if pod == nil {
@@ -122,7 +164,7 @@ func DeletePod(podKey client.ObjectKey, watcher filenotify.FileWatcher) bool {
 	if slurm.HasJobID(localPod) {
 		jodID := slurm.GetJobID(localPod)
 
-		out, err := slurm.CancelJob(jodID)
+		out, err := scheduler.Default.Cancel(jodID)
 		if err != nil {
 			if errors.Is(err, slurm.ErrInvalidJob) {
 				logger.Info(" * No such Slurm job", "job", jodID, "pod", podKey)
@@ -191,6 +233,15 @@ type PodHandler struct {
 	podEnvVariables []corev1.EnvVar
 	podDirectory    endpoint.PodPath
 
+	// interactive is the container that runs on the terminal of the pod. Empty for batch pods.
+	interactive string
+
+	// containerRuntime runs the init and main containers of the pod.
+	containerRuntime runtime.ContainerRuntime
+
+	// gpu is true if the pod requests any of the extended resources that are mapped to Slurm GPUs.
+	gpu bool
+
 	logger logr.Logger
 }
 
@@ -267,7 +318,40 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 	/*---------------------------------------------------
 	 * Build Container Commands
 	 *---------------------------------------------------*/
-	var initContainers []Container
+	nodes, err := RequestedNodes(h.Pod)
+	if err != nil {
+		compute.PodError(pod, compute.ReasonSpecError, err.Error())
+
+		return
+	}
+
+	h.interactive = h.interactiveContainer(nodes)
+
+	h.containerRuntime, err = runtime.ForPod(h.Pod)
+	if err != nil {
+		compute.PodError(pod, compute.ReasonSpecError, err.Error())
+
+		return
+	}
+
+	resourceRequest := resources.NewResourceList()
+
+	// set per-container limitations
+	// TODO: add the pod limit's
+	for _, initContainer := range pod.Spec.InitContainers {
+		resources.Sum(resourceRequest, initContainer.Resources.Requests)
+	}
+
+	for _, container := range pod.Spec.Containers {
+		resources.Sum(resourceRequest, container.Resources.Requests)
+	}
+
+	resourceRequestList := resources.ResourceListToStruct(resourceRequest)
+
+	// init and main containers run with the same runtime, and all of them see the gpus of the pod.
+	h.gpu = slurm.RequestsGPU(resourceRequestList.Extended)
+
+	var initContainers []pause.Container
 	pod.Status.InitContainerStatuses = make([]corev1.ContainerStatus, len(pod.Spec.InitContainers))
 
 	for i := range pod.Spec.InitContainers {
@@ -284,7 +368,7 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 		initContainers = append(initContainers, c)
 	}
 
-	var containers []Container
+	var containers []pause.Container
 	pod.Status.ContainerStatuses = make([]corev1.ContainerStatus, len(pod.Spec.Containers))
 
 	for i := range pod.Spec.Containers {
@@ -304,18 +388,6 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 	/*---------------------------------------------------
 	 * Handle Cgroups and Resource Reservation
 	 *---------------------------------------------------*/
-	resourceRequest := resources.NewResourceList()
-
-	// set per-container limitations
-	// TODO: add the pod limit's
-	for _, initContainer := range pod.Spec.InitContainers {
-		resources.Sum(resourceRequest, initContainer.Resources.Requests)
-	}
-
-	for _, container := range pod.Spec.Containers {
-		resources.Sum(resourceRequest, container.Resources.Requests)
-	}
-
 	// create cgroups for the pod
 	if compute.Environment.EnableCgroupV2 {
 		if _, err := os.Create(h.podDirectory.CgroupFilePath()); err != nil {
@@ -379,13 +451,78 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 
 	logger.Info(" * Default Slurm Type has been set", "defaultFlag", totalFlags)
 
+	resourceFlags, unmapped := slurm.ResourceFlags(resourceRequestList.Extended)
+	if len(unmapped) > 0 {
+		logger.Info("Ignore extended resources without a Slurm mapping", "resources", unmapped)
+	}
+
+	totalFlags = append(totalFlags, resourceFlags...)
+
+	// the policy may still override the requeue behavior, since sbatch honors the last flag.
+	totalFlags = append(totalFlags, slurm.RequeueFlag(h.Pod))
+
+	var customFlags []string
+
 	if customflags, hasFlags := h.Pod.GetAnnotations()[CustomSlurmFlags]; hasFlags {
-		totalFlags = append(totalFlags, strings.Split(customflags, " ")...)
+		customFlags = strings.Split(customflags, " ")
+	}
+
+	var namespace corev1.Namespace
+
+	if err := compute.K8SClient.Get(ctx, client.ObjectKey{Name: pod.GetNamespace()}, &namespace); err != nil {
+		/*-- only this pod is failed, as with the jobs rejected by Slurm --*/
+		logger.Info(" * Cannot get the namespace of pod", "namespace", pod.GetNamespace(), "err", err.Error())
+
+		compute.PodError(pod, compute.ReasonObjectNotFound, "cannot get namespace '%s' for the Slurm policy: %s", pod.GetNamespace(), err)
+		compute.EventRecorder.Event(pod, corev1.EventTypeWarning, compute.ReasonObjectNotFound, pod.Status.Message)
+
+		return
+	}
+
+	totalFlags = SlurmPolicyFlags(logger, &namespace, h.Pod, compute.Environment.AllowedPodOverrides, totalFlags, customFlags)
+
+	// pods scheduled on a per-partition node must run on that partition, regardless of any other policy.
+	if partition, exists := compute.Environment.NodePartitions[pod.Spec.NodeName]; exists {
+		totalFlags = append(totalFlags, "--partition="+partition)
+	}
+
+	dependencies, err := ParseDependencies(h.Pod)
+	if err != nil {
+		compute.PodError(pod, compute.ReasonSpecError, err.Error())
+
+		return
 	}
 
+	if len(dependencies) > 0 {
+		// defer the submission until the referenced pods have been submitted.
+		dependencyFlag, err := h.resolveDependencies(ctx, dependencies)
+		switch {
+		case errors.Is(err, errPodDeleted), errors.Is(err, context.Canceled):
+			logger.Info("Abort pod creation", "reason", err.Error())
+
+			return
+		case errors.Is(err, ErrDependencyNeverSatisfied):
+			compute.PodError(pod, compute.ReasonDependencyNeverSatisfied, err.Error())
+
+			return
+		case err != nil:
+			compute.PodError(pod, compute.ReasonDependencyNeverSatisfied, "cannot resolve the dependencies of pod: %s", err)
+
+			return
+		}
+
+		if dependencyFlag != "" {
+			totalFlags = append(totalFlags, dependencyFlag)
+		}
+
+		logger.Info(" * Dependencies have been resolved", "dependency", dependencyFlag)
+	}
+
+	logger.Info(" * Slurm policy has been applied", "flags", totalFlags)
+
 	scriptTemplate, err := ParseTemplate(HostScriptTemplate)
 	if err != nil {
-		compute.SystemPanic(err, "sbatch template error", "template", HostScriptTemplate)
+		compute.SystemPanic(err, "sbatch template error. template: %s", HostScriptTemplate)
 	}
 
 	scriptFileContent := bytes.Buffer{}
@@ -397,14 +534,15 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 	// Set annotations from HostEnvironment
 	pod.Annotations["kubeMasterHost"] = compute.Environment.KubeMasterHost
 	pod.Annotations["containerRegistry"] = compute.Environment.ContainerRegistry
-	pod.Annotations["apptainerBin"] = compute.Environment.ApptainerBin
+	pod.Annotations["podmanBin"] = compute.Environment.PodmanBin
+	pod.Annotations["containerRuntime"] = h.containerRuntime.Name()
 	pod.Annotations["enableCgroupV2"] = fmt.Sprintf("%t", compute.Environment.EnableCgroupV2)
 	pod.Annotations["workingDirectory"] = compute.Environment.WorkingDirectory
 	pod.Annotations["kubeDNS"] = compute.Environment.KubeDNS
 
 	// Set annotations from VirtualEnvironment
 	pod.Annotations["cgroupFilePath"] = h.podDirectory.CgroupFilePath()
-	pod.Annotations["constructorFilePath"] = h.podDirectory.ConstructorFilePath()
+	pod.Annotations["pauseSpecPath"] = h.podDirectory.PauseSpecPath()
 	pod.Annotations["ipAddressPath"] = h.podDirectory.IPAddressPath()
 	pod.Annotations["stdoutPath"] = h.podDirectory.StdoutPath()
 	pod.Annotations["stderrPath"] = h.podDirectory.StderrPath()
@@ -412,22 +550,42 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 
 	pod.Annotations["PauseImage"] = image.PauseImage
 
+	/*---------------------------------------------------
+	 * Prepare the Spec for hpk-pause
+	 *---------------------------------------------------*/
+	pauseSpec := pause.Spec{
+		Pod:              h.Pod,
+		Runtime:          h.containerRuntime.Name(),
+		PodmanBin:        compute.Environment.PodmanBin,
+		KubeDNS:          compute.Environment.KubeDNS,
+		ScratchDir:       pause.ScratchDir,
+		IPAddressPath:    h.podDirectory.IPAddressPath(),
+		SysErrorFilePath: h.podDirectory.SysErrorFilePath(),
+		InitContainers:   initContainers,
+		Containers:       containers,
+	}
+
+	if err := pauseSpec.Write(h.podDirectory.PauseSpecPath()); err != nil {
+		compute.SystemPanic(err, "unable to write the spec of hpk-pause")
+	}
+
 	if err := scriptTemplate.Execute(&scriptFileContent, JobFields{
 		Pod:                h.podKey,
 		HostEnv:            compute.Environment,
 		VirtualEnv: compute.VirtualEnvironment{
-			PodDirectory:        h.podDirectory.String(),
-			CgroupFilePath:      h.podDirectory.CgroupFilePath(),
-			ConstructorFilePath: h.podDirectory.ConstructorFilePath(),
-			IPAddressPath:       h.podDirectory.IPAddressPath(),
-			StdoutPath:          h.podDirectory.StdoutPath(),
-			StderrPath:          h.podDirectory.StderrPath(),
-			SysErrorFilePath:    h.podDirectory.SysErrorFilePath(),
+			PodDirectory:     h.podDirectory.String(),
+			CgroupFilePath:   h.podDirectory.CgroupFilePath(),
+			PauseSpecPath:    h.podDirectory.PauseSpecPath(),
+			IPAddressPath:    h.podDirectory.IPAddressPath(),
+			StdoutPath:       h.podDirectory.StdoutPath(),
+			StderrPath:       h.podDirectory.StderrPath(),
+			SysErrorFilePath: h.podDirectory.SysErrorFilePath(),
 		},
-		InitContainers:  initContainers,
-		Containers:      containers,
-		ResourceRequest: resources.ResourceListToStruct(resourceRequest),
+		ResourceRequest: resourceRequestList,
+		GPU:             h.gpu,
 		CustomFlags:     totalFlags,
+		Nodes:           nodes,
+		Interactive:     h.interactive != "",
 	}); err != nil {
 		/*-- since both the template and fields are internal to the code, the evaluation should always succeed	--*/
 		compute.SystemPanic(err, "failed to evaluate sbatch template")
@@ -446,16 +604,23 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 	 *---------------------------------------------------*/
 	logger.Info("Script file path: ", "scriptFilePath", scriptFilePath)
 
-	jobID, err := slurm.SubmitJob(scriptFilePath)
+	jobID, err := h.submitJob(scriptFilePath)
 	if err != nil {
-		compute.SystemPanic(err, "failed to submit job")
-		//[TODO:] update pod status with insufficient resources
+		/*-- a rejected job only fails its own pod --*/
+		reason := slurm.SubmitFailureReason(err)
+
+		logger.Info(" * Slurm has rejected the job", "reason", reason, "err", err.Error())
+
+		compute.PodError(pod, reason, "Slurm has rejected the job: %s", err)
+		compute.EventRecorder.Event(pod, corev1.EventTypeWarning, reason, pod.Status.Message)
+
+		return
 	}
 
 	logger.Info(" * Slurm job has been submitted", "jobID", jobID)
 
 	// update pod with the slurm's job id
-	slurm.SetPodID(h.Pod, slurm.JobIDTypeSlurm, jobID)
+	slurm.SetPodID(h.Pod, scheduler.Default.IDType(), jobID)
 	if err != nil {
 		compute.SystemPanic(err, "failed to set job id for pod")
 	}
@@ -0,0 +1,189 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+/************************************************************
+
+			Per-Namespace Slurm Policy
+
+************************************************************/
+
+// Slurm options that can be set on a namespace (annotations or labels), and overridden by its pods (annotations).
+const (
+	SlurmAccount     = "slurm.hpk.io/account"
+	SlurmPartition   = "slurm.hpk.io/partition"
+	SlurmQOS         = "slurm.hpk.io/qos"
+	SlurmReservation = "slurm.hpk.io/reservation"
+	SlurmTimeLimit   = "slurm.hpk.io/time-limit"
+)
+
+// policyOption maps a policy key to the sbatch flag that it controls.
+type policyOption struct {
+	Key string
+
+	// Name is the short name used in the allowlist of pod overrides (e.g, "account").
+	Name string
+
+	// Flags are the long and the short forms of the sbatch flag.
+	Flags []string
+}
+
+// policyOptions are listed in the order that they are emitted.
+var policyOptions = []policyOption{
+	{Key: SlurmAccount, Name: "account", Flags: []string{"--account", "-A"}},
+	{Key: SlurmPartition, Name: "partition", Flags: []string{"--partition", "-p"}},
+	{Key: SlurmQOS, Name: "qos", Flags: []string{"--qos", "-q"}},
+	{Key: SlurmReservation, Name: "reservation", Flags: []string{"--reservation"}},
+	{Key: SlurmTimeLimit, Name: "time-limit", Flags: []string{"--time", "-t"}},
+}
+
+// shorterTimeLimit returns the shorter of the time limit and the active deadline of the pod.
+// Time limits that cannot be parsed (e.g, "UNLIMITED") yield to the deadline.
+func shorterTimeLimit(logger logr.Logger, limit string, deadline time.Duration) string {
+	parsed, err := slurm.ParseTimeLimit(limit)
+	if err != nil {
+		logger.Info("Ignore time limit that cannot be compared with the active deadline", "limit", limit, "err", err.Error())
+
+		return slurm.FormatTimeLimit(deadline)
+	}
+
+	if parsed < deadline {
+		return limit
+	}
+
+	return slurm.FormatTimeLimit(deadline)
+}
+
+// PolicyOverrideNames lists the names of all the options that pods can override.
+func PolicyOverrideNames() []string {
+	names := make([]string, 0, len(policyOptions))
+
+	for _, option := range policyOptions {
+		names = append(names, option.Name)
+	}
+
+	return names
+}
+
+// SlurmPolicyFlags resolves the policy options of the pod, and merges them with the rest of the flags.
+//
+// The flags are merged in the following order, with the later ones taking precedence in sbatch:
+//  1. defaultFlags (e.g, from 'slurm.hpk.io/type')
+//  2. namespace annotations, or namespace labels if no annotation is set
+//  3. pod.Spec.ActiveDeadlineSeconds, for the time limit, and the priority mapping of the pod, for the qos
+//  4. pod annotations, if the option is in the allowedOverrides. The time limit never exceeds the active deadline.
+//  5. the nice value from the priority mapping of the pod
+//  6. customFlags (from 'slurm.hpk.io/flags'), with any policy option not in the allowedOverrides removed
+func SlurmPolicyFlags(logger logr.Logger, namespace *corev1.Namespace, pod *corev1.Pod,
+	allowedOverrides []string, defaultFlags []string, customFlags []string,
+) []string {
+	allowed := make(map[string]bool, len(allowedOverrides))
+	for _, name := range allowedOverrides {
+		allowed[strings.TrimSpace(name)] = true
+	}
+
+	flags := append([]string{}, defaultFlags...)
+
+	priority, _ := slurm.PriorityOf(pod)
+
+	for _, option := range policyOptions {
+		var value string
+
+		if namespace != nil {
+			if v, exists := namespace.GetLabels()[option.Key]; exists {
+				value = v
+			}
+
+			if v, exists := namespace.GetAnnotations()[option.Key]; exists {
+				value = v
+			}
+		}
+
+		// the deadline of the pod is the native way to set its time limit.
+		if option.Key == SlurmTimeLimit && pod.Spec.ActiveDeadlineSeconds != nil {
+			value = slurm.FormatTimeLimit(time.Duration(*pod.Spec.ActiveDeadlineSeconds) * time.Second)
+		}
+
+		// the priority of the pod is the native way to set its qos.
+		if option.Key == SlurmQOS && priority.QOS != "" {
+			value = priority.QOS
+		}
+
+		if v, exists := pod.GetAnnotations()[option.Key]; exists {
+			if allowed[option.Name] {
+				value = v
+
+				// the override may only shorten the deadline of the pod.
+				if option.Key == SlurmTimeLimit && pod.Spec.ActiveDeadlineSeconds != nil {
+					value = shorterTimeLimit(logger, v, time.Duration(*pod.Spec.ActiveDeadlineSeconds)*time.Second)
+				}
+			} else {
+				logger.Info("Ignore pod override that is not allowed by the administrator", "option", option.Key)
+			}
+		}
+
+		if value != "" {
+			flags = append(flags, option.Flags[0]+"="+value)
+		}
+	}
+
+	if priority.Nice != nil {
+		flags = append(flags, "--nice="+strconv.Itoa(*priority.Nice))
+	}
+
+	for i := 0; i < len(customFlags); i++ {
+		flag := customFlags[i]
+
+		if option, isPolicy := policyOptionOf(flag); isPolicy && !allowed[option.Name] {
+			logger.Info("Ignore custom flag that is not allowed by the administrator", "flag", flag)
+
+			// the value is given as a separate token (e.g, "--account myaccount").
+			if slices.Contains(option.Flags, flag) && i+1 < len(customFlags) {
+				i++
+			}
+
+			continue
+		}
+
+		flags = append(flags, flag)
+	}
+
+	return flags
+}
+
+// policyOptionOf returns the policy option that is controlled by the flag, if any.
+func policyOptionOf(flag string) (policyOption, bool) {
+	for _, option := range policyOptions {
+		for _, form := range option.Flags {
+			if flag == form || strings.HasPrefix(flag, form+"=") ||
+				(!strings.HasPrefix(form, "--") && strings.HasPrefix(flag, form)) {
+				return option, true
+			}
+		}
+	}
+
+	return policyOption{}, false
+}
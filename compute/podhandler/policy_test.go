@@ -0,0 +1,145 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/carv-ics-forth/hpk/compute/podhandler"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestSlurmPolicyFlags(t *testing.T) {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "team-a",
+			Labels: map[string]string{
+				podhandler.SlurmAccount:   "label-account",
+				podhandler.SlurmPartition: "cpu",
+			},
+			Annotations: map[string]string{
+				podhandler.SlurmAccount:   "proj-a",
+				podhandler.SlurmTimeLimit: "01:00:00",
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		deadline     *int64
+		priority     string
+		allowed      []string
+		defaultFlags []string
+		customFlags  []string
+		want         []string
+	}{
+		{
+			name:    "namespace defaults",
+			allowed: podhandler.PolicyOverrideNames(),
+			want:    []string{"--account=proj-a", "--partition=cpu", "--time=01:00:00"},
+		},
+		{
+			name:         "merge order",
+			annotations:  map[string]string{podhandler.SlurmPartition: "gpu", podhandler.SlurmQOS: "high"},
+			allowed:      podhandler.PolicyOverrideNames(),
+			defaultFlags: []string{"--constraint=fast"},
+			customFlags:  []string{"--exclusive"},
+			want:         []string{"--constraint=fast", "--account=proj-a", "--partition=gpu", "--qos=high", "--time=01:00:00", "--exclusive"},
+		},
+		{
+			name:     "active deadline",
+			deadline: pointer.Int64(90061),
+			allowed:  podhandler.PolicyOverrideNames(),
+			want:     []string{"--account=proj-a", "--partition=cpu", "--time=1-01:01:01"},
+		},
+		{
+			name:        "active deadline with shorter time limit override",
+			annotations: map[string]string{podhandler.SlurmTimeLimit: "00:10:00"},
+			deadline:    pointer.Int64(3600),
+			allowed:     podhandler.PolicyOverrideNames(),
+			want:        []string{"--account=proj-a", "--partition=cpu", "--time=00:10:00"},
+		},
+		{
+			name:        "active deadline with longer time limit override",
+			annotations: map[string]string{podhandler.SlurmTimeLimit: "2-00:00:00"},
+			deadline:    pointer.Int64(3600),
+			allowed:     podhandler.PolicyOverrideNames(),
+			want:        []string{"--account=proj-a", "--partition=cpu", "--time=0-01:00:00"},
+		},
+		{
+			name:        "active deadline with unlimited time limit override",
+			annotations: map[string]string{podhandler.SlurmTimeLimit: "UNLIMITED"},
+			deadline:    pointer.Int64(3600),
+			allowed:     podhandler.PolicyOverrideNames(),
+			want:        []string{"--account=proj-a", "--partition=cpu", "--time=0-01:00:00"},
+		},
+		{
+			name:        "disallowed overrides",
+			annotations: map[string]string{podhandler.SlurmAccount: "proj-b", podhandler.SlurmPartition: "gpu"},
+			allowed:     []string{"partition"},
+			customFlags: []string{"--account", "proj-b", "-Aproj-c", "--account=proj-d", "--exclusive", "-pdebug"},
+			want:        []string{"--account=proj-a", "--partition=gpu", "--time=01:00:00", "--exclusive", "-pdebug"},
+		},
+		{
+			name:     "priority mapping",
+			priority: "urgent",
+			allowed:  podhandler.PolicyOverrideNames(),
+			want:     []string{"--account=proj-a", "--partition=cpu", "--qos=inference", "--time=01:00:00", "--nice=-100"},
+		},
+		{
+			name:        "priority mapping with qos override",
+			annotations: map[string]string{podhandler.SlurmQOS: "debug"},
+			priority:    "urgent",
+			allowed:     podhandler.PolicyOverrideNames(),
+			want:        []string{"--account=proj-a", "--partition=cpu", "--qos=debug", "--time=01:00:00", "--nice=-100"},
+		},
+		{
+			name:     "priority mapping with nice only",
+			priority: "background",
+			allowed:  podhandler.PolicyOverrideNames(),
+			want:     []string{"--account=proj-a", "--partition=cpu", "--time=01:00:00", "--nice=10000"},
+		},
+	}
+
+	mappings, err := slurm.ParsePriorityMappings([]string{"urgent=inference:-100", "background=:10000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := slurm.Slurm.PriorityMappings
+	slurm.Slurm.PriorityMappings = mappings
+
+	t.Cleanup(func() { slurm.Slurm.PriorityMappings = previous })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "pod", Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{ActiveDeadlineSeconds: tt.deadline, PriorityClassName: tt.priority},
+			}
+
+			got := podhandler.SlurmPolicyFlags(logr.Discard(), namespace, pod, tt.allowed, tt.defaultFlags, tt.customFlags)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SlurmPolicyFlags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/pause"
+	"github.com/carv-ics-forth/hpk/compute/runtime"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// GRPCHealthProbe is the client that runs the grpc probes. It must be in the PATH of the compute nodes.
+// https://github.com/grpc-ecosystem/grpc-health-probe
+const GRPCHealthProbe = "grpc_health_probe"
+
+// probeSpec translates a probe of the container into the probe that the pause runs, on the node of the container.
+// It returns nil if the container has no such probe.
+func probeSpec(rt runtime.ContainerRuntime, spec runtime.Container, container *corev1.Container, probe *corev1.Probe) (*pause.Probe, error) {
+	if probe == nil {
+		return nil, nil
+	}
+
+	seconds := func(s int32) time.Duration {
+		return time.Duration(s) * time.Second
+	}
+
+	p := &pause.Probe{
+		InitialDelay:     seconds(probe.InitialDelaySeconds),
+		Period:           seconds(probe.PeriodSeconds),
+		Timeout:          seconds(probe.TimeoutSeconds),
+		SuccessThreshold: probe.SuccessThreshold,
+		FailureThreshold: probe.FailureThreshold,
+	}
+
+	switch {
+	case probe.Exec != nil:
+		p.Command = rt.Exec(spec, probe.Exec.Command)
+
+	case probe.HTTPGet != nil:
+		url, err := httpGetURL(probe.HTTPGet, container)
+		if err != nil {
+			return nil, err
+		}
+
+		p.URL = url
+		p.HTTPHeaders = probe.HTTPGet.HTTPHeaders
+
+	case probe.TCPSocket != nil:
+		// containers use the network of the host.
+		host := probe.TCPSocket.Host
+		if host == "" {
+			host = "127.0.0.1"
+		}
+
+		port, err := resolvePort(probe.TCPSocket.Port, container)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Address = net.JoinHostPort(host, strconv.Itoa(port))
+
+	case probe.GRPC != nil:
+		p.Command = []string{GRPCHealthProbe, "-addr=" + net.JoinHostPort("127.0.0.1", strconv.Itoa(int(probe.GRPC.Port)))}
+
+		if probe.GRPC.Service != nil && *probe.GRPC.Service != "" {
+			p.Command = append(p.Command, "-service="+*probe.GRPC.Service)
+		}
+
+	default:
+		return nil, errors.Errorf("unsupported probe handler")
+	}
+
+	return p, nil
+}
+
+// probeResults returns whether the container has started and is ready, as reported by its probes.
+// Containers without a startup probe have started once they run, and containers without a readiness probe
+// are ready once they have started.
+func probeResults(container *corev1.Container, startedPath string, readyPath string) (started bool, ready bool) {
+	started = true
+
+	if container != nil && container.StartupProbe != nil {
+		result, _ := readStringFromFile(startedPath)
+		started = result == "true"
+	}
+
+	ready = started
+
+	if started && container != nil && container.ReadinessProbe != nil {
+		result, _ := readStringFromFile(readyPath)
+		ready = result == "true"
+	}
+
+	return started, ready
+}
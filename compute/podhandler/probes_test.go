@@ -0,0 +1,179 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/pause"
+	"github.com/carv-ics-forth/hpk/compute/runtime"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+)
+
+func Test_probeSpec(t *testing.T) {
+	container := &corev1.Container{
+		Name:  "main",
+		Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+	}
+
+	tests := []struct {
+		name    string
+		probe   *corev1.Probe
+		want    *pause.Probe
+		wantErr bool
+	}{
+		{
+			name: "no probe",
+		},
+		{
+			name: "exec",
+			probe: &corev1.Probe{
+				ProbeHandler:     corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"cat", "/tmp/healthy"}}},
+				PeriodSeconds:    5,
+				FailureThreshold: 2,
+			},
+			want: &pause.Probe{
+				Command:          []string{"podman-hpc", "exec", "ns_pod_main", "cat", "/tmp/healthy"},
+				Period:           5 * time.Second,
+				FailureThreshold: 2,
+			},
+		},
+		{
+			name: "http with named port",
+			probe: &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+					Path:        "healthz",
+					Port:        intstr.FromString("http"),
+					HTTPHeaders: []corev1.HTTPHeader{{Name: "X-Probe", Value: "hpk"}},
+				}},
+				InitialDelaySeconds: 3,
+				TimeoutSeconds:      2,
+			},
+			want: &pause.Probe{
+				URL:          "http://127.0.0.1:8080/healthz",
+				HTTPHeaders:  []corev1.HTTPHeader{{Name: "X-Probe", Value: "hpk"}},
+				InitialDelay: 3 * time.Second,
+				Timeout:      2 * time.Second,
+			},
+		},
+		{
+			name:  "tcp socket",
+			probe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(5432)}}},
+			want:  &pause.Probe{Address: "127.0.0.1:5432"},
+		},
+		{
+			name: "grpc with service",
+			probe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{GRPC: &corev1.GRPCAction{
+				Port:    9090,
+				Service: pointer.String("liveness"),
+			}}},
+			want: &pause.Probe{Command: []string{GRPCHealthProbe, "-addr=127.0.0.1:9090", "-service=liveness"}},
+		},
+		{
+			name:    "unknown port",
+			probe:   &corev1.Probe{ProbeHandler: corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("db")}}},
+			wantErr: true,
+		},
+		{
+			name:    "no handler",
+			probe:   &corev1.Probe{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := probeSpec(runtime.PodmanHPC{}, runtime.Container{Name: "ns_pod_main"}, container, tt.probe)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("probeSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("probeSpec() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_probeResults(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		return path
+	}
+
+	probe := &corev1.Probe{}
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name        string
+		container   *corev1.Container
+		startedPath string
+		readyPath   string
+		wantStarted bool
+		wantReady   bool
+	}{
+		{
+			name:        "no probes",
+			container:   &corev1.Container{},
+			startedPath: missing,
+			readyPath:   missing,
+			wantStarted: true,
+			wantReady:   true,
+		},
+		{
+			name:        "not yet started",
+			container:   &corev1.Container{StartupProbe: probe, ReadinessProbe: probe},
+			startedPath: missing,
+			readyPath:   write("ready", "true"),
+		},
+		{
+			name:        "started but not ready",
+			container:   &corev1.Container{StartupProbe: probe, ReadinessProbe: probe},
+			startedPath: write("started", "true"),
+			readyPath:   write("unready", "false"),
+			wantStarted: true,
+		},
+		{
+			name:        "ready",
+			container:   &corev1.Container{ReadinessProbe: probe},
+			startedPath: missing,
+			readyPath:   write("ready", "true"),
+			wantStarted: true,
+			wantReady:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started, ready := probeResults(tt.container, tt.startedPath, tt.readyPath)
+			if started != tt.wantStarted || ready != tt.wantReady {
+				t.Errorf("probeResults() = (%t, %t), want (%t, %t)", started, ready, tt.wantStarted, tt.wantReady)
+			}
+		})
+	}
+}
@@ -69,214 +69,13 @@ func strval(v interface{}) string {
 }
 
 /*
-	PauseScriptTemplate provides the template for building pods.
+	HostScriptTemplate provides the sbatch script for building pods.
 
 Remarks:
 
-	--userns is need to maintain the user's permissions.
-	--pid is not needed in order for different containers in the same pod to share the same pid space
+	The script only prepares the host environment, and then runs hpk-pause, which runs the containers
+	of the pod. See pause.Supervisor.
 */
-const PauseScriptTemplate = `#!/bin/bash
-
-############################
-# Auto-Generated Script    #
-# Please do not edit it. 	   #
-############################
-
-set -eum pipeline
-
-function debug_info() {
-	echo -e "\n"
-	echo "=============================="
-	echo " Compute Environment Info"
-	echo "=============================="
-	echo "* DNS: {{.HostEnv.KubeDNS}}"
-	echo "* PodDir: {{.VirtualEnv.PodDirectory}}"
-	echo "=============================="
-	echo -e "\n"
-	echo "=============================="
-	echo " Virtual Environment Info"
-	echo "=============================="
-	echo "* Host: $(hostname)"
-	echo "* IP: $(hostname -I)"
-	echo "* User: $(id)"
-	echo "=============================="
-	echo -e "\n"
-}
-
-handle_dns() {
-	mkdir -p /tmp/scratch/etc
-	
-# Rewire /scratch/etc/resolv.conf to point to KubeDNS
-cat > /tmp/scratch/etc/resolv.conf << DNS_EOF
-search {{.Pod.Namespace}}.svc.cluster.local svc.cluster.local cluster.local
-nameserver {{.HostEnv.KubeDNS}}
-options ndots:5
-DNS_EOF
-	
-	# Add hostname to known hosts. Required for loopback
-	echo -e "127.0.0.1 localhost" >> /tmp/scratch/etc/hosts
-	echo -e "$(hostname -I | tr ' ' '\n' | grep '^128' | head -n 1) $(hostname)" >> /tmp/scratch/etc/hosts
-}
-
-# If not removed, Flags will be consumed by the nested Singularity and overwrite paths.
-# https://docs.sylabs.io/guides/3.11/user-guide/environment_and_metadata.html
-function reset_env() {
-	unset LD_LIBRARY_PATH
-
-	unset SINGULARITY_COMMAND
-	unset SINGULARITY_CONTAINER
-	unset SINGULARITY_ENVIRONMENT
-	unset SINGULARITY_NAME
-
-	unset APPTAINER_APPNAME
-	unset APPTAINER_COMMAND
-	unset APPTAINER_CONTAINER
-	unset APPTAINER_ENVIRONMENT
-	unset APPTAINER_NAME
-
-	unset APPTAINER_BIND
-	unset SINGULARITY_BIND
-}
-
-function cleanup() {
-	lastCommand=$1
-	exitCode=$2
-
-	echo "[Virtual] Ensure all background jobs are terminated".
-	wait
-
-	if [[ $exitCode -eq 0 ]]; then
-		echo "[Virtual] Gracefully exit the Virtual Environment. All resources will be released."
-	else
-		echo "[Virtual] **SYSTEMERROR** ${lastCommand} command filed with exit code ${exitCode}" | tee {{.VirtualEnv.SysErrorFilePath}}
-	fi
-
-	exit ${exitCode}
-}
-
-function handle_init_containers() {
-{{range $index, $container := .InitContainers}}
-	####################
-	##  New Container  #
-	####################
-
-	echo "[Virtual] Spawning InitContainer: {{$container.InstanceName}}"
-	 
-	{{- if $container.EnvFilePath}}
-	sh -c {{$container.EnvFilePath}} > /tmp/scratch/{{$container.InstanceName}}.env
-	{{- end}}
-
-	# Mark the beginning of an init job (all get the shell's pid).  
-	echo pid://$$ > {{$container.JobIDPath}}
-
-
-	$(apptainer {{ $container.ExecutionMode }} --cleanenv --writable-tmpfs --no-mount home --unsquash \
-	{{- if $container.RunAsUser}}
-	--security uid:{{$container.RunAsUser}},gid:{{$container.RunAsUser}} --userns \
-	{{- end}}
-	{{- if $container.RunAsGroup}}
-	--security gid:{{$container.RunAsGroup}} --userns \
-	{{- end}}
-	--bind /scratch/etc/resolv.conf:/etc/resolv.conf,/scratch/etc/hosts:/etc/hosts,{{join "," $container.Binds}} \
-	{{- if $container.EnvFilePath}}
-	--env-file /scratch/{{$container.InstanceName}}.env \
-	{{- end}}
-	{{$container.ImageName}}
-	{{- if $container.Command}}
-		{{- range $index, $cmd := $container.Command}} {{$cmd | param}} {{- end}}
-	{{- end -}} 
-	{{- if $container.Args}}
-		{{range $index, $arg := $container.Args}} {{$arg | param}} {{- end}}
-	{{- end }} \
-	&>> {{$container.LogsPath}})
-
-	# Mark the ending of an init job.
-	echo $? > {{$container.ExitCodePath}}
-{{end}}
-
-	echo "[Virtual] All InitContainers have been completed."
-	return 
-}
-
-function handle_containers() {
-{{range $index, $container := .Containers}}
-	####################
-	##  New Container  # 
-	####################
-
-	{{- if $container.EnvFilePath}}
-	sh -c {{$container.EnvFilePath}} > /tmp/scratch/{{$container.InstanceName}}.env
-	{{- end}}
-
-	$(podman-hpc run --rm --gpu --network=host --no-hosts --workdir ${workdir} \
-	-e PARENT=${PPID} \
-	-e MODEL_NAME=resnet \
-	-v $HOME/.k8sfs/kubernetes:/k8s-data \
-	-v $HOME:$HOME \
-	-v $SCRATCH:$SCRATCH \
-	-v $SCRATCH/models:/models \
-	-v $SCRATCH/hpk-tmp:/tmp \
-	-v /tmp/scratch/:/scratch \
-	--hostname $SLURM_JOB_NAME \
-	{{- if $container.RunAsUser}}
-	--user {{$container.RunAsUser}} \
-	{{- end}}
-	{{- if $container.RunAsGroup}}
-	--group-add {{$container.RunAsGroup}} \
-	{{- end}}
-	-v /tmp/scratch/etc/resolv.conf:/etc/resolv.conf:ro \
-	-v /tmp/scratch/etc/hosts:/etc/hosts:ro \
-	{{- range $container.Binds}}
-	-v {{.}} \
-	{{- end}}
-	{{- if $container.EnvFilePath}}
-	--env-file /tmp/scratch/{{$container.InstanceName}}.env \
-	{{- end}}
-	{{$container.ImageName}}
-	{{- if $container.Command}}
-		{{- range $index, $cmd := $container.Command}} {{$cmd | param}} {{- end}}
-	{{- end -}} 
-	{{- if $container.Args}}
-		{{- range $index, $arg := $container.Args}} {{$arg | param}} {{- end}}
-	{{- end }} \
-	&>> {{$container.LogsPath}}; \
-	echo $? > {{$container.ExitCodePath}}) &
-	pid=$!
-	echo pid://${pid} > {{$container.JobIDPath}}
-	echo "[Virtual] Container started: {{$container.InstanceName}} ${pid}"
-{{end}}
-
-	######################
-	##  Wait Containers  #
-	######################
-
-	echo "[Virtual] ... Waiting for containers to complete ..."
-	wait  || echo "[Virtual] ... wait failed with error: $?"
-	echo "[Virtual] ... Containers terminated ..."
-}
-
-
-
-debug_info
-
-echo "[Virtual] Resetting Environment ..."
-reset_env
-
-echo "[Virtual] Announcing IP ..."
-echo $(hostname -I | tr ' ' '\n' | grep '^128' | head -n 1) > {{.VirtualEnv.IPAddressPath}}
-
-echo "[Virtual] Setting DNS ..."
-handle_dns
-
-echo "[Virtual] Setting Cleanup Handler ..."
-trap 'cleanup "${BASH_COMMAND}" "$?"'  EXIT
-
-{{if gt (len .InitContainers) 0 }} handle_init_containers {{end}}
-
-{{if gt (len .Containers) 0 }} handle_containers {{end}}
-`
-
 const HostScriptTemplate = `#!/bin/bash
 #SBATCH --job-name={{.Pod.Name}}
 #SBATCH --output={{.VirtualEnv.StdoutPath}}
@@ -297,15 +96,9 @@ const HostScriptTemplate = `#!/bin/bash
 #SBATCH --mem={{.ResourceRequest.Memory}} 
 {{end}} 
 
-#### BEGIN SECTION: VirtualEnvironment Builder ####
-# Description
-# 	Builds a script for running a Virtual Environment
-# 	that resembles the semantics of a Pause Environment.
-cat > {{.VirtualEnv.ConstructorFilePath}} << 'PAUSE_EOF'
-` + PauseScriptTemplate + `
-PAUSE_EOF
-#### END SECTION: VirtualEnvironment Builder ####
-
+{{- if gt .Nodes 1}}
+#SBATCH --nodes={{.Nodes}}
+{{end}}
 
 #### BEGIN SECTION: Host Environment ####
 # Description
@@ -314,19 +107,49 @@ PAUSE_EOF
 # exit when any command fails
 #set -um pipeline
 set -u
+{{- if .Interactive}}
 
-echo "[Host] Starting the Constructor for the Virtual Environment ..."
-chmod +x  {{.VirtualEnv.ConstructorFilePath}}
+# Interactive pods run under 'srun --pty'. The terminal is kept on descriptors 3 and 4 for the interactive container,
+# while the rest of the output goes to the log files of the pod, as for batch jobs.
+exec 3<&0 4>&1 </dev/null >>{{.VirtualEnv.StdoutPath}} 2>>{{.VirtualEnv.StderrPath}}
+{{- end}}
 
 export workdir=/tmp/{{.Pod.Namespace}}_{{.Pod.Name}}
 echo "[Host] Creating workdir: ${workdir} "
 mkdir -p ${workdir}
 trap 'echo [HOST] Deleting workdir ${workdir}; rm -rf ${workdir}' EXIT
 
-export APPTAINERENV_KUBEDNS_IP={{.HostEnv.KubeDNS}}
+# hpk-pause runs the containers of the pod, as described by the spec. It runs as a child of this script, so that the
+# workdir is removed once it exits. The termination signals of the job are forwarded to it.
+{{if gt .Nodes 1 -}}
+# Launch hpk-pause on every node of the allocation.
+# If any of the nodes fails, the whole pod is terminated.
+srun --nodes={{.Nodes}} --ntasks={{.Nodes}} --ntasks-per-node=1 --kill-on-bad-exit=1 \
+	{{- if .ResourceRequest.CPU}}
+	--cpus-per-task={{.ResourceRequest.CPU}} \
+	{{- end}}
+	{{.HostEnv.PauseBin | param}} --spec {{.VirtualEnv.PauseSpecPath}} &
+{{- else -}}
+{{.HostEnv.PauseBin | param}} --spec {{.VirtualEnv.PauseSpecPath}} &
+{{- end}}
+
+pause=$!
+trap 'kill -TERM ${pause} 2>/dev/null' TERM INT
+
+# wait returns early whenever a signal is trapped, so it is repeated until hpk-pause has exited.
+while true; do
+	wait ${pause}
+	code=$?
+
+	kill -0 ${pause} 2>/dev/null || break
+done
+
+# hpk-pause reports its own failures. Anything else (e.g, a missing binary) is reported here.
+if [[ ${code} -ne 0 && ! -s {{.VirtualEnv.SysErrorFilePath}} ]]; then
+	echo "[HOST] **SYSTEMERROR** hpk-pause exited with code ${code}" | tee {{.VirtualEnv.SysErrorFilePath}}
+fi
 
-exec sh -ci {{.VirtualEnv.ConstructorFilePath}} ||
-echo "[HOST] **SYSTEMERROR** apptainer exited with code $?" | tee {{.VirtualEnv.SysErrorFilePath}}
+exit ${code}
 
 #### END SECTION: Host Environment ####
 `
@@ -340,55 +163,20 @@ type JobFields struct {
 
 	HostEnv compute.HostEnvironment
 
-	// InitContainers is a list of init container requests to be executed.
-	InitContainers []Container
-
-	// Containers is a list of container requests to be executed.
-	Containers []Container
-
 	// ResourceRequest are reserved resources for the job.
 	ResourceRequest resources.ResourceList
 
 	// CustomFlags are flags given by the user via 'slurm.hpk.io/flags' annotations
 	CustomFlags []string
-}
-
-// The Container creates new within the Pod and resemble the "Container" semantics.
-type Container struct {
-	// needed for apptainer start.
-	InstanceName string // instance://podName_containerName
-
-	// The UID to run the entrypoint of the container process.
-	// May also be set in PodSecurityContext.  If set in both SecurityContext and
-	// PodSecurityContext, the value specified in SecurityContext takes precedence.
-	RunAsUser int64
-
-	// The GID to run the entrypoint of the container process.
-	// May also be set in PodSecurityContext.  If set in both SecurityContext and
-	// PodSecurityContext, the value specified in SecurityContext takes precedence.
-	RunAsGroup int64
-
-	ImageName string // format: REGISTRY://image:tag
-
-	EnvFilePath string
-
-	Binds []string
-
-	Command []string
-
-	Args []string // space separated args
-
-	ExecutionMode string // exec or run
 
-	// LogsPath instructs process to write stdout and stderr into the specified path.
-	LogsPath string
+	// GPU is true if the pod requests any of the extended resources that are mapped to Slurm GPUs.
+	GPU bool
 
-	// JobIDPath points to the file where the process id of the container is stored.
-	// This is used to know when the container has started.
-	JobIDPath string
+	// Nodes is the number of Slurm nodes that the pod spans, given via 'slurm.hpk.io/nodes' annotations.
+	Nodes int
 
-	// ExitCodePath is the path where the embedded Container command will write its exit code
-	ExitCodePath string
+	// Interactive is true if the script runs on a pseudo-terminal (srun --pty), for a container with stdin and tty.
+	Interactive bool
 }
 
 // GenerateEnvTemplate is used to generate environment variables.
@@ -15,15 +15,21 @@
 package podhandler_test
 
 import (
-	"log"
+	"errors"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/carv-ics-forth/hpk/compute"
 	PodHandler "github.com/carv-ics-forth/hpk/compute/podhandler"
-	"github.com/pkg/errors"
+	"github.com/carv-ics-forth/hpk/pkg/resources"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
 )
 
 // Run with: go clean -testcache && go test ./ -v  -run TestApptainer
@@ -101,145 +107,276 @@ docker://alpine:3.7 "sh" "-c" "echo" "hello world"`,
 }
 */
 
-// Run with: go clean -testcache && go test ./ -v  -run TestScriptSyntax
-func TestConstructorSyntax(t *testing.T) {
+func TestHostScriptMultiNode(t *testing.T) {
 	podKey := types.NamespacedName{
 		Namespace: "dummy",
-		Name:      "dummier",
+		Name:      "mpi",
 	}
 
 	podDir := compute.HPK.Pod(podKey)
 
 	tests := []struct {
-		name   string
-		fields PodHandler.JobFields
+		name     string
+		nodes    int
+		expected []string
+		excluded []string
 	}{
 		{
-			name: "noenv",
-			fields: PodHandler.JobFields{
-				HostEnv: compute.HostEnvironment{
-					PodmanBin:      "podman-hpc",
-					KubeDNS:           "6.6.6.6",
-					ContainerRegistry: "none",
-				},
-				Pod: podKey,
+			name:     "single node",
+			nodes:    1,
+			expected: []string{"\nhpk-pause --spec " + podDir.PauseSpecPath() + " &"},
+			excluded: []string{"#SBATCH --nodes", "srun"},
+		},
+		{
+			name:  "multi node",
+			nodes: 4,
+			expected: []string{
+				"#SBATCH --nodes=4\n",
+				"\nsrun --nodes=4 --ntasks=4 --ntasks-per-node=1 --kill-on-bad-exit=1",
+				"--cpus-per-task=2",
+				"hpk-pause --spec " + podDir.PauseSpecPath(),
+			},
+		},
+	}
+
+	hostTpl, err := PodHandler.ParseTemplate(PodHandler.HostScriptTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var script strings.Builder
+
+			if err := hostTpl.Execute(&script, PodHandler.JobFields{
+				Pod:     podKey,
+				HostEnv: compute.HostEnvironment{PauseBin: "hpk-pause"},
 				VirtualEnv: compute.VirtualEnvironment{
-					PodDirectory:        podDir.String(),
-					CgroupFilePath:      podDir.CgroupFilePath(),
-					ConstructorFilePath: podDir.ConstructorFilePath(),
-					IPAddressPath:       podDir.IPAddressPath(),
-					StdoutPath:          podDir.StdoutPath(),
-					StderrPath:          podDir.StderrPath(),
-					SysErrorFilePath:    "",
-				},
-				InitContainers: []PodHandler.Container{
-					{
-						InstanceName:  "init0",
-						RunAsUser:     0,
-						RunAsGroup:    0,
-						ImageFilePath: "/image/path",
-						EnvFilePath:   "/env/path",
-						Binds:         nil,
-						Command:       []string{"ls"},
-						Args:          []string{"-lah"},
-						ExecutionMode: "run",
-						LogsPath:      podDir.Container("init0").LogsPath(),
-						JobIDPath:     podDir.Container("init0").IDPath(),
-						ExitCodePath:  podDir.Container("init0").ExitCodePath(),
-					},
-					{
-						InstanceName:  "init1",
-						RunAsUser:     0,
-						RunAsGroup:    0,
-						ImageFilePath: "/image/path",
-						EnvFilePath:   "/env/path",
-						Binds:         nil,
-						Command:       []string{"touch"},
-						Args:          []string{"miax"},
-						ExecutionMode: "run",
-						LogsPath:      podDir.Container("init1").LogsPath(),
-						JobIDPath:     podDir.Container("init1").IDPath(),
-						ExitCodePath:  podDir.Container("init1").ExitCodePath(),
-					},
+					PodDirectory:     podDir.String(),
+					PauseSpecPath:    podDir.PauseSpecPath(),
+					IPAddressPath:    podDir.IPAddressPath(),
+					StdoutPath:       podDir.StdoutPath(),
+					StderrPath:       podDir.StderrPath(),
+					SysErrorFilePath: podDir.SysErrorFilePath(),
 				},
+				ResourceRequest: resources.ResourceList{CPU: pointer.Int64(2)},
+				Nodes:           tt.nodes,
+			}); err != nil {
+				t.Fatal(err)
+			}
 
-				Containers: []PodHandler.Container{
-					{
-						InstanceName:  "lala",
-						RunAsUser:     0,
-						RunAsGroup:    0,
-						ImageFilePath: "/image/path",
-						EnvFilePath:   "/env/path",
-						Binds:         nil,
-						Command: []string{`
-                          # Peculiar expressions that cause issues
-                          cut -d ' ' -f 4 /proc/self/stat >
-
-						  cat << EOF > /tmp/test.py	
-						  with open('/tmp/somepath.json', 'w') as f:
-						  EOF
-						`},
-						Args:          []string{"some additional", "args"},
-						ExecutionMode: "run",
-						LogsPath:      podDir.Container("containerA").LogsPath(),
-						JobIDPath:     podDir.Container("containerA").IDPath(),
-						ExitCodePath:  podDir.Container("containerA").ExitCodePath(),
-					},
-					{
-						InstanceName:  "sidecar",
-						RunAsUser:     0,
-						RunAsGroup:    0,
-						ImageFilePath: "/image/path",
-						EnvFilePath:   "/env/path",
-						Binds:         nil,
-						// Stupid unescaped args
-						Command: []string{`
-							Try some terminated quotes: "", '', "''",
-							Try some unterminated quotes: ', ", \', \",
-						`},
-						ExecutionMode: "run",
-						LogsPath:      podDir.Container("containerA").LogsPath(),
-						JobIDPath:     podDir.Container("containerA").IDPath(),
-						ExitCodePath:  podDir.Container("containerA").ExitCodePath(),
-					},
-				},
+			for _, expected := range tt.expected {
+				if !strings.Contains(script.String(), expected) {
+					t.Errorf("script does not contain '%s'. script: \n%s", expected, script.String())
+				}
+			}
+
+			for _, excluded := range tt.excluded {
+				if strings.Contains(script.String(), excluded) {
+					t.Errorf("script should not contain '%s'. script: \n%s", excluded, script.String())
+				}
+			}
+
+			scriptFile := filepath.Join(t.TempDir(), "submit.sh")
+			if err := os.WriteFile(scriptFile, []byte(script.String()), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := PodHandler.ValidateScript(scriptFile); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestInteractiveScript(t *testing.T) {
+	podKey := types.NamespacedName{
+		Namespace: "dummy",
+		Name:      "shell",
+	}
+
+	podDir := compute.HPK.Pod(podKey)
+
+	fields := PodHandler.JobFields{
+		Pod:     podKey,
+		HostEnv: compute.HostEnvironment{PauseBin: "/opt/hpk/bin/hpk-pause"},
+		VirtualEnv: compute.VirtualEnvironment{
+			PodDirectory:     podDir.String(),
+			PauseSpecPath:    podDir.PauseSpecPath(),
+			IPAddressPath:    podDir.IPAddressPath(),
+			StdoutPath:       podDir.StdoutPath(),
+			StderrPath:       podDir.StderrPath(),
+			SysErrorFilePath: podDir.SysErrorFilePath(),
+		},
+		Nodes:       1,
+		Interactive: true,
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected []string
+		excluded []string
+	}{
+		{
+			name:     "host",
+			template: PodHandler.HostScriptTemplate,
+			expected: []string{
+				"exec 3<&0 4>&1 </dev/null >>" + podDir.StdoutPath(),
+				"\n/opt/hpk/bin/hpk-pause --spec " + podDir.PauseSpecPath() + " &",
 			},
 		},
 	}
 
-	submitTpl, err := PodHandler.ParseTemplate(PodHandler.PauseScriptTemplate)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl, err := PodHandler.ParseTemplate(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var script strings.Builder
+
+			if err := tpl.Execute(&script, fields); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, expected := range tt.expected {
+				if !strings.Contains(script.String(), expected) {
+					t.Errorf("script does not contain '%s'. script: \n%s", expected, script.String())
+				}
+			}
+
+			for _, excluded := range tt.excluded {
+				if strings.Contains(script.String(), excluded) {
+					t.Errorf("script should not contain '%s'. script: \n%s", excluded, script.String())
+				}
+			}
+
+			scriptFile := filepath.Join(t.TempDir(), "script.sh")
+			if err := os.WriteFile(scriptFile, []byte(script.String()), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := PodHandler.ValidateScript(scriptFile); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestHostScriptExecution(t *testing.T) {
+	dir := t.TempDir()
+
+	// the fake hpk-pause exits once it is terminated.
+	fakePause := filepath.Join(dir, "hpk-pause")
+	if err := os.WriteFile(fakePause, []byte("#!/bin/bash\n"+
+		"trap 'touch "+filepath.Join(dir, "terminated")+"; exit 0' TERM\n"+
+		"touch "+filepath.Join(dir, "started")+"\n"+
+		"while true; do sleep 0.1; done\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		pauseBin  string
+		terminate bool
+
+		expectedExitCode int
+		expectedSysError string
+	}{
+		{
+			name:             "missing hpk-pause",
+			pauseBin:         filepath.Join(dir, "missing"),
+			expectedExitCode: 127,
+			expectedSysError: "hpk-pause exited with code 127",
+		},
+		{
+			name:             "terminated",
+			pauseBin:         fakePause,
+			terminate:        true,
+			expectedExitCode: 0,
+		},
+	}
+
+	hostTpl, err := PodHandler.ParseTemplate(PodHandler.HostScriptTemplate)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	for _, tt := range tests {
-		var sbatchScript strings.Builder
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podKey := types.NamespacedName{Namespace: "hpk-test", Name: filepath.Base(dir) + "-" + strconv.Itoa(i)}
+			workdir := filepath.Join("/tmp", podKey.Namespace+"_"+podKey.Name)
+			sysError := filepath.Join(dir, podKey.Name+".syserror")
 
-		if err := submitTpl.Execute(&sbatchScript, tt.fields); err != nil {
-			/*-- since both the template and fields are internal to the code, the evaluation should always succeed	--*/
-			panic(errors.Wrapf(err, "failed to evaluate sbatch"))
-		}
+			var script strings.Builder
 
-		/*---------------------------------------------------
-		 * Validate the syntax of the generated script
-		 *---------------------------------------------------*/
-		// populate a temporary file with the generated content
-		f, err := os.CreateTemp("", "constructor.*.sh")
-		if err != nil {
-			log.Fatal(err)
-		}
+			if err := hostTpl.Execute(&script, PodHandler.JobFields{
+				Pod:     podKey,
+				HostEnv: compute.HostEnvironment{PauseBin: tt.pauseBin},
+				VirtualEnv: compute.VirtualEnvironment{
+					PauseSpecPath:    filepath.Join(dir, "pause.json"),
+					StdoutPath:       filepath.Join(dir, "stdout"),
+					StderrPath:       filepath.Join(dir, "stderr"),
+					SysErrorFilePath: sysError,
+				},
+				Nodes: 1,
+			}); err != nil {
+				t.Fatal(err)
+			}
 
-		_, err = f.WriteString(sbatchScript.String())
-		if err != nil {
-			log.Fatal(err)
-		}
+			cmd := exec.Command("bash", "-c", script.String())
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
 
-		if err := PodHandler.ValidateScript(f.Name()); err != nil {
-			log.Fatal(err)
-		}
+			if tt.terminate {
+				deadline := time.Now().Add(10 * time.Second)
+
+				for {
+					if _, err := os.Stat(filepath.Join(dir, "started")); err == nil {
+						break
+					}
 
-		t.Log("Tmpfile", f.Name())
-		// os.Remove(f.Name())
+					if time.Now().After(deadline) {
+						t.Fatal("hpk-pause has not started")
+					}
+
+					time.Sleep(50 * time.Millisecond)
+				}
+
+				if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			exitCode := 0
+
+			var exitErr *exec.ExitError
+			if err := cmd.Wait(); errors.As(err, &exitErr) {
+				exitCode = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if exitCode != tt.expectedExitCode {
+				t.Errorf("expected exit code %d but got %d", tt.expectedExitCode, exitCode)
+			}
+
+			if raw, _ := os.ReadFile(sysError); !strings.Contains(string(raw), tt.expectedSysError) || (tt.expectedSysError == "" && len(raw) > 0) {
+				t.Errorf("expected syserror '%s' but got '%s'", tt.expectedSysError, raw)
+			}
+
+			if tt.terminate {
+				if _, err := os.Stat(filepath.Join(dir, "terminated")); err != nil {
+					t.Error("termination has not been forwarded to hpk-pause")
+				}
+			}
+
+			if _, err := os.Stat(workdir); !os.IsNotExist(err) {
+				t.Errorf("workdir '%s' has not been removed", workdir)
+			}
+		})
 	}
 }
-
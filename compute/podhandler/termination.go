@@ -0,0 +1,254 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/runtime"
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/carv-ics-forth/hpk/pkg/filenotify"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+/************************************************************
+
+			Graceful Pod Termination
+
+************************************************************/
+
+// TerminationPollInterval is how often to check if the job of a terminating pod has exited.
+var TerminationPollInterval = time.Second
+
+// TerminationGracePeriod returns how long the containers of the pod may take to terminate after SIGTERM.
+func TerminationGracePeriod(pod *corev1.Pod) time.Duration {
+	switch {
+	case pod.DeletionGracePeriodSeconds != nil:
+		return time.Duration(*pod.DeletionGracePeriodSeconds) * time.Second
+	case pod.Spec.TerminationGracePeriodSeconds != nil:
+		return time.Duration(*pod.Spec.TerminationGracePeriodSeconds) * time.Second
+	default:
+		return corev1.DefaultTerminationGracePeriodSeconds * time.Second
+	}
+}
+
+/*
+TerminatePod asks the job of the pod to terminate gracefully, and returns immediately.
+
+The pause runs the preStop hooks and forwards SIGTERM to the containers. If the job has not exited within the
+grace period of the pod, it is cancelled. In either case, the final state of the containers is reported through
+notify, and the pod is removed as with DeletePod.
+Pods whose jobs are not running, or whose scheduler cannot terminate jobs gracefully, are deleted immediately.
+
+TerminatePod may be called multiple times for the same pod. It returns false if the pod must be deleted later.
+*/
+func TerminatePod(pod *corev1.Pod, watcher filenotify.FileWatcher, notify func(*corev1.Pod)) bool {
+	podKey := client.ObjectKeyFromObject(pod)
+	logger := compute.DefaultLogger.WithValues("pod", podKey)
+
+	localPod, err := LoadPodFromKey(podKey)
+	if err != nil {
+		return DeletePod(podKey, watcher)
+	}
+
+	/*-- the termination is already in progress --*/
+	if localPod.GetDeletionTimestamp() != nil {
+		return true
+	}
+
+	graceful, supported := scheduler.Default.(scheduler.GracefulScheduler)
+
+	gracePeriod := TerminationGracePeriod(pod)
+
+	if !supported || gracePeriod == 0 || !slurm.HasJobID(localPod) ||
+		localPod.Status.Phase == corev1.PodSucceeded || localPod.Status.Phase == corev1.PodFailed {
+		return DeletePod(podKey, watcher)
+	}
+
+	jobID := slurm.GetJobID(localPod)
+
+	/*-- jobs that have not started yet have nothing to clean up --*/
+	jobs, err := scheduler.Default.Status(jobID)
+	if err != nil || jobs[jobID].State != slurm.JobStateRunning {
+		return DeletePod(podKey, watcher)
+	}
+
+	/*---------------------------------------------------
+	 * Ask the job to terminate
+	 *---------------------------------------------------*/
+	out, err := graceful.Terminate(jobID)
+	if err != nil {
+		if errors.Is(err, slurm.ErrRety) {
+			logger.Info(" * Slurm job cannot be terminated. Retry later", "job", jobID, "out", out)
+
+			return false
+		}
+
+		logger.Info(" * Slurm job cannot be terminated gracefully", "job", jobID, "out", out, "err", err.Error())
+
+		return DeletePod(podKey, watcher)
+	}
+
+	/*-- mark the local copy, so that subsequent calls do not restart the termination --*/
+	localPod.SetDeletionTimestamp(pod.GetDeletionTimestamp())
+	localPod.SetDeletionGracePeriodSeconds(pod.GetDeletionGracePeriodSeconds())
+
+	if err := SavePodToFile(context.Background(), localPod); err != nil {
+		compute.SystemPanic(err, "failed to persist terminating pod '%s'", podKey)
+	}
+
+	logger.Info(" * Slurm job has been asked to terminate", "job", jobID, "gracePeriod", gracePeriod)
+
+	go waitForTermination(podKey, jobID, gracePeriod, watcher, notify)
+
+	return true
+}
+
+// waitForTermination waits up to the grace period for the job to exit, and then deletes the pod.
+func waitForTermination(podKey client.ObjectKey, jobID string, gracePeriod time.Duration, watcher filenotify.FileWatcher, notify func(*corev1.Pod)) {
+	logger := compute.DefaultLogger.WithValues("pod", podKey)
+
+	ticker := time.NewTicker(TerminationPollInterval)
+	defer ticker.Stop()
+
+	deadline := time.After(gracePeriod)
+
+	final := slurm.JobInfo{JobID: jobID, State: slurm.JobStateCancelled, Reason: "Terminated"}
+
+wait:
+	for {
+		select {
+		case <-ticker.C:
+			jobs, err := scheduler.Default.Status(jobID)
+			if err != nil {
+				continue
+			}
+
+			if job, exists := jobs[jobID]; !exists || job.State.IsTerminal() {
+				logger.Info(" * Slurm job has terminated gracefully", "job", jobID)
+
+				break wait
+			}
+
+		case <-deadline:
+			logger.Info(" * Grace period is over. Kill the Slurm job", "job", jobID, "gracePeriod", gracePeriod)
+
+			// the remaining containers are killed along with the job.
+			final.ExitCode = 137
+
+			break wait
+		}
+	}
+
+	/*---------------------------------------------------
+	 * Report the final state of the containers
+	 *---------------------------------------------------*/
+	if pod, err := LoadPodFromKey(podKey); err == nil {
+		UpdateStatusFromRuntime(pod)
+
+		slurm.ApplyJobState(pod, final)
+
+		notify(pod)
+	}
+
+	for !DeletePod(podKey, watcher) {
+		time.Sleep(TerminationPollInterval)
+	}
+}
+
+/*---------------------------------------------------
+ * Lifecycle Hooks
+ *---------------------------------------------------*/
+
+// hookCommand translates a lifecycle handler into the command that the pause runs, on the node of the container.
+func hookCommand(rt runtime.ContainerRuntime, spec runtime.Container, container *corev1.Container, handler *corev1.LifecycleHandler) ([]string, error) {
+	switch {
+	case handler.Exec != nil:
+		return rt.Exec(spec, handler.Exec.Command), nil
+
+	case handler.HTTPGet != nil:
+		url, err := httpGetURL(handler.HTTPGet, container)
+		if err != nil {
+			return nil, err
+		}
+
+		command := []string{"curl", "--silent", "--insecure", "--output", "/dev/null"}
+
+		for _, header := range handler.HTTPGet.HTTPHeaders {
+			command = append(command, "--header", header.Name+": "+header.Value)
+		}
+
+		return append(command, url), nil
+
+	case handler.Sleep != nil:
+		return []string{"sleep", strconv.FormatInt(handler.Sleep.Seconds, 10)}, nil
+
+	default:
+		return nil, errors.Errorf("unsupported lifecycle handler")
+	}
+}
+
+// httpGetURL returns the url of an httpGet handler. Containers use the network of the host.
+func httpGetURL(action *corev1.HTTPGetAction, container *corev1.Container) (string, error) {
+	host := action.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	port, err := resolvePort(action.Port, container)
+	if err != nil {
+		return "", err
+	}
+
+	scheme := strings.ToLower(string(action.Scheme))
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	path := action.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return fmt.Sprintf("%s://%s:%d%s", scheme, host, port, path), nil
+}
+
+// resolvePort returns the number of the given port, which may also refer to a named port of the container.
+func resolvePort(port intstr.IntOrString, container *corev1.Container) (int, error) {
+	if port.Type == intstr.Int {
+		return port.IntValue(), nil
+	}
+
+	for _, containerPort := range container.Ports {
+		if containerPort.Name == port.StrVal {
+			return int(containerPort.ContainerPort), nil
+		}
+	}
+
+	if number, err := strconv.Atoi(port.StrVal); err == nil {
+		return number, nil
+	}
+
+	return 0, errors.Errorf("unknown port '%s'", port.StrVal)
+}
@@ -0,0 +1,191 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/compute/runtime"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestTerminationGracePeriod(t *testing.T) {
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want time.Duration
+	}{
+		{
+			name: "default",
+			pod:  &corev1.Pod{},
+			want: 30 * time.Second,
+		},
+		{
+			name: "spec",
+			pod:  &corev1.Pod{Spec: corev1.PodSpec{TerminationGracePeriodSeconds: pointer.Int64(120)}},
+			want: 2 * time.Minute,
+		},
+		{
+			name: "deletion overrides spec",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionGracePeriodSeconds: pointer.Int64(0)},
+				Spec:       corev1.PodSpec{TerminationGracePeriodSeconds: pointer.Int64(120)},
+			},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TerminationGracePeriod(tt.pod); got != tt.want {
+				t.Errorf("TerminationGracePeriod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_hookCommand(t *testing.T) {
+	container := &corev1.Container{
+		Name:  "main",
+		Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+	}
+
+	tests := []struct {
+		name    string
+		handler corev1.LifecycleHandler
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "exec",
+			handler: corev1.LifecycleHandler{Exec: &corev1.ExecAction{Command: []string{"sh", "-c", "drain"}}},
+			want:    []string{"podman-hpc", "exec", "ns_pod_main", "sh", "-c", "drain"},
+		},
+		{
+			name: "http with named port",
+			handler: corev1.LifecycleHandler{HTTPGet: &corev1.HTTPGetAction{
+				Path: "shutdown",
+				Port: intstr.FromString("http"),
+			}},
+			want: []string{"curl", "--silent", "--insecure", "--output", "/dev/null", "http://127.0.0.1:8080/shutdown"},
+		},
+		{
+			name: "https with headers",
+			handler: corev1.LifecycleHandler{HTTPGet: &corev1.HTTPGetAction{
+				Host:        "10.0.0.1",
+				Path:        "/stop",
+				Port:        intstr.FromInt(9443),
+				Scheme:      corev1.URISchemeHTTPS,
+				HTTPHeaders: []corev1.HTTPHeader{{Name: "X-Drain", Value: "true"}},
+			}},
+			want: []string{"curl", "--silent", "--insecure", "--output", "/dev/null", "--header", "X-Drain: true", "https://10.0.0.1:9443/stop"},
+		},
+		{
+			name:    "unknown port",
+			handler: corev1.LifecycleHandler{HTTPGet: &corev1.HTTPGetAction{Port: intstr.FromString("metrics")}},
+			wantErr: true,
+		},
+		{
+			name:    "sleep",
+			handler: corev1.LifecycleHandler{Sleep: &corev1.SleepAction{Seconds: 5}},
+			want:    []string{"sleep", "5"},
+		},
+		{
+			name:    "tcp socket",
+			handler: corev1.LifecycleHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(80)}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hookCommand(runtime.PodmanHPC{}, runtime.Container{Name: "ns_pod_main"}, container, &tt.handler)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("hookCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hookCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_withHookFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		postStart   string
+		preStop     string
+		wantReason  string
+		wantMessage string
+	}{
+		{
+			name:        "no failures",
+			wantReason:  "Completed",
+			wantMessage: "Container exited",
+		},
+		{
+			name:        "postStart",
+			postStart:   "exit status 7",
+			wantReason:  ReasonPostStartHookError,
+			wantMessage: "PostStartHook failed: exit status 7",
+		},
+		{
+			name:        "preStop",
+			preStop:     "connection refused",
+			wantReason:  "Completed",
+			wantMessage: "Container exited; PreStopHook failed: connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			containerPath := endpoint.HPK(t.TempDir()).Pod(client.ObjectKey{Namespace: "ns", Name: "pod"}).Container("main")
+
+			write := func(path string, content string) {
+				if content == "" {
+					return
+				}
+
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			write(containerPath.PostStartErrorPath(), tt.postStart)
+			write(containerPath.PreStopErrorPath(), tt.preStop)
+
+			terminated := &corev1.ContainerStateTerminated{Reason: "Completed", Message: "Container exited"}
+			withHookFailures(terminated, containerPath)
+
+			if terminated.Reason != tt.wantReason || terminated.Message != tt.wantMessage {
+				t.Errorf("withHookFailures() = (%s, %s), want (%s, %s)", terminated.Reason, terminated.Message, tt.wantReason, tt.wantMessage)
+			}
+		})
+	}
+}
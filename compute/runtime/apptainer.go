@@ -0,0 +1,121 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/carv-ics-forth/hpk/compute/image"
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+)
+
+// Apptainer runs containers from .sif files under the image directory of HPK.
+//
+// --userns is needed to maintain the user's permissions.
+type Apptainer struct{}
+
+func (Apptainer) Name() string {
+	return NameApptainer
+}
+
+func (Apptainer) ImageRef(imageDir string, imageName string) string {
+	return imageDir + image.ParseImageName(imageName)
+}
+
+func (Apptainer) Present(ref string) (bool, error) {
+	return fileExists(ref)
+}
+
+func (Apptainer) Pull(imageName string, ref string) error {
+	if out, err := process.Execute(NameApptainer, "pull", ref, image.Docker.Wrap(imageName)); err != nil {
+		return errors.Wrapf(err, "apptainer pull has failed. out: '%s'", out)
+	}
+
+	return nil
+}
+
+// Run uses 'apptainer run', which executes the runscript of the image, unless the container overrides the command.
+func (a Apptainer) Run(c Container) []string {
+	if len(c.Command) == 0 {
+		return a.command(c, "run", c.Args)
+	}
+
+	return a.command(c, "exec", entrypoint(c))
+}
+
+func (a Apptainer) Exec(c Container, command []string) []string {
+	return a.command(c, "exec", command)
+}
+
+func (Apptainer) Stop(Container) []string {
+	return nil
+}
+
+func (Apptainer) Inspect(c Container) []string {
+	return []string{NameApptainer, "inspect", c.Image}
+}
+
+func (Apptainer) command(c Container, mode string, entrypoint []string) []string {
+	verbosity := "--quiet"
+	if c.Debug {
+		verbosity = "--debug"
+	}
+
+	cmd := []string{NameApptainer, verbosity, mode, "--cleanenv", "--writable-tmpfs", "--no-mount", "home", "--unsquash"}
+
+	if c.GPU {
+		cmd = append(cmd, "--nv")
+	}
+
+	if c.RunAsUser != 0 {
+		cmd = append(cmd, "--security", fmt.Sprintf("uid:%d,gid:%d", c.RunAsUser, c.RunAsUser), "--userns")
+	}
+
+	if c.RunAsGroup != 0 {
+		cmd = append(cmd, "--security", fmt.Sprintf("gid:%d", c.RunAsGroup), "--userns")
+	}
+
+	if len(c.Binds) > 0 {
+		cmd = append(cmd, "--bind", strings.Join(c.Binds, ","))
+	}
+
+	if c.EnvFile != "" {
+		cmd = append(cmd, "--env-file", c.EnvFile)
+	}
+
+	if c.WorkingDir != "" {
+		cmd = append(cmd, "--pwd", c.WorkingDir)
+	}
+
+	cmd = append(cmd, c.Image)
+
+	return append(cmd, entrypoint...)
+}
+
+// fileExists returns true if the image file exists.
+func fileExists(path string) (bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
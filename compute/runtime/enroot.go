@@ -0,0 +1,117 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"strings"
+
+	"github.com/carv-ics-forth/hpk/compute/image"
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+)
+
+// Enroot runs containers from squashfs images under the image directory of HPK.
+// The images are the same that pyxis imports for 'srun --container-image'.
+//
+// Enroot runs containers as the calling user, so RunAsUser and RunAsGroup are ignored,
+// and GPUs are exposed by its nvidia hook, for images that set NVIDIA_VISIBLE_DEVICES.
+type Enroot struct{}
+
+// enrootEnvWrapper exports the variables of the environment file ($0) into the container,
+// since 'enroot start' cannot read them from a file. The rest of the arguments are the enroot command.
+const enrootEnvWrapper = `set -a && . "$0" && set +a && exec "$1" "$2" $(sed -n 's/^\([A-Za-z_][A-Za-z0-9_]*\)=.*/--env \1/p' "$0") "${@:3}"`
+
+// enrootWorkdirWrapper changes to the working directory ($0) before running the command.
+const enrootWorkdirWrapper = `cd "$0" && exec "$@"`
+
+func (Enroot) Name() string {
+	return NameEnroot
+}
+
+func (Enroot) ImageRef(imageDir string, imageName string) string {
+	return imageDir + strings.TrimSuffix(image.ParseImageName(imageName), ".sif") + ".sqsh"
+}
+
+func (Enroot) Present(ref string) (bool, error) {
+	return fileExists(ref)
+}
+
+func (Enroot) Pull(imageName string, ref string) error {
+	if out, err := process.Execute(NameEnroot, "import", "--output", ref, EnrootURI(imageName)); err != nil {
+		return errors.Wrapf(err, "enroot import has failed. out: '%s'", out)
+	}
+
+	return nil
+}
+
+func (e Enroot) Run(c Container) []string {
+	if len(c.Command) == 0 {
+		return append(e.command(c, nil), c.Args...)
+	}
+
+	return e.command(c, entrypoint(c))
+}
+
+func (e Enroot) Exec(c Container, command []string) []string {
+	return e.command(c, command)
+}
+
+func (Enroot) Stop(Container) []string {
+	return nil
+}
+
+func (Enroot) Inspect(c Container) []string {
+	return []string{"unsquashfs", "-stat", c.Image}
+}
+
+// command runs the container from the image. If there is no command, the entrypoint of the image runs.
+// The working directory only applies to explicit commands, since the entrypoint is unknown to HPK.
+func (Enroot) command(c Container, command []string) []string {
+	cmd := []string{NameEnroot, "start", "--rw"}
+
+	if c.EnvFile != "" {
+		cmd = append([]string{"bash", "-c", enrootEnvWrapper, c.EnvFile}, cmd...)
+	}
+
+	for _, bind := range c.Binds {
+		hostPath, containerPath, readOnly := parseBind(bind)
+
+		options := "x-create=auto,rbind"
+		if readOnly {
+			options += ",ro"
+		}
+
+		cmd = append(cmd, "--mount", strings.Join([]string{hostPath, containerPath, "none", options}, " "))
+	}
+
+	cmd = append(cmd, c.Image)
+
+	if c.WorkingDir != "" && len(command) > 0 {
+		cmd = append(cmd, "sh", "-c", enrootWorkdirWrapper, c.WorkingDir)
+	}
+
+	return append(cmd, command...)
+}
+
+// EnrootURI translates the image into the docker URI of enroot, which separates the registry with '#'
+// (e.g, "docker://quay.io#jetstack/cert-manager:v1.12.3").
+func EnrootURI(imageName string) string {
+	registry, remainder := splitRegistry(imageName)
+	if registry == "" {
+		return image.Docker.Wrap(remainder)
+	}
+
+	return image.Docker.Wrap(registry + "#" + remainder)
+}
@@ -0,0 +1,204 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+)
+
+// PodmanHPC runs containers with podman-hpc, whose images are kept in its own storage.
+// The binary is given by --podman.
+type PodmanHPC struct{}
+
+func (PodmanHPC) Name() string {
+	return NamePodmanHPC
+}
+
+func (PodmanHPC) bin() string {
+	if compute.Environment.PodmanBin != "" {
+		return compute.Environment.PodmanBin
+	}
+
+	return NamePodmanHPC
+}
+
+func (PodmanHPC) ImageRef(_ string, imageName string) string {
+	return imageName
+}
+
+// Present returns true if the image has been migrated to the read-only storage of podman-hpc,
+// which is the one that is visible from the compute nodes.
+func (p PodmanHPC) Present(ref string) (bool, error) {
+	out, err := process.Execute(p.bin(), "images", "--format={{.Names}}|{{.IsReadOnly}}")
+	if err != nil {
+		return false, errors.Wrapf(err, "podman-hpc images has failed. out: '%s'", out)
+	}
+
+	return hasReadOnlyImage(string(out), ref), nil
+}
+
+func (p PodmanHPC) Pull(imageName string, _ string) error {
+	if out, err := process.Execute(p.bin(), "pull", imageName); err != nil {
+		return errors.Wrapf(err, "podman-hpc pull has failed. out: '%s'", out)
+	}
+
+	return nil
+}
+
+func (p PodmanHPC) Run(c Container) []string {
+	cmd := []string{p.bin(), "run", "--rm"}
+
+	if c.TTY {
+		cmd = append(cmd, "--interactive", "--tty")
+	}
+
+	cmd = append(cmd, "--name", c.Name)
+
+	if c.GPU {
+		cmd = append(cmd, "--gpu")
+	}
+
+	cmd = append(cmd, "--network=host", "--no-hosts")
+
+	if c.WorkingDir != "" {
+		cmd = append(cmd, "--workdir", c.WorkingDir)
+	}
+
+	if c.Hostname != "" {
+		cmd = append(cmd, "--hostname", c.Hostname)
+	}
+
+	if c.RunAsUser != 0 {
+		cmd = append(cmd, "--user", strconv.FormatInt(c.RunAsUser, 10))
+	}
+
+	if c.RunAsGroup != 0 {
+		cmd = append(cmd, "--group-add", strconv.FormatInt(c.RunAsGroup, 10))
+	}
+
+	for _, bind := range append(siteBinds(), c.Binds...) {
+		cmd = append(cmd, "-v", bind)
+	}
+
+	if c.EnvFile != "" {
+		cmd = append(cmd, "--env-file", c.EnvFile)
+	}
+
+	if len(c.Command) > 0 {
+		cmd = append(cmd, "--entrypoint", jsonArray(c.Command))
+	}
+
+	cmd = append(cmd, c.Image)
+
+	return append(cmd, c.Args...)
+}
+
+func (p PodmanHPC) Exec(c Container, command []string) []string {
+	return append([]string{p.bin(), "exec", c.Name}, command...)
+}
+
+func (p PodmanHPC) Stop(c Container) []string {
+	return []string{p.bin(), "stop", "--ignore", c.Name}
+}
+
+func (p PodmanHPC) Inspect(c Container) []string {
+	return []string{p.bin(), "inspect", "--format={{.State.Status}}", c.Name}
+}
+
+// jsonArray encodes the entrypoint in json, which podman takes for commands with spaces.
+func jsonArray(values []string) string {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	_ = encoder.Encode(values)
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// siteBinds are the mounts that the podman-hpc deployments of HPK rely on.
+func siteBinds() []string {
+	var binds []string
+
+	if home := os.Getenv("HOME"); home != "" {
+		binds = append(binds, home+"/.k8sfs/kubernetes:/k8s-data", home+":"+home)
+	}
+
+	if scratch := os.Getenv("SCRATCH"); scratch != "" {
+		binds = append(binds, scratch+":"+scratch, scratch+"/models:/models", scratch+"/hpk-tmp:/tmp")
+	}
+
+	return append(binds, "/tmp/scratch/:/scratch")
+}
+
+// hasReadOnlyImage parses lines in the format "[name1 name2]|isReadOnly", as given by 'podman images',
+// and returns true if the image is among the read-only images.
+func hasReadOnlyImage(out string, imageName string) bool {
+	want := NormalizeReference(imageName)
+
+	for _, line := range strings.Split(out, "\n") {
+		names, readOnly, found := strings.Cut(strings.TrimSpace(line), "|")
+		if !found || strings.TrimSpace(readOnly) != "true" {
+			continue
+		}
+
+		for _, name := range strings.Fields(strings.Trim(names, "[]")) {
+			if NormalizeReference(name) == want {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// NormalizeReference expands a short image reference to its fully-qualified form
+// (e.g, "alpine" to "docker.io/library/alpine:latest").
+func NormalizeReference(imageName string) string {
+	registry, remainder := splitRegistry(imageName)
+	if registry == "" {
+		registry = "docker.io"
+	}
+
+	if registry == "docker.io" && !strings.Contains(remainder, "/") {
+		remainder = "library/" + remainder
+	}
+
+	// the tag follows the last path component.
+	if !strings.Contains(remainder[strings.LastIndex(remainder, "/")+1:], ":") {
+		remainder += ":latest"
+	}
+
+	return registry + "/" + remainder
+}
+
+// splitRegistry separates the registry from the repository of the image. The registry is empty if it is omitted.
+func splitRegistry(imageName string) (registry string, remainder string) {
+	first, rest, found := strings.Cut(imageName, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first, rest
+	}
+
+	return "", imageName
+}
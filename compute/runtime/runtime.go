@@ -0,0 +1,181 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/image"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+/************************************************************
+
+			Container Runtime Drivers
+
+************************************************************/
+
+// SlurmContainerRuntime selects the container runtime of the pod, overriding the --container-runtime of HPK.
+const SlurmContainerRuntime = "slurm.hpk.io/container-runtime"
+
+// The supported container runtimes.
+const (
+	NameApptainer = "apptainer"
+	NamePodmanHPC = "podman-hpc"
+	NameEnroot    = "enroot"
+	NameShifter   = "shifter"
+)
+
+// ContainerRuntime drives the container engine that runs the containers of a pod within the Slurm allocation.
+//
+// Images are pulled by HPK. Everything else happens within the allocation, so the driver only renders
+// the respective command lines, which are executed by hpk-pause within the allocation of the pod.
+type ContainerRuntime interface {
+	image.Puller
+
+	// Name is the name of the runtime, as given to --container-runtime.
+	Name() string
+
+	// Run returns the command that runs the container in the foreground, until its process exits.
+	Run(c Container) []string
+
+	// Exec returns the command that runs the given command within the container.
+	// Runtimes without named containers start a sibling container, with the same image, mounts and environment.
+	Exec(c Container, command []string) []string
+
+	// Stop returns the command that stops the container.
+	// It is nil for runtimes whose containers stop by signaling the process of Run.
+	Stop(c Container) []string
+
+	// Inspect returns the command that prints the state of the container,
+	// or the metadata of its image for runtimes without named containers.
+	Inspect(c Container) []string
+}
+
+// Container describes a container to the runtime.
+type Container struct {
+	// Name is the name of the container instance (e.g, <namespace>_<pod>_<container>).
+	Name string
+
+	// Image is the reference returned by the ImageRef of the runtime.
+	Image string
+
+	// Command overrides the entrypoint of the image. If empty, the entrypoint of the image runs with the Args.
+	Command []string
+
+	Args []string
+
+	// Binds are mounts in the form <hostPath>:<containerPath>[:ro|rw].
+	Binds []string
+
+	// EnvFile points to a file with the environment variables of the container, as NAME=value lines.
+	EnvFile string
+
+	// WorkingDir overrides the working directory of the image.
+	WorkingDir string
+
+	// Hostname is the hostname of the container, if the runtime supports it.
+	Hostname string
+
+	// RunAsUser and RunAsGroup are ignored if zero.
+	RunAsUser  int64
+	RunAsGroup int64
+
+	// GPU exposes the GPUs of the node to the container.
+	GPU bool
+
+	// TTY attaches the container to the terminal of the runner.
+	TTY bool
+
+	// Debug increases the verbosity of the runtime.
+	Debug bool
+}
+
+// Drivers lists the supported container runtimes, by name.
+var Drivers = map[string]ContainerRuntime{
+	NameApptainer: Apptainer{},
+	NamePodmanHPC: PodmanHPC{},
+	NameEnroot:    Enroot{},
+	NameShifter:   Shifter{},
+}
+
+// Names returns the names of the supported container runtimes, sorted.
+func Names() []string {
+	names := make([]string, 0, len(Drivers))
+
+	for name := range Drivers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Lookup returns the container runtime with the given name.
+func Lookup(name string) (ContainerRuntime, error) {
+	driver, exists := Drivers[name]
+	if !exists {
+		return nil, errors.Errorf("unknown container runtime '%s'. expected one of: %s", name, strings.Join(Names(), ", "))
+	}
+
+	return driver, nil
+}
+
+// ForPod returns the container runtime that is selected by the 'slurm.hpk.io/container-runtime' annotation of the pod,
+// or the default runtime of HPK, if the annotation is missing.
+func ForPod(pod *corev1.Pod) (ContainerRuntime, error) {
+	name, exists := pod.GetAnnotations()[SlurmContainerRuntime]
+	if !exists {
+		return Lookup(compute.Environment.ContainerRuntime)
+	}
+
+	driver, err := Lookup(strings.TrimSpace(name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid annotation '%s'", SlurmContainerRuntime)
+	}
+
+	return driver, nil
+}
+
+/*---------------------------------------------------
+ * Helpers shared by the drivers
+ *---------------------------------------------------*/
+
+// parseBind splits a bind in the form <hostPath>:<containerPath>[:ro|rw].
+func parseBind(bind string) (hostPath string, containerPath string, readOnly bool) {
+	fields := strings.SplitN(bind, ":", 3)
+
+	hostPath = fields[0]
+	containerPath = fields[0]
+
+	if len(fields) > 1 {
+		containerPath = fields[1]
+	}
+
+	if len(fields) > 2 {
+		readOnly = fields[2] == "ro"
+	}
+
+	return hostPath, containerPath, readOnly
+}
+
+// entrypoint returns the command and arguments that follow the image in the command line.
+func entrypoint(c Container) []string {
+	return append(append([]string{}, c.Command...), c.Args...)
+}
@@ -0,0 +1,325 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRun(t *testing.T) {
+	t.Setenv("HOME", "")
+	t.Setenv("SCRATCH", "")
+
+	compute.Environment.PodmanBin = "podman-hpc"
+
+	container := Container{
+		Name:       "ns_pod_main",
+		Image:      "/images/alpine_3.7.sif",
+		Command:    []string{"sh", "-c"},
+		Args:       []string{"echo $HOME"},
+		Binds:      []string{"/vol/data:/data:ro", "/vol/cache:/cache:rw"},
+		EnvFile:    "/tmp/scratch/ns_pod_main.env",
+		WorkingDir: "/work",
+		Hostname:   "pod",
+		RunAsUser:  1000,
+		GPU:        true,
+	}
+
+	tests := []struct {
+		name      string
+		runtime   ContainerRuntime
+		container Container
+		want      []string
+	}{
+		{
+			name:      "apptainer exec",
+			runtime:   Apptainer{},
+			container: container,
+			want: []string{"apptainer", "--quiet", "exec", "--cleanenv", "--writable-tmpfs", "--no-mount", "home", "--unsquash",
+				"--nv", "--security", "uid:1000,gid:1000", "--userns", "--bind", "/vol/data:/data:ro,/vol/cache:/cache:rw",
+				"--env-file", "/tmp/scratch/ns_pod_main.env", "--pwd", "/work",
+				"/images/alpine_3.7.sif", "sh", "-c", "echo $HOME"},
+		},
+		{
+			name:      "apptainer run",
+			runtime:   Apptainer{},
+			container: Container{Name: "ns_pod_main", Image: "/images/alpine_3.7.sif", Args: []string{"--verbose"}, Debug: true},
+			want: []string{"apptainer", "--debug", "run", "--cleanenv", "--writable-tmpfs", "--no-mount", "home", "--unsquash",
+				"/images/alpine_3.7.sif", "--verbose"},
+		},
+		{
+			name:      "podman-hpc",
+			runtime:   PodmanHPC{},
+			container: container,
+			want: []string{"podman-hpc", "run", "--rm", "--name", "ns_pod_main", "--gpu", "--network=host", "--no-hosts",
+				"--workdir", "/work", "--hostname", "pod", "--user", "1000",
+				"-v", "/tmp/scratch/:/scratch", "-v", "/vol/data:/data:ro", "-v", "/vol/cache:/cache:rw",
+				"--env-file", "/tmp/scratch/ns_pod_main.env", "--entrypoint", `["sh","-c"]`,
+				"/images/alpine_3.7.sif", "echo $HOME"},
+		},
+		{
+			name:      "podman-hpc tty",
+			runtime:   PodmanHPC{},
+			container: Container{Name: "ns_pod_shell", Image: "alpine", TTY: true},
+			want: []string{"podman-hpc", "run", "--rm", "--interactive", "--tty", "--name", "ns_pod_shell", "--network=host", "--no-hosts",
+				"-v", "/tmp/scratch/:/scratch", "alpine"},
+		},
+		{
+			name:      "enroot",
+			runtime:   Enroot{},
+			container: container,
+			want: []string{"bash", "-c", enrootEnvWrapper, "/tmp/scratch/ns_pod_main.env",
+				"enroot", "start", "--rw",
+				"--mount", "/vol/data /data none x-create=auto,rbind,ro",
+				"--mount", "/vol/cache /cache none x-create=auto,rbind",
+				"/images/alpine_3.7.sif", "sh", "-c", enrootWorkdirWrapper, "/work", "sh", "-c", "echo $HOME"},
+		},
+		{
+			name:      "enroot entrypoint",
+			runtime:   Enroot{},
+			container: Container{Image: "/images/alpine_3.7.sqsh", Args: []string{"--verbose"}, WorkingDir: "/work"},
+			want:      []string{"enroot", "start", "--rw", "/images/alpine_3.7.sqsh", "--verbose"},
+		},
+		{
+			name:      "shifter",
+			runtime:   Shifter{},
+			container: container,
+			want: []string{"shifter", "--image=/images/alpine_3.7.sif", "--volume=/vol/data:/data:ro", "--volume=/vol/cache:/cache",
+				"--env-file=/tmp/scratch/ns_pod_main.env", "--workdir=/work", "--module=gpu", "--", "sh", "-c", "echo $HOME"},
+		},
+		{
+			name:      "shifter entrypoint",
+			runtime:   Shifter{},
+			container: Container{Image: "docker:alpine:3.7", Args: []string{"--verbose"}},
+			want:      []string{"shifter", "--image=docker:alpine:3.7", "--entrypoint", "--", "--verbose"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.runtime.Run(tt.container); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Run() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExec(t *testing.T) {
+	compute.Environment.PodmanBin = "podman-hpc"
+
+	container := Container{Name: "ns_pod_main", Image: "/images/alpine_3.7.sif", Command: []string{"sleep", "infinity"}}
+	command := []string{"sh", "-c", "drain"}
+
+	tests := []struct {
+		name    string
+		runtime ContainerRuntime
+		want    []string
+	}{
+		{
+			name:    "apptainer",
+			runtime: Apptainer{},
+			want: []string{"apptainer", "--quiet", "exec", "--cleanenv", "--writable-tmpfs", "--no-mount", "home", "--unsquash",
+				"/images/alpine_3.7.sif", "sh", "-c", "drain"},
+		},
+		{
+			name:    "podman-hpc",
+			runtime: PodmanHPC{},
+			want:    []string{"podman-hpc", "exec", "ns_pod_main", "sh", "-c", "drain"},
+		},
+		{
+			name:    "enroot",
+			runtime: Enroot{},
+			want:    []string{"enroot", "start", "--rw", "/images/alpine_3.7.sif", "sh", "-c", "drain"},
+		},
+		{
+			name:    "shifter",
+			runtime: Shifter{},
+			want:    []string{"shifter", "--image=/images/alpine_3.7.sif", "--", "sh", "-c", "drain"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.runtime.Exec(container, command); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Exec() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageRef(t *testing.T) {
+	tests := []struct {
+		name    string
+		runtime ContainerRuntime
+		want    string
+	}{
+		{name: "apptainer", runtime: Apptainer{}, want: "/images/cert-manager-cainjector_v1.12.3.sif"},
+		{name: "podman-hpc", runtime: PodmanHPC{}, want: "quay.io/jetstack/cert-manager-cainjector:v1.12.3"},
+		{name: "enroot", runtime: Enroot{}, want: "/images/cert-manager-cainjector_v1.12.3.sqsh"},
+		{name: "shifter", runtime: Shifter{}, want: "docker:quay.io/jetstack/cert-manager-cainjector:v1.12.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.runtime.ImageRef("/images", "quay.io/jetstack/cert-manager-cainjector:v1.12.3"); got != tt.want {
+				t.Errorf("ImageRef() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeReference(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "alpine", want: "docker.io/library/alpine:latest"},
+		{image: "alpine:3.7", want: "docker.io/library/alpine:3.7"},
+		{image: "istio/examples-bookinfo-details-v1:1.16.2", want: "docker.io/istio/examples-bookinfo-details-v1:1.16.2"},
+		{image: "localhost:5000/tools/pause", want: "localhost:5000/tools/pause:latest"},
+		{image: "quay.io/jetstack/cert-manager-cainjector:v1.12.3", want: "quay.io/jetstack/cert-manager-cainjector:v1.12.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := NormalizeReference(tt.image); got != tt.want {
+				t.Errorf("NormalizeReference() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_hasReadOnlyImage(t *testing.T) {
+	out := "[docker.io/library/alpine:3.7]|true\n[quay.io/jetstack/cert-manager-cainjector:v1.12.3]|false\n[localhost/a:1 localhost/b:2]|true\n"
+
+	tests := []struct {
+		image string
+		want  bool
+	}{
+		{image: "alpine:3.7", want: true},
+		{image: "alpine", want: false},
+		{image: "quay.io/jetstack/cert-manager-cainjector:v1.12.3", want: false},
+		{image: "localhost/b:2", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := hasReadOnlyImage(out, tt.image); got != tt.want {
+				t.Errorf("hasReadOnlyImage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnrootURI(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "alpine:3.7", want: "docker://alpine:3.7"},
+		{image: "nvcr.io/nvidia/pytorch:23.10-py3", want: "docker://nvcr.io#nvidia/pytorch:23.10-py3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := EnrootURI(tt.image); got != tt.want {
+				t.Errorf("EnrootURI() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestEnrootEnvironment runs the environment wrapper of enroot against a fake enroot.
+func TestEnrootEnvironment(t *testing.T) {
+	dir := t.TempDir()
+
+	fakeEnroot := "#!/bin/bash\necho \"args: $*\"\necho \"GREETING=${GREETING}\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "enroot"), []byte(fakeEnroot), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	envFile := filepath.Join(dir, "main.env")
+	if err := os.WriteFile(envFile, []byte("GREETING='hello world'\nHPK_NODE_RANK=0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+
+	args := Enroot{}.Run(Container{Image: "/images/alpine.sqsh", Command: []string{"env"}, EnvFile: envFile})
+
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	want := "args: start --env GREETING --env HPK_NODE_RANK --rw /images/alpine.sqsh env\nGREETING=hello world\n"
+	if string(out) != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestForPod(t *testing.T) {
+	compute.Environment.ContainerRuntime = NamePodmanHPC
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name: "default",
+			want: NamePodmanHPC,
+		},
+		{
+			name:        "annotation",
+			annotations: map[string]string{SlurmContainerRuntime: "enroot"},
+			want:        NameEnroot,
+		},
+		{
+			name:        "unknown",
+			annotations: map[string]string{SlurmContainerRuntime: "docker"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+
+			got, err := ForPod(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ForPod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err == nil && got.Name() != tt.want {
+				t.Errorf("ForPod() = %v, want %v", got.Name(), tt.want)
+			}
+
+			if err != nil && !strings.Contains(err.Error(), SlurmContainerRuntime) {
+				t.Errorf("ForPod() error = %v, should mention the annotation", err)
+			}
+		})
+	}
+}
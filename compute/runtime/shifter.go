@@ -0,0 +1,101 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+)
+
+// Shifter runs containers from the images of the Shifter image gateway.
+//
+// Shifter runs containers as the calling user, so RunAsUser and RunAsGroup are ignored.
+type Shifter struct{}
+
+func (Shifter) Name() string {
+	return NameShifter
+}
+
+func (Shifter) ImageRef(_ string, imageName string) string {
+	return "docker:" + imageName
+}
+
+func (Shifter) Present(ref string) (bool, error) {
+	// lookup fails for images that are unknown to the gateway.
+	_, err := process.Execute("shifterimg", "lookup", ref)
+
+	return err == nil, nil
+}
+
+func (Shifter) Pull(_ string, ref string) error {
+	if out, err := process.Execute("shifterimg", "pull", ref); err != nil {
+		return errors.Wrapf(err, "shifterimg pull has failed. out: '%s'", out)
+	}
+
+	return nil
+}
+
+func (s Shifter) Run(c Container) []string {
+	if len(c.Command) == 0 {
+		return append(s.command(c, true), c.Args...)
+	}
+
+	return append(s.command(c, false), entrypoint(c)...)
+}
+
+func (s Shifter) Exec(c Container, command []string) []string {
+	return append(s.command(c, false), command...)
+}
+
+func (Shifter) Stop(Container) []string {
+	return nil
+}
+
+func (Shifter) Inspect(c Container) []string {
+	return []string{"shifterimg", "lookup", c.Image}
+}
+
+func (Shifter) command(c Container, useEntrypoint bool) []string {
+	cmd := []string{NameShifter, "--image=" + c.Image}
+
+	for _, bind := range c.Binds {
+		hostPath, containerPath, readOnly := parseBind(bind)
+
+		volume := hostPath + ":" + containerPath
+		if readOnly {
+			volume += ":ro"
+		}
+
+		cmd = append(cmd, "--volume="+volume)
+	}
+
+	if c.EnvFile != "" {
+		cmd = append(cmd, "--env-file="+c.EnvFile)
+	}
+
+	if c.WorkingDir != "" {
+		cmd = append(cmd, "--workdir="+c.WorkingDir)
+	}
+
+	if c.GPU {
+		cmd = append(cmd, "--module=gpu")
+	}
+
+	if useEntrypoint {
+		cmd = append(cmd, "--entrypoint")
+	}
+
+	return append(cmd, "--")
+}
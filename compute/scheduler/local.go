@@ -0,0 +1,270 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+/************************************************************
+
+			Local Process Executor
+
+************************************************************/
+
+// Local runs the host scripts as detached processes on the host of the kubelet.
+// It is meant for development and CI environments where Slurm is not available.
+type Local struct {
+	lock sync.Mutex
+
+	// exited holds the final state of the processes that have terminated.
+	exited map[string]slurm.JobInfo
+}
+
+func NewLocal() *Local {
+	return &Local{
+		exited: make(map[string]slurm.JobInfo),
+	}
+}
+
+// Submit starts the script in a new session, so that it survives restarts of the kubelet,
+// and can be terminated as a group. The stdout/stderr are redirected according to the
+// #SBATCH --output/--error directives of the script.
+func (l *Local) Submit(scriptFile string) (string, error) {
+	directives, err := parseBatchDirectives(scriptFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot parse script '%s'", scriptFile)
+	}
+
+	cmd := exec.Command("bash", scriptFile)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Env = append(os.Environ(), "SLURM_JOB_NAME="+directives["job-name"])
+
+	stdout, err := openOutput(directives["output"])
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot open stdout")
+	}
+	defer stdout.Close()
+
+	stderr, err := openOutput(directives["error"])
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot open stderr")
+	}
+	defer stderr.Close()
+
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return "", errors.Wrapf(err, "cannot start script '%s'", scriptFile)
+	}
+
+	jobID := strconv.Itoa(cmd.Process.Pid)
+
+	// reap the process and keep its exit code.
+	go func() {
+		_ = cmd.Wait()
+
+		job := slurm.JobInfo{JobID: jobID, State: slurm.JobStateCompleted, Reason: "None"}
+
+		switch status := cmd.ProcessState.Sys().(syscall.WaitStatus); {
+		case status.Signaled():
+			job.State = slurm.JobStateCancelled
+			job.Signal = int(status.Signal())
+		case status.ExitStatus() != 0:
+			job.State = slurm.JobStateFailed
+			job.Reason = "NonZeroExitCode"
+			job.ExitCode = status.ExitStatus()
+		}
+
+		l.lock.Lock()
+		l.exited[jobID] = job
+		l.lock.Unlock()
+	}()
+
+	compute.DefaultLogger.Info("[Local] Script started", "script", scriptFile, "pid", jobID)
+
+	return jobID, nil
+}
+
+// Cancel sends SIGTERM to the process group of the job. Jobs that have already exited are invalid,
+// even if some processes of their group linger.
+func (l *Local) Cancel(jobID string) (string, error) {
+	pid, err := strconv.Atoi(jobID)
+	if err != nil {
+		return "", errors.Wrapf(slurm.ErrInvalidJob, "malformed pid '%s'", jobID)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, exited := l.exited[jobID]; exited {
+		return "", slurm.ErrInvalidJob
+	}
+
+	if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return "", slurm.ErrInvalidJob
+		}
+
+		return "", errors.Wrapf(err, "cannot terminate process '%s'", jobID)
+	}
+
+	return "", nil
+}
+
+// Status reports the processes that are still alive as running, and the processes that have exited as
+// completed, failed, or cancelled, depending on how they exited. Processes that were started by a previous instance
+// of the kubelet are omitted once they exit, since their exit code cannot be recovered.
+func (l *Local) Status(jobIDs ...string) (map[string]slurm.JobInfo, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	jobs := make(map[string]slurm.JobInfo, len(jobIDs))
+
+	for _, jobID := range jobIDs {
+		if job, exited := l.exited[jobID]; exited {
+			jobs[jobID] = job
+
+			continue
+		}
+
+		pid, err := strconv.Atoi(jobID)
+		if err != nil {
+			continue
+		}
+
+		if err := syscall.Kill(pid, 0); err == nil || errors.Is(err, syscall.EPERM) {
+			jobs[jobID] = slurm.JobInfo{JobID: jobID, State: slurm.JobStateRunning, Reason: "None"}
+		}
+	}
+
+	return jobs, nil
+}
+
+// Capacity reports the cpus and the memory of the host. As with the Slurm nodes, the host holds
+// slurm.Slurm.PodsPerNode pods, or one pod per cpu if it is unset.
+func (l *Local) Capacity() (capacity corev1.ResourceList, allocatable corev1.ResourceList, err error) {
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot read memory info")
+	}
+
+	pods := int64(slurm.Slurm.PodsPerNode)
+	if pods == 0 {
+		pods = int64(runtime.NumCPU())
+	}
+
+	capacity = corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewQuantity(int64(runtime.NumCPU()), resource.DecimalSI),
+		corev1.ResourceMemory: *resource.NewQuantity(meminfo["MemTotal"], resource.BinarySI),
+		corev1.ResourcePods:   *resource.NewQuantity(pods, resource.DecimalSI),
+	}
+
+	allocatable = capacity.DeepCopy()
+	allocatable[corev1.ResourceMemory] = *resource.NewQuantity(meminfo["MemAvailable"], resource.BinarySI)
+
+	return capacity, allocatable, nil
+}
+
+// Ping always succeeds, since the executor runs within the kubelet.
+func (l *Local) Ping() error {
+	return nil
+}
+
+func (l *Local) IDType() slurm.JobIDType {
+	return slurm.JobIDTypeProcess
+}
+
+// parseBatchDirectives extracts the long-form '#SBATCH --key=value' directives of the script.
+func parseBatchDirectives(scriptFile string) (map[string]string, error) {
+	f, err := os.Open(scriptFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	directives := make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, found := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "#SBATCH --")
+		if !found {
+			continue
+		}
+
+		// drop trailing comments
+		line, _, _ = strings.Cut(line, " ")
+
+		key, value, _ := strings.Cut(line, "=")
+		directives[key] = value
+	}
+
+	return directives, scanner.Err()
+}
+
+func openOutput(path string) (*os.File, error) {
+	if path == "" {
+		return os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	}
+
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
+
+// readMeminfo returns the entries of /proc/meminfo in bytes.
+func readMeminfo() (map[string]int64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	meminfo := make(map[string]int64)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// format: "MemTotal:       16318644 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if len(fields) == 3 && fields[2] == "kB" {
+			value *= 1024
+		}
+
+		meminfo[strings.TrimSuffix(fields[0], ":")] = value
+	}
+
+	return meminfo, scanner.Err()
+}
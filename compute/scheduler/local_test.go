@@ -0,0 +1,147 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/pkg/errors"
+)
+
+func writeScript(t *testing.T, dir string, body string) string {
+	t.Helper()
+
+	script := "#!/bin/bash\n" +
+		"#SBATCH --job-name=mypod\n" +
+		"#SBATCH --output=" + filepath.Join(dir, "stdout") + "\n" +
+		"#SBATCH --error=" + filepath.Join(dir, "stderr") + "\n" +
+		"#SBATCH --signal=B:TERM@60 # comment\n" +
+		body + "\n"
+
+	scriptFile := filepath.Join(dir, "submit.sh")
+	if err := os.WriteFile(scriptFile, []byte(script), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return scriptFile
+}
+
+// waitForState polls the scheduler until the job reaches the expected state.
+func waitForState(t *testing.T, s scheduler.Scheduler, jobID string, state slurm.JobState) slurm.JobInfo {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+
+	for time.Now().Before(deadline) {
+		jobs, err := s.Status(jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if jobs[jobID].State == state {
+			return jobs[jobID]
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatalf("job '%s' did not reach state '%s'", jobID, state)
+
+	return slurm.JobInfo{}
+}
+
+func TestLocal(t *testing.T) {
+	local := scheduler.NewLocal()
+
+	t.Run("completed", func(t *testing.T) {
+		dir := t.TempDir()
+
+		jobID, err := local.Submit(writeScript(t, dir, "echo hello from $SLURM_JOB_NAME"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		waitForState(t, local, jobID, slurm.JobStateCompleted)
+
+		stdout, err := os.ReadFile(filepath.Join(dir, "stdout"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.TrimSpace(string(stdout)) != "hello from mypod" {
+			t.Errorf("stdout = '%s', want 'hello from mypod'", stdout)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		jobID, err := local.Submit(writeScript(t, t.TempDir(), "exit 3"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if job := waitForState(t, local, jobID, slurm.JobStateFailed); job.ExitCode != 3 {
+			t.Errorf("exit code = %d, want 3", job.ExitCode)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		jobID, err := local.Submit(writeScript(t, t.TempDir(), "sleep 60"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		waitForState(t, local, jobID, slurm.JobStateRunning)
+
+		if _, err := local.Cancel(jobID); err != nil {
+			t.Fatal(err)
+		}
+
+		waitForState(t, local, jobID, slurm.JobStateCancelled)
+
+		if _, err := local.Cancel(jobID); !errors.Is(err, slurm.ErrInvalidJob) {
+			t.Errorf("Cancel() error = %v, want %v", err, slurm.ErrInvalidJob)
+		}
+	})
+
+	t.Run("capacity", func(t *testing.T) {
+		capacity, allocatable, err := local.Capacity()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if capacity.Cpu().IsZero() || capacity.Memory().IsZero() || allocatable.Memory().IsZero() {
+			t.Errorf("Capacity() = %v, %v", capacity, allocatable)
+		}
+
+		// one pod per cpu, unless the pods per node are set.
+		if pods := capacity.Pods().Value(); pods != int64(runtime.NumCPU()) {
+			t.Errorf("Capacity() pods = %d, want %d", pods, runtime.NumCPU())
+		}
+
+		defer func(pods int) { slurm.Slurm.PodsPerNode = pods }(slurm.Slurm.PodsPerNode)
+		slurm.Slurm.PodsPerNode = 3
+
+		if capacity, _, _ := local.Capacity(); capacity.Pods().Value() != 3 {
+			t.Errorf("Capacity() pods = %d, want 3", capacity.Pods().Value())
+		}
+	})
+}
@@ -0,0 +1,837 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+/************************************************************
+
+			Pilot Jobs
+
+************************************************************/
+
+// PilotOptions configure the allocations that are held by the Pilot scheduler.
+type PilotOptions struct {
+	// CPUs and MemoryMB are the resources of every pilot.
+	CPUs     int64
+	MemoryMB int64
+
+	// MaxPilots is the maximum number of pilots that may be held at the same time.
+	MaxPilots int
+
+	// IdleTimeout is how long a pilot may remain without pods, before it is released.
+	IdleTimeout time.Duration
+
+	// SyncInterval is how often the pilots are checked for termination and idleness.
+	SyncInterval time.Duration
+
+	// Flags are additional sbatch flags for the pilots (e.g, --partition=short, --time=04:00:00).
+	Flags []string
+}
+
+// Pilot places the pods into long-lived Slurm allocations (pilot jobs), in order to avoid the submission and the
+// queueing delay of a separate job per pod. Every pilot runs an agent that starts the host scripts of the pods that
+// are placed in it. Pods are bin-packed into the pilots according to their cpu and memory requests, and new pilots
+// are started on demand. The requests are reserved, but not enforced, within the pilot.
+//
+// Pods that cannot be placed in a pilot (e.g, multi-node pods, pods that exceed the size or the time limit of a pilot,
+// or pods with Slurm dependencies) are submitted as regular Slurm jobs. The ids of pods that run in a pilot have the
+// form '<pilot>.<task>', and are not known to Slurm. The time limit of the tasks is enforced by the agent.
+//
+// It must be created with NewPilot.
+type Pilot struct {
+	PilotOptions
+
+	// dir holds the script and the spool directories of the pilots.
+	dir string
+
+	lock   sync.Mutex
+	pilots map[string]*pilotJob
+}
+
+// pilotJob is the view of a pilot, as seen by the scheduler.
+type pilotJob struct {
+	ID string
+
+	State slurm.JobState
+
+	// tasks are the resource requests of the tasks that have been placed in the pilot.
+	tasks map[int]taskRequest
+
+	// idleSince is when the last task of the pilot has exited. It is zero while the pilot has active tasks.
+	idleSince time.Time
+}
+
+// taskRequest is the resources of a task, as given by the #SBATCH directives of its script.
+type taskRequest struct {
+	CPUs     int64
+	MemoryMB int64
+	Nodes    int64
+
+	// TimeLimit is zero if the task has no time limit, and negative if the limit cannot be parsed (e.g, UNLIMITED).
+	TimeLimit time.Duration
+}
+
+// NewPilot returns a scheduler that places the pods into pilots, and recovers the pilots of previous runs
+// that are still active.
+func NewPilot(dir string, options PilotOptions) (*Pilot, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "cannot create pilot directory '%s'", dir)
+	}
+
+	p := &Pilot{
+		PilotOptions: options,
+		dir:          dir,
+		pilots:       make(map[string]*pilotJob),
+	}
+
+	if err := p.recover(); err != nil {
+		return nil, errors.Wrapf(err, "cannot recover pilots")
+	}
+
+	return p, nil
+}
+
+// Run releases the pilots that have terminated, or have been idle for longer than the IdleTimeout.
+// It blocks until the context is cancelled.
+func (p *Pilot) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.sync(time.Now()); err != nil {
+				compute.DefaultLogger.Error(err, "Unable to synchronize the pilots")
+			}
+		}
+	}
+}
+
+// Submit places the script in the pilot that has the least free cpus among those that fit its requests (best-fit),
+// and starts a new pilot if none fits. If the pilots cannot hold the script, it is submitted as a regular Slurm job.
+func (p *Pilot) Submit(scriptFile string) (string, error) {
+	directives, err := parseBatchDirectives(scriptFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot parse script '%s'", scriptFile)
+	}
+
+	request := parseTaskRequest(directives)
+
+	if request.Nodes > 1 || request.CPUs > p.CPUs || request.MemoryMB > p.MemoryMB ||
+		!p.compatible(directives) || !p.withinTimeLimit(request) {
+		compute.DefaultLogger.Info("[Pilot] Script does not fit in a pilot. Submit as a regular job", "script", scriptFile)
+
+		return slurm.SubmitJob(scriptFile)
+	}
+
+	// only Slurm can hold a job until its dependencies are satisfied.
+	if _, hasDependency := directives["dependency"]; hasDependency {
+		compute.DefaultLogger.Info("[Pilot] Script has dependencies. Submit as a regular job", "script", scriptFile)
+
+		return slurm.SubmitJob(scriptFile)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	pilot := p.bestFit(request)
+	if pilot == nil {
+		if len(p.pilots) >= p.MaxPilots {
+			compute.DefaultLogger.Info("[Pilot] All pilots are full. Submit as a regular job", "script", scriptFile)
+
+			return slurm.SubmitJob(scriptFile)
+		}
+
+		if pilot, err = p.startPilot(); err != nil {
+			return "", err
+		}
+	}
+
+	taskID := 0
+	for id := range pilot.tasks {
+		if id >= taskID {
+			taskID = id + 1
+		}
+	}
+
+	script, err := os.ReadFile(scriptFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot read script '%s'", scriptFile)
+	}
+
+	// the time limit must be in place before the agent starts the task.
+	if request.TimeLimit > 0 {
+		if err := writeFileAtomic(p.taskFile(pilot.ID, strconv.Itoa(taskID), "deadline"), deadlineSeconds(request.TimeLimit)); err != nil {
+			return "", errors.Wrapf(err, "cannot set time limit in pilot '%s'", pilot.ID)
+		}
+	}
+
+	// the agent picks any '*.sh' file, so the script must appear at once.
+	taskScript := filepath.Join(p.spoolDir(pilot.ID), strconv.Itoa(taskID)+".sh")
+
+	if err := writeFileAtomic(taskScript, script); err != nil {
+		return "", errors.Wrapf(err, "cannot place script in pilot '%s'", pilot.ID)
+	}
+
+	pilot.tasks[taskID] = request
+	pilot.idleSince = time.Time{}
+
+	jobID := pilot.ID + "." + strconv.Itoa(taskID)
+
+	compute.DefaultLogger.Info("[Pilot] Script has been placed", "script", scriptFile, "pilot", pilot.ID, "job", jobID)
+
+	return jobID, nil
+}
+
+// Cancel kills the task immediately. Tasks that have not started yet are never started.
+func (p *Pilot) Cancel(jobID string) (string, error) {
+	pilotID, taskID, isTask := parseTaskID(jobID)
+	if !isTask {
+		return slurm.CancelJob(jobID)
+	}
+
+	return "", p.request(pilotID, taskID, "cancel")
+}
+
+// Terminate sends SIGTERM to the host script of the task, as the '--batch' flag of scancel does.
+func (p *Pilot) Terminate(jobID string) (string, error) {
+	pilotID, taskID, isTask := parseTaskID(jobID)
+	if !isTask {
+		return slurm.TerminateJob(jobID)
+	}
+
+	return "", p.request(pilotID, taskID, "term")
+}
+
+// UpdateDeadline changes the time limit of the task, counting from its start. The agent terminates the task
+// once it has run for longer, as Slurm does with the jobs.
+func (p *Pilot) UpdateDeadline(jobID string, deadline time.Duration) error {
+	pilotID, taskID, isTask := parseTaskID(jobID)
+	if !isTask {
+		return slurm.UpdateTimeLimit(jobID, deadline)
+	}
+
+	if _, err := os.Stat(p.taskFile(pilotID, taskID, "sh")); err != nil || p.hasExited(pilotID, taskID) {
+		return slurm.ErrInvalidJob
+	}
+
+	if err := writeFileAtomic(p.taskFile(pilotID, taskID, "deadline"), deadlineSeconds(deadline)); err != nil {
+		return errors.Wrapf(err, "cannot update time limit of task '%s'", jobID)
+	}
+
+	return nil
+}
+
+// Status resolves the tasks from the files of the agent, and the state of their pilots.
+// Tasks that wait in a queued pilot inherit its pending reason.
+func (p *Pilot) Status(jobIDs ...string) (map[string]slurm.JobInfo, error) {
+	var (
+		regular  []string
+		pilotIDs []string
+		tasks    = make(map[string][2]string)
+		seen     = make(map[string]bool)
+	)
+
+	for _, jobID := range jobIDs {
+		pilotID, taskID, isTask := parseTaskID(jobID)
+		if !isTask {
+			regular = append(regular, jobID)
+
+			continue
+		}
+
+		if !seen[pilotID] {
+			seen[pilotID] = true
+			pilotIDs = append(pilotIDs, pilotID)
+		}
+
+		tasks[jobID] = [2]string{pilotID, taskID}
+	}
+
+	jobs, err := slurm.QueryJobs(append(regular, pilotIDs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	for jobID, task := range tasks {
+		pilot, pilotExists := jobs[task[0]]
+
+		if job, exists := p.taskStatus(jobID, task[0], task[1], pilot, pilotExists); exists {
+			jobs[jobID] = job
+		}
+	}
+
+	// the pilots are not part of the result.
+	for _, pilotID := range pilotIDs {
+		delete(jobs, pilotID)
+	}
+
+	return jobs, nil
+}
+
+// Capacity reports the resources of the Slurm cluster, since the pilots are drawn from it.
+func (p *Pilot) Capacity() (capacity corev1.ResourceList, allocatable corev1.ResourceList, err error) {
+	return slurm.Scheduler{}.Capacity()
+}
+
+func (p *Pilot) Ping() error {
+	return slurm.Scheduler{}.Ping()
+}
+
+func (p *Pilot) IDType() slurm.JobIDType {
+	return slurm.JobIDTypeSlurm
+}
+
+// IsPilotTask returns true if the job id refers to a task within a pilot. Such ids are not known to Slurm,
+// and cannot be used in the dependencies of other jobs.
+func IsPilotTask(jobID string) bool {
+	_, _, isTask := parseTaskID(jobID)
+
+	return isTask
+}
+
+/*---------------------------------------------------
+ * Placement
+ *---------------------------------------------------*/
+
+// bestFit returns the active pilot with the least free cpus that can hold the request, if any.
+func (p *Pilot) bestFit(request taskRequest) *pilotJob {
+	var (
+		best     *pilotJob
+		bestFree int64
+	)
+
+	for _, pilot := range p.pilots {
+		if pilot.State.IsTerminal() {
+			continue
+		}
+
+		cpus, memory := p.free(pilot)
+		if cpus < request.CPUs || memory < request.MemoryMB {
+			continue
+		}
+
+		if best == nil || cpus < bestFree {
+			best, bestFree = pilot, cpus
+		}
+	}
+
+	return best
+}
+
+// allocationDirectives are the directives that select where and how a job runs. A script can only be placed
+// in a pilot if the pilots have been submitted with the same values.
+var allocationDirectives = []string{
+	"account", "partition", "qos", "reservation", "constraint", "gres", "gpus-per-node", "licenses", "exclusive",
+}
+
+// compatible returns true if the allocation directives of the script are satisfied by the pilots.
+func (p *Pilot) compatible(directives map[string]string) bool {
+	pilotDirectives := make(map[string]string, len(p.Flags))
+
+	for _, flag := range p.Flags {
+		key, value, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		pilotDirectives[key] = value
+	}
+
+	for _, key := range allocationDirectives {
+		value, requested := directives[key]
+		if !requested {
+			continue
+		}
+
+		if pilotValue, exists := pilotDirectives[key]; !exists || pilotValue != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withinTimeLimit returns true if the time limit of the request does not exceed the time limit of the pilots.
+// Pilots without a time limit get the default of their partition, which is not known, and accept any request.
+func (p *Pilot) withinTimeLimit(request taskRequest) bool {
+	if request.TimeLimit < 0 {
+		return false
+	}
+
+	for _, flag := range p.Flags {
+		if limit, isTime := strings.CutPrefix(flag, "--time="); isTime {
+			pilotLimit, err := slurm.ParseTimeLimit(limit)
+
+			return err != nil || request.TimeLimit <= pilotLimit
+		}
+	}
+
+	return true
+}
+
+// free returns the resources of the pilot that are not reserved by active tasks.
+func (p *Pilot) free(pilot *pilotJob) (cpus int64, memoryMB int64) {
+	cpus, memoryMB = p.CPUs, p.MemoryMB
+
+	for taskID, request := range pilot.tasks {
+		if p.hasExited(pilot.ID, strconv.Itoa(taskID)) {
+			continue
+		}
+
+		cpus -= request.CPUs
+		memoryMB -= request.MemoryMB
+	}
+
+	return cpus, memoryMB
+}
+
+// startPilot submits a new pilot. It is placed in the Pending state, and may receive tasks immediately.
+func (p *Pilot) startPilot() (*pilotJob, error) {
+	var script bytes.Buffer
+
+	if err := pilotScript.Execute(&script, struct {
+		PilotOptions
+		Dir      string
+		KillWait int64
+	}{PilotOptions: p.PilotOptions, Dir: p.dir, KillWait: int64(PilotKillWait / time.Second)}); err != nil {
+		compute.SystemPanic(err, "failed to evaluate pilot template")
+	}
+
+	scriptFile := filepath.Join(p.dir, "pilot.sh")
+
+	if err := os.WriteFile(scriptFile, script.Bytes(), 0o755); err != nil {
+		return nil, errors.Wrapf(err, "cannot write pilot script")
+	}
+
+	pilotID, err := slurm.SubmitJob(scriptFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot submit pilot")
+	}
+
+	// the agent creates the spool as well, but it may start after the first task is placed.
+	if err := os.MkdirAll(p.spoolDir(pilotID), 0o755); err != nil {
+		return nil, errors.Wrapf(err, "cannot create spool for pilot '%s'", pilotID)
+	}
+
+	pilot := &pilotJob{
+		ID:    pilotID,
+		State: slurm.JobStatePending,
+		tasks: make(map[int]taskRequest),
+	}
+
+	p.pilots[pilotID] = pilot
+
+	compute.DefaultLogger.Info("[Pilot] New pilot has been submitted", "pilot", pilotID, "cpus", p.CPUs, "memoryMB", p.MemoryMB)
+
+	return pilot, nil
+}
+
+/*---------------------------------------------------
+ * Lifecycle of the pilots
+ *---------------------------------------------------*/
+
+// sync refreshes the state of the pilots, forgets those that have terminated,
+// and releases those that have been idle for longer than the IdleTimeout.
+func (p *Pilot) sync(now time.Time) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	pilotIDs := make([]string, 0, len(p.pilots))
+	for pilotID := range p.pilots {
+		pilotIDs = append(pilotIDs, pilotID)
+	}
+
+	if len(pilotIDs) == 0 {
+		return nil
+	}
+
+	jobs, err := slurm.QueryJobs(pilotIDs...)
+	if err != nil {
+		return err
+	}
+
+	for _, pilotID := range pilotIDs {
+		pilot := p.pilots[pilotID]
+
+		job, exists := jobs[pilotID]
+		if !exists || job.State.IsTerminal() {
+			// the spool is kept, since it holds the exit codes of the tasks.
+			compute.DefaultLogger.Info("[Pilot] Pilot has terminated", "pilot", pilotID, "state", job.State)
+
+			delete(p.pilots, pilotID)
+
+			continue
+		}
+
+		pilot.State = job.State
+
+		if cpus, _ := p.free(pilot); cpus < p.CPUs {
+			pilot.idleSince = time.Time{}
+
+			continue
+		}
+
+		if pilot.idleSince.IsZero() {
+			pilot.idleSince = now
+
+			continue
+		}
+
+		if now.Sub(pilot.idleSince) < p.IdleTimeout {
+			continue
+		}
+
+		if out, err := slurm.CancelJob(pilotID); err != nil && !errors.Is(err, slurm.ErrInvalidJob) {
+			compute.DefaultLogger.Error(err, "Unable to release idle pilot", "pilot", pilotID, "out", out)
+
+			continue
+		}
+
+		delete(p.pilots, pilotID)
+
+		// every task has exited, and its pod is resolved through its own control files.
+		if err := os.RemoveAll(p.spoolDir(pilotID)); err != nil {
+			compute.DefaultLogger.Error(err, "Unable to remove the spool of the pilot", "pilot", pilotID)
+		}
+
+		compute.DefaultLogger.Info("[Pilot] Idle pilot has been released", "pilot", pilotID, "idle", now.Sub(pilot.idleSince))
+	}
+
+	return nil
+}
+
+// recover resumes the pilots that are still active, from their spool directories.
+func (p *Pilot) recover() error {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return err
+	}
+
+	var pilotIDs []string
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			pilotIDs = append(pilotIDs, entry.Name())
+		}
+	}
+
+	if len(pilotIDs) == 0 {
+		return nil
+	}
+
+	jobs, err := slurm.QueryJobs(pilotIDs...)
+	if err != nil {
+		return err
+	}
+
+	for _, pilotID := range pilotIDs {
+		job, exists := jobs[pilotID]
+		if !exists || job.State.IsTerminal() {
+			continue
+		}
+
+		pilot := &pilotJob{
+			ID:    pilotID,
+			State: job.State,
+			tasks: make(map[int]taskRequest),
+		}
+
+		scripts, err := filepath.Glob(filepath.Join(p.spoolDir(pilotID), "*.sh"))
+		if err != nil {
+			return err
+		}
+
+		for _, script := range scripts {
+			taskID, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(script), ".sh"))
+			if err != nil {
+				continue
+			}
+
+			directives, err := parseBatchDirectives(script)
+			if err != nil {
+				return errors.Wrapf(err, "cannot parse script '%s'", script)
+			}
+
+			pilot.tasks[taskID] = parseTaskRequest(directives)
+		}
+
+		p.pilots[pilotID] = pilot
+
+		compute.DefaultLogger.Info("[Pilot] Pilot has been recovered", "pilot", pilotID, "tasks", len(pilot.tasks))
+	}
+
+	return nil
+}
+
+/*---------------------------------------------------
+ * Files of the agent
+ *---------------------------------------------------*/
+
+func (p *Pilot) spoolDir(pilotID string) string {
+	return filepath.Join(p.dir, pilotID)
+}
+
+func (p *Pilot) taskFile(pilotID string, taskID string, ext string) string {
+	return filepath.Join(p.spoolDir(pilotID), taskID+"."+ext)
+}
+
+func (p *Pilot) hasExited(pilotID string, taskID string) bool {
+	_, err := os.Stat(p.taskFile(pilotID, taskID, "exit"))
+
+	return err == nil
+}
+
+// request asks the agent to signal the task. It returns slurm.ErrInvalidJob if the task is unknown, or has exited.
+func (p *Pilot) request(pilotID string, taskID string, kind string) error {
+	if _, err := os.Stat(p.taskFile(pilotID, taskID, "sh")); err != nil || p.hasExited(pilotID, taskID) {
+		return slurm.ErrInvalidJob
+	}
+
+	if err := os.WriteFile(p.taskFile(pilotID, taskID, kind), nil, 0o644); err != nil {
+		return errors.Wrapf(err, "cannot request %s of task '%s.%s'", kind, pilotID, taskID)
+	}
+
+	return nil
+}
+
+// taskStatus resolves the state of a task, given the state of its pilot.
+func (p *Pilot) taskStatus(jobID, pilotID, taskID string, pilot slurm.JobInfo, pilotExists bool) (slurm.JobInfo, bool) {
+	if _, err := os.Stat(p.taskFile(pilotID, taskID, "sh")); err != nil {
+		return slurm.JobInfo{}, false
+	}
+
+	if raw, err := os.ReadFile(p.taskFile(pilotID, taskID, "exit")); err == nil {
+		// the task has been stopped by the agent, due to its time limit.
+		if _, err := os.Stat(p.taskFile(pilotID, taskID, "timeout")); err == nil {
+			return slurm.JobInfo{JobID: jobID, State: slurm.JobStateTimeout, Reason: "TimeLimit"}, true
+		}
+
+		return exitedTask(jobID, strings.TrimSpace(string(raw))), true
+	}
+
+	switch {
+	case !pilotExists:
+		// the pilot has been purged without the task reporting an exit code.
+		return slurm.JobInfo{JobID: jobID, State: slurm.JobStateCancelled, Reason: "PilotTerminated"}, true
+
+	case pilot.State.IsTerminal():
+		// the task has been killed along with its pilot (e.g, due to timeout or node failure).
+		return slurm.JobInfo{JobID: jobID, State: pilot.State, Reason: pilot.Reason}, true
+
+	case pilot.State.IsQueued():
+		return slurm.JobInfo{JobID: jobID, State: slurm.JobStatePending, Reason: pilot.Reason, StartTime: pilot.StartTime}, true
+
+	default:
+		if _, err := os.Stat(p.taskFile(pilotID, taskID, "pid")); err != nil {
+			return slurm.JobInfo{JobID: jobID, State: slurm.JobStatePending, Reason: "None"}, true
+		}
+
+		return slurm.JobInfo{JobID: jobID, State: slurm.JobStateRunning, Reason: "None"}, true
+	}
+}
+
+// exitedTask translates the exit code of the host script into a job state, as Slurm does.
+func exitedTask(jobID string, raw string) slurm.JobInfo {
+	job := slurm.JobInfo{JobID: jobID, State: slurm.JobStateCompleted, Reason: "None"}
+
+	exitCode, _ := strconv.Atoi(raw)
+
+	switch {
+	case exitCode > 128:
+		job.State = slurm.JobStateCancelled
+		job.Signal = exitCode - 128
+	case exitCode != 0:
+		job.State = slurm.JobStateFailed
+		job.Reason = "NonZeroExitCode"
+		job.ExitCode = exitCode
+	}
+
+	return job
+}
+
+// parseTaskID splits ids in the form '<pilot>.<task>'.
+func parseTaskID(jobID string) (pilotID string, taskID string, isTask bool) {
+	return strings.Cut(jobID, ".")
+}
+
+// parseTaskRequest extracts the resources of a task from the directives of the host script.
+func parseTaskRequest(directives map[string]string) taskRequest {
+	request := taskRequest{CPUs: 1, Nodes: 1}
+
+	if cpus, err := strconv.ParseInt(directives["ntasks-per-node"], 10, 64); err == nil && cpus > 0 {
+		request.CPUs = cpus
+	}
+
+	// the memory of the host scripts is given in megabytes.
+	if memory, err := strconv.ParseInt(strings.TrimSuffix(directives["mem"], "M"), 10, 64); err == nil && memory > 0 {
+		request.MemoryMB = memory
+	}
+
+	if nodes, err := strconv.ParseInt(directives["nodes"], 10, 64); err == nil && nodes > 0 {
+		request.Nodes = nodes
+	}
+
+	if limit, exists := directives["time"]; exists {
+		request.TimeLimit = -1
+
+		if parsed, err := slurm.ParseTimeLimit(limit); err == nil {
+			request.TimeLimit = parsed
+		}
+	}
+
+	return request
+}
+
+// deadlineSeconds is the content of the <n>.deadline file of the agent.
+func deadlineSeconds(deadline time.Duration) []byte {
+	return []byte(strconv.FormatInt(int64(math.Ceil(deadline.Seconds())), 10))
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0o755); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// PilotKillWait is how long the agent waits for a task to exit after its time limit, before killing it.
+// It matches the default KillWait of Slurm.
+const PilotKillWait = 30 * time.Second
+
+/*
+pilotScript is the batch script of the pilots. The agent runs the tasks that the scheduler places in the spool of
+the pilot. For every task <n>, the scheduler writes the host script <n>.sh, optionally its time limit in seconds
+in <n>.deadline, and optionally the requests <n>.term and <n>.cancel. The agent announces the process of the task
+in <n>.pid, and its exit code in <n>.exit. Tasks that exceed their time limit are marked with <n>.timeout.
+*/
+var pilotScript = template.Must(template.New("pilot").Parse(`#!/bin/bash
+#SBATCH --job-name=hpk-pilot
+#SBATCH --output={{.Dir}}/pilot-%j.log
+#SBATCH --nodes=1
+#SBATCH --ntasks=1
+#SBATCH --cpus-per-task={{.CPUs}}
+#SBATCH --mem={{.MemoryMB}}
+#SBATCH --no-requeue
+{{- range .Flags}}
+#SBATCH {{.}}
+{{- end}}
+
+spool={{.Dir}}/${SLURM_JOB_ID}
+mkdir -p ${spool} && cd ${spool} || exit 1
+
+shopt -s nullglob
+
+declare -A launched
+
+# directive prints the value of an #SBATCH directive of the script.
+directive() {
+	sed -n "s/^#SBATCH --$2=\([^ ]*\).*/\1/p" $1 | tail -n 1
+}
+
+# launch runs the host script in a new session, so that it can be killed as a group.
+launch() {
+	local task=$1
+
+	local output=$(directive ${task}.sh output)
+	local error=$(directive ${task}.sh error)
+
+	SLURM_JOB_NAME=$(directive ${task}.sh job-name) setsid bash ${task}.sh >> ${output:-/dev/null} 2>> ${error:-/dev/null} &
+
+	local pid=$!
+	echo ${pid} > ${task}.pid.tmp && mv ${task}.pid.tmp ${task}.pid
+
+	wait ${pid}
+	echo $? > ${task}.exit.tmp && mv ${task}.exit.tmp ${task}.exit
+}
+
+echo "[Pilot] Agent of pilot ${SLURM_JOB_ID} is running on $(hostname)"
+
+while true; do
+	# requests for tasks that have not announced their process yet are handled in the next round.
+	for request in *.cancel *.term; do
+		task=${request%.*}
+
+		if [[ -f ${task}.exit ]]; then
+			rm -f ${request}
+		elif [[ -f ${task}.pid ]]; then
+			if [[ ${request} == *.cancel ]]; then
+				kill -KILL -- -$(cat ${task}.pid) 2>/dev/null
+			else
+				kill -TERM $(cat ${task}.pid) 2>/dev/null
+			fi
+			mv ${request} ${request}.done
+		elif [[ -z ${launched[${task}]:-} ]]; then
+			# the task is dropped before starting.
+			launched[${task}]=1
+			echo 143 > ${task}.exit
+			mv ${request} ${request}.done
+		fi
+	done
+
+	# tasks that exceed their time limit are terminated, and killed after the KillWait, as Slurm does.
+	for deadline in *.deadline; do
+		task=${deadline%.deadline}
+
+		if [[ -f ${task}.exit || ! -f ${task}.pid ]]; then
+			continue
+		fi
+
+		elapsed=$(( $(date +%s) - $(stat -c %Y ${task}.pid) ))
+		limit=$(cat ${deadline})
+
+		if (( elapsed >= limit + {{.KillWait}} )); then
+			kill -KILL -- -$(cat ${task}.pid) 2>/dev/null
+		elif (( elapsed >= limit )) && [[ ! -f ${task}.timeout ]]; then
+			echo "[Pilot] Task ${task} has reached its time limit"
+			touch ${task}.timeout
+			kill -TERM $(cat ${task}.pid) 2>/dev/null
+		fi
+	done
+
+	for script in *.sh; do
+		task=${script%.sh}
+
+		if [[ -n ${launched[${task}]:-} || -f ${task}.exit ]]; then
+			continue
+		fi
+
+		launched[${task}]=1
+
+		echo "[Pilot] Starting task ${task}"
+		launch ${task} &
+	done
+
+	sleep 1
+done
+`))
@@ -0,0 +1,294 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/pkg/errors"
+)
+
+// fakeSlurm runs the batch scripts as local processes, in place of a Slurm cluster.
+type fakeSlurm struct {
+	slurm.CLI
+
+	lock   sync.Mutex
+	jobs   map[string]*exec.Cmd
+	states map[string]slurm.JobState
+}
+
+func useFakeSlurm(t *testing.T) *fakeSlurm {
+	fake := &fakeSlurm{jobs: make(map[string]*exec.Cmd), states: make(map[string]slurm.JobState)}
+
+	previous := slurm.Slurm.Client
+	slurm.Slurm.Client = fake
+
+	t.Cleanup(func() {
+		slurm.Slurm.Client = previous
+
+		for jobID := range fake.jobs {
+			_, _ = fake.CancelJob(jobID)
+		}
+	})
+
+	return fake
+}
+
+func (f *fakeSlurm) SubmitJob(scriptFile string) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	jobID := strconv.Itoa(1000 + len(f.jobs))
+
+	cmd := exec.Command("bash", scriptFile)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Env = append(os.Environ(), "SLURM_JOB_ID="+jobID)
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	f.jobs[jobID] = cmd
+	f.states[jobID] = slurm.JobStateRunning
+
+	go func() {
+		_ = cmd.Wait()
+
+		f.lock.Lock()
+		defer f.lock.Unlock()
+
+		if f.states[jobID] == slurm.JobStateRunning {
+			f.states[jobID] = slurm.JobStateCompleted
+		}
+	}()
+
+	return jobID, nil
+}
+
+func (f *fakeSlurm) CancelJob(jobID string) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	cmd, exists := f.jobs[jobID]
+	if !exists || f.states[jobID] != slurm.JobStateRunning {
+		return "", slurm.ErrInvalidJob
+	}
+
+	f.states[jobID] = slurm.JobStateCancelled
+
+	return "", syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func (f *fakeSlurm) QueryJobs(jobIDs ...string) (map[string]slurm.JobInfo, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	jobs := make(map[string]slurm.JobInfo)
+
+	for _, jobID := range jobIDs {
+		if state, exists := f.states[jobID]; exists {
+			jobs[jobID] = slurm.JobInfo{JobID: jobID, State: state, Reason: "None"}
+		}
+	}
+
+	return jobs, nil
+}
+
+func (f *fakeSlurm) state(jobID string) slurm.JobState {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.states[jobID]
+}
+
+func TestPilot(t *testing.T) {
+	fake := useFakeSlurm(t)
+
+	pilot, err := scheduler.NewPilot(filepath.Join(t.TempDir(), "pilots"), scheduler.PilotOptions{
+		CPUs:         4,
+		MemoryMB:     1024,
+		MaxPilots:    1,
+		IdleTimeout:  time.Second,
+		SyncInterval: 100 * time.Millisecond,
+		Flags:        []string{"--time=01:00:00"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := "#SBATCH --ntasks-per-node=2\n#SBATCH --mem=256\n"
+
+	t.Run("bin-packing", func(t *testing.T) {
+		dir := t.TempDir()
+
+		first, err := pilot.Submit(writeScript(t, dir, request+"sleep 2; echo hello from $SLURM_JOB_NAME"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second, err := pilot.Submit(writeScript(t, t.TempDir(), request+"sleep 2; exit 3"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the pilot is full, so the third script is submitted as a regular job.
+		third, err := pilot.Submit(writeScript(t, t.TempDir(), request+"sleep 2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		firstPilot, _, _ := strings.Cut(first, ".")
+		secondPilot, _, _ := strings.Cut(second, ".")
+
+		if !strings.Contains(first, ".") || firstPilot != secondPilot {
+			t.Errorf("expected tasks of the same pilot, got '%s' and '%s'", first, second)
+		}
+
+		if strings.Contains(third, ".") {
+			t.Errorf("expected regular job, got '%s'", third)
+		}
+
+		waitForState(t, pilot, first, slurm.JobStateCompleted)
+
+		if job := waitForState(t, pilot, second, slurm.JobStateFailed); job.ExitCode != 3 {
+			t.Errorf("exit code = %d, want 3", job.ExitCode)
+		}
+
+		stdout, err := os.ReadFile(filepath.Join(dir, "stdout"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.TrimSpace(string(stdout)) != "hello from mypod" {
+			t.Errorf("stdout = '%s', want 'hello from mypod'", stdout)
+		}
+	})
+
+	t.Run("incompatible directives", func(t *testing.T) {
+		jobID, err := pilot.Submit(writeScript(t, t.TempDir(), "#SBATCH --partition=gpu\ntrue"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(jobID, ".") {
+			t.Errorf("expected regular job, got '%s'", jobID)
+		}
+	})
+
+	t.Run("regular jobs", func(t *testing.T) {
+		for name, directive := range map[string]string{
+			"dependency":                "#SBATCH --dependency=afterok:1001",
+			"time limit beyond pilot":   "#SBATCH --time=0-02:00:00",
+			"time limit without bounds": "#SBATCH --time=UNLIMITED",
+		} {
+			jobID, err := pilot.Submit(writeScript(t, t.TempDir(), request+directive+"\ntrue"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(jobID, ".") {
+				t.Errorf("%s: expected regular job, got '%s'", name, jobID)
+			}
+		}
+	})
+
+	t.Run("time limit", func(t *testing.T) {
+		jobID, err := pilot.Submit(writeScript(t, t.TempDir(), request+"#SBATCH --time=0:01\nexec sleep 60"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(jobID, ".") {
+			t.Fatalf("expected task of a pilot, got '%s'", jobID)
+		}
+
+		waitForState(t, pilot, jobID, slurm.JobStateTimeout)
+	})
+
+	t.Run("update deadline", func(t *testing.T) {
+		jobID, err := pilot.Submit(writeScript(t, t.TempDir(), request+"exec sleep 60"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		waitForState(t, pilot, jobID, slurm.JobStateRunning)
+
+		if err := pilot.UpdateDeadline(jobID, time.Second); err != nil {
+			t.Fatal(err)
+		}
+
+		waitForState(t, pilot, jobID, slurm.JobStateTimeout)
+
+		if err := pilot.UpdateDeadline(jobID, time.Second); !errors.Is(err, slurm.ErrInvalidJob) {
+			t.Errorf("UpdateDeadline() error = %v, want %v", err, slurm.ErrInvalidJob)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		jobID, err := pilot.Submit(writeScript(t, t.TempDir(), request+"sleep 60"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		waitForState(t, pilot, jobID, slurm.JobStateRunning)
+
+		if _, err := pilot.Cancel(jobID); err != nil {
+			t.Fatal(err)
+		}
+
+		waitForState(t, pilot, jobID, slurm.JobStateCancelled)
+
+		if _, err := pilot.Cancel(jobID); !errors.Is(err, slurm.ErrInvalidJob) {
+			t.Errorf("Cancel() error = %v, want %v", err, slurm.ErrInvalidJob)
+		}
+	})
+
+	t.Run("release idle pilot", func(t *testing.T) {
+		jobID, err := pilot.Submit(writeScript(t, t.TempDir(), request+"true"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		waitForState(t, pilot, jobID, slurm.JobStateCompleted)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go pilot.Run(ctx)
+
+		pilotID, _, _ := strings.Cut(jobID, ".")
+
+		deadline := time.Now().Add(10 * time.Second)
+
+		for fake.state(pilotID) != slurm.JobStateCancelled {
+			if time.Now().After(deadline) {
+				t.Fatalf("idle pilot '%s' has not been released", pilotID)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+}
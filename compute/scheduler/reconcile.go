@@ -0,0 +1,248 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/carv-ics-forth/hpk/pkg/crdtools"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+/************************************************************
+
+			Reconcile Pods against Scheduler Jobs
+
+************************************************************/
+
+// PodControl provides the Reconciler with access to the local pods.
+type PodControl struct {
+	ListPods             func() ([]*corev1.Pod, error)
+	UpdateStatus         func(pod *corev1.Pod)
+	SaveToDisk           func(pod *corev1.Pod) error
+	NotifyVirtualKubelet func(pod *corev1.Pod)
+}
+
+// Reconciler periodically compares the pods against the state of their jobs, as reported by the Default scheduler.
+// It captures failures that happen before (or without) the pause writing any control files,
+// such as cancellations, timeouts, preemptions, and node failures. It also captures jobs that Slurm has
+// put back in the queue after they have started, and restarts their pods. For pods that wait in the queue,
+// it keeps the pending reason and the estimated start time of their jobs up-to-date.
+type Reconciler struct {
+	Interval time.Duration
+	Control  PodControl
+}
+
+// Run blocks until the context is cancelled.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			compute.DefaultLogger.Info("Shutting down the scheduler reconciler", "err", ctx.Err())
+
+			return
+		case <-ticker.C:
+			r.Reconcile()
+		}
+	}
+}
+
+// Reconcile runs a single reconciliation cycle.
+func (r *Reconciler) Reconcile() {
+	pods, err := r.Control.ListPods()
+	if err != nil {
+		compute.DefaultLogger.Error(err, "Scheduler reconciler failed to list pods")
+
+		return
+	}
+
+	/*---------------------------------------------------
+	 * Collect the jobs of the active pods
+	 *---------------------------------------------------*/
+	activePods := make(map[string]*corev1.Pod)
+	jobIDs := make([]string, 0, len(pods))
+
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		if !slurm.HasJobID(pod) {
+			continue
+		}
+
+		jobID := slurm.GetJobID(pod)
+
+		activePods[jobID] = pod
+		jobIDs = append(jobIDs, jobID)
+	}
+
+	if len(jobIDs) == 0 {
+		return
+	}
+
+	jobs, err := Default.Status(jobIDs...)
+	if err != nil {
+		compute.DefaultLogger.Error(err, "Scheduler reconciler failed to query jobs")
+
+		return
+	}
+
+	/*---------------------------------------------------
+	 * Resolve pods whose jobs have terminated
+	 *---------------------------------------------------*/
+	for jobID, pod := range activePods {
+		job, exists := jobs[jobID]
+		if !exists {
+			continue
+		}
+
+		if job.State == slurm.JobStatePending && job.Reason == slurm.ReasonDependencyNeverSatisfied {
+			r.failUnsatisfiedDependency(pod, jobID)
+
+			continue
+		}
+
+		if job.State.IsQueued() && hasStarted(pod) {
+			r.requeue(pod, job)
+
+			continue
+		}
+
+		if !job.State.IsTerminal() {
+			r.refreshQueueState(pod, job)
+
+			continue
+		}
+
+		// control files take precedence, since they are more accurate than the job's state.
+		r.Control.UpdateStatus(pod)
+
+		if slurm.ApplyJobState(pod, job) {
+			// persist the terminal state, so that the pod is not listed as active again.
+			if err := r.Control.SaveToDisk(pod); err != nil {
+				compute.SystemPanic(err, "failed to persist resolved pod '%s'", client.ObjectKeyFromObject(pod))
+			}
+
+			compute.DefaultLogger.Info("[Scheduler] -> Pod resolved from job state",
+				"pod", client.ObjectKeyFromObject(pod),
+				"job", jobID,
+				"state", job.State,
+				"phase", pod.Status.Phase,
+			)
+		}
+
+		r.Control.NotifyVirtualKubelet(pod)
+	}
+}
+
+// failUnsatisfiedDependency cancels a job that Slurm keeps in the queue, although its dependencies
+// can never be satisfied (e.g, afterok on a failed job), and fails the pod.
+func (r *Reconciler) failUnsatisfiedDependency(pod *corev1.Pod, jobID string) {
+	if out, err := Default.Cancel(jobID); err != nil && !errors.Is(err, slurm.ErrInvalidJob) {
+		compute.DefaultLogger.Error(err, "Scheduler reconciler failed to cancel job", "job", jobID, "out", out)
+
+		return
+	}
+
+	compute.PodError(pod, compute.ReasonDependencyNeverSatisfied, "Slurm job '%s' has dependencies that can never be satisfied", jobID)
+
+	if err := r.Control.SaveToDisk(pod); err != nil {
+		compute.SystemPanic(err, "failed to persist failed pod '%s'", client.ObjectKeyFromObject(pod))
+	}
+
+	compute.DefaultLogger.Info("[Scheduler] -> Pod failed due to unsatisfied dependencies",
+		"pod", client.ObjectKeyFromObject(pod),
+		"job", jobID,
+	)
+
+	r.Control.NotifyVirtualKubelet(pod)
+}
+
+// refreshQueueState reflects the pending reason and the estimated start time of the job on the pod.
+// Every change is persisted, and emitted as an Event.
+func (r *Reconciler) refreshQueueState(pod *corev1.Pod, job slurm.JobInfo) {
+	if !slurm.ApplyQueueState(pod, job) {
+		return
+	}
+
+	podKey := client.ObjectKeyFromObject(pod)
+
+	if err := r.Control.SaveToDisk(pod); err != nil {
+		compute.SystemPanic(err, "failed to persist queue state of pod '%s'", podKey)
+	}
+
+	if job.State.IsQueued() {
+		queued := crdtools.FindStatusCondition(pod.Status.Conditions, slurm.PodQueued)
+
+		compute.EventRecorder.Event(pod, corev1.EventTypeNormal, queued.Reason, queued.Message)
+
+		compute.DefaultLogger.Info("[Scheduler] -> Pod waiting in the queue",
+			"pod", podKey,
+			"job", job.JobID,
+			"reason", job.Reason,
+			"startTime", job.StartTime,
+		)
+	}
+
+	r.Control.NotifyVirtualKubelet(pod)
+}
+
+// hasStarted returns true if the current attempt of the pod has started running, as indicated by its ip.
+func hasStarted(pod *corev1.Pod) bool {
+	_, err := os.Stat(compute.HPK.Pod(client.ObjectKeyFromObject(pod)).IPAddressPath())
+
+	return err == nil
+}
+
+// requeue archives the control files of the previous attempt of a job that Slurm has put back in the queue
+// (e.g, due to preemption or node failure), so that they are not mistaken for those of the next attempt,
+// and returns the pod to Pending.
+func (r *Reconciler) requeue(pod *corev1.Pod, job slurm.JobInfo) {
+	podKey := client.ObjectKeyFromObject(pod)
+	attempt := slurm.GetPodAttempt(pod)
+
+	if err := compute.HPK.Pod(podKey).ArchiveControlFiles(attempt); err != nil {
+		compute.DefaultLogger.Error(err, "Scheduler reconciler failed to archive the previous attempt", "pod", podKey)
+
+		return
+	}
+
+	slurm.SetPodAttempt(pod, attempt+1)
+	slurm.ApplyRequeue(pod, job)
+
+	if err := r.Control.SaveToDisk(pod); err != nil {
+		compute.SystemPanic(err, "failed to persist requeued pod '%s'", podKey)
+	}
+
+	compute.DefaultLogger.Info("[Scheduler] -> Pod restarted due to requeued job",
+		"pod", podKey,
+		"job", job.JobID,
+		"state", job.State,
+		"reason", job.Reason,
+		"attempt", attempt+1,
+	)
+
+	r.Control.NotifyVirtualKubelet(pod)
+}
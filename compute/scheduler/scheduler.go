@@ -0,0 +1,92 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scheduler abstracts the batch system that runs the pods.
+package scheduler
+
+import (
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/carv-ics-forth/hpk/pkg/pty"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Scheduler is the batch system that executes the host scripts of the pods.
+type Scheduler interface {
+	// Submit runs the script and returns the id of the new job.
+	Submit(scriptFile string) (string, error)
+
+	// Cancel terminates the job. It returns slurm.ErrInvalidJob if the job does not exist,
+	// and slurm.ErrRety if the job cannot be cancelled at this moment.
+	Cancel(jobID string) (string, error)
+
+	// Status returns the state of the given jobs. Unknown jobs are omitted from the result.
+	Status(jobIDs ...string) (map[string]slurm.JobInfo, error)
+
+	// Capacity returns the total and the allocatable resources of the scheduler.
+	Capacity() (capacity corev1.ResourceList, allocatable corev1.ResourceList, err error)
+
+	// Ping returns an error if the scheduler is not responding.
+	Ping() error
+
+	// IDType is the prefix used to record the job ids on the pods.
+	IDType() slurm.JobIDType
+}
+
+// ArrayScheduler is implemented by schedulers that can coalesce the pods of an Indexed Job into a single submission.
+type ArrayScheduler interface {
+	// SubmitArrayTask submits the script as the task 'index' of the array 'group', and returns the id of the task.
+	SubmitArrayTask(group string, index int, scriptFile string) (string, error)
+}
+
+// DeadlineScheduler is implemented by schedulers that can change the time limit of an active job.
+type DeadlineScheduler interface {
+	// UpdateDeadline sets the maximum lifetime of the job, counting from its start.
+	UpdateDeadline(jobID string, deadline time.Duration) error
+}
+
+// GracefulScheduler is implemented by schedulers that can ask a job to terminate, before cancelling it.
+type GracefulScheduler interface {
+	// Terminate sends SIGTERM to the job. It returns the same errors as Cancel.
+	Terminate(jobID string) (string, error)
+}
+
+// AccountingScheduler is implemented by schedulers that keep records of the resources consumed by their jobs.
+type AccountingScheduler interface {
+	// Accounting returns the resource usage of the job. It returns slurm.ErrInvalidJob if the job is unknown.
+	Accounting(jobID string) (slurm.Accounting, error)
+}
+
+// InteractiveScheduler is implemented by schedulers that can run a job on a pseudo-terminal,
+// for pods whose containers expect a tty on their stdin.
+type InteractiveScheduler interface {
+	// SubmitInteractive runs the script on a pseudo-terminal whose output is appended to logFile,
+	// and returns the id of the new job along with the terminal.
+	SubmitInteractive(scriptFile string, logFile string) (string, *pty.Terminal, error)
+}
+
+// Default is the scheduler used for running the pods.
+var Default Scheduler = slurm.Scheduler{}
+
+const (
+	// BackendSlurm submits the pods as Slurm jobs.
+	BackendSlurm = "slurm"
+
+	// BackendLocal runs the pods as processes on the host of the kubelet.
+	BackendLocal = "local"
+
+	// BackendPilot packs the pods into long-lived Slurm allocations.
+	BackendPilot = "pilot"
+)
@@ -0,0 +1,182 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+)
+
+/************************************************************
+
+			Accounting of Completed Jobs
+
+************************************************************/
+
+// Accounting summarizes the resources that a job has consumed, as recorded by the Slurm accounting.
+type Accounting struct {
+	JobID string
+
+	State JobState
+
+	// ExitCode and Signal are those of the batch script.
+	ExitCode int
+	Signal   int
+
+	// Elapsed is the wall-clock time of the job.
+	Elapsed time.Duration
+
+	// NodeList is the nodes of the allocation, in the compressed form of Slurm (e.g, "node[01-04]").
+	NodeList string
+
+	// MaxRSS is the highest resident set size among the steps of the job, in bytes.
+	MaxRSS int64
+}
+
+// QueryAccounting returns the accounting of the job through the configured Slurm client.
+func QueryAccounting(jobID string) (Accounting, error) {
+	return Slurm.Client.QueryAccounting(jobID)
+}
+
+// QueryAccounting resolves the accounting of the job and its steps through sacct.
+// It returns ErrInvalidJob if the job is unknown to the accounting.
+func (CLI) QueryAccounting(jobID string) (Accounting, error) {
+	out, err := process.Execute(Slurm.AccountingCmd, "--noheader", "--parsable2",
+		"--jobs="+jobID,
+		"--format=JobID,State,ExitCode,Elapsed,NodeList,MaxRSS",
+	)
+	if err != nil {
+		return Accounting{}, errors.Wrapf(err, "sacct has failed. out: '%s'", out)
+	}
+
+	return parseJobAccounting(jobID, string(out))
+}
+
+// parseJobAccounting parses lines in the format "JobID|State|ExitCode:Signal|Elapsed|NodeList|MaxRSS".
+// The line of the allocation provides the state, and the lines of the steps (e.g, 1001.batch, 1001.0)
+// provide the memory usage.
+func parseJobAccounting(jobID string, out string) (Accounting, error) {
+	var (
+		accounting Accounting
+		found      bool
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), "|")
+		if len(fields) != 6 {
+			continue
+		}
+
+		if maxRSS := parseMemory(fields[5]); maxRSS > accounting.MaxRSS {
+			accounting.MaxRSS = maxRSS
+		}
+
+		if fields[0] != jobID {
+			continue
+		}
+
+		found = true
+
+		accounting.JobID = jobID
+		accounting.State = parseJobState(fields[1])
+
+		exitCode, signal, _ := strings.Cut(fields[2], ":")
+		accounting.ExitCode, _ = strconv.Atoi(exitCode)
+		accounting.Signal, _ = strconv.Atoi(signal)
+
+		accounting.Elapsed = parseElapsed(fields[3])
+		accounting.NodeList = fields[4]
+	}
+
+	if !found {
+		return Accounting{}, errors.Wrapf(ErrInvalidJob, "job '%s' is not in the accounting", jobID)
+	}
+
+	return accounting, nil
+}
+
+// parseElapsed parses durations in the format "[DD-[HH:]]MM:SS" (e.g, "1-02:03:04", "02:03:04", "03:04").
+// Invalid durations are returned as zero.
+func parseElapsed(raw string) time.Duration {
+	var days int
+
+	raw = strings.TrimSpace(raw)
+
+	if d, rest, found := strings.Cut(raw, "-"); found {
+		var err error
+		if days, err = strconv.Atoi(d); err != nil {
+			return 0
+		}
+
+		raw = rest
+	}
+
+	parts := strings.Split(raw, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0
+	}
+
+	var seconds int
+
+	for _, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+
+		seconds = seconds*60 + value
+	}
+
+	return time.Duration(days)*24*time.Hour + time.Duration(seconds)*time.Second
+}
+
+// parseMemory parses the memory sizes of sacct (e.g, "1234K", "1.5G"), which use binary units.
+// Sizes without unit are given in bytes. Invalid sizes are returned as zero.
+func parseMemory(raw string) int64 {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0
+	}
+
+	multiplier := 1.0
+
+	switch raw[len(raw)-1] {
+	case 'K':
+		multiplier = 1 << 10
+	case 'M':
+		multiplier = 1 << 20
+	case 'G':
+		multiplier = 1 << 30
+	case 'T':
+		multiplier = 1 << 40
+	}
+
+	if multiplier > 1 {
+		raw = raw[:len(raw)-1]
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0
+	}
+
+	return int64(value * multiplier)
+}
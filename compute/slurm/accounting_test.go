@@ -0,0 +1,124 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseJobAccounting(t *testing.T) {
+	tests := []struct {
+		name    string
+		jobID   string
+		out     string
+		want    Accounting
+		wantErr bool
+	}{
+		{
+			name:  "completed job with steps",
+			jobID: "1001",
+			out: `1001|COMPLETED|0:0|00:01:05|node[01-02]|
+1001.batch|COMPLETED|0:0|00:01:05|node01|2048K
+1001.extern|COMPLETED|0:0|00:01:05|node[01-02]|0
+1001.0|COMPLETED|0:0|00:01:02|node[01-02]|1.5G
+`,
+			want: Accounting{
+				JobID:    "1001",
+				State:    JobStateCompleted,
+				Elapsed:  65 * time.Second,
+				NodeList: "node[01-02]",
+				MaxRSS:   3 << 29,
+			},
+		},
+		{
+			name:  "cancelled task of job array",
+			jobID: "2000_3",
+			out: `2000_3|CANCELLED by 1000|0:15|1-02:00:00|node03|
+2000_3.batch|CANCELLED|0:15|1-02:00:00|node03|512M
+`,
+			want: Accounting{
+				JobID:    "2000_3",
+				State:    JobStateCancelled,
+				Signal:   15,
+				Elapsed:  26 * time.Hour,
+				NodeList: "node03",
+				MaxRSS:   512 << 20,
+			},
+		},
+		{
+			name:    "unknown job",
+			jobID:   "1002",
+			out:     "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJobAccounting(tt.jobID, tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJobAccounting() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("parseJobAccounting() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseElapsed(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want time.Duration
+	}{
+		{raw: "03:04", want: 3*time.Minute + 4*time.Second},
+		{raw: "02:03:04", want: 2*time.Hour + 3*time.Minute + 4*time.Second},
+		{raw: "1-02:03:04", want: 26*time.Hour + 3*time.Minute + 4*time.Second},
+		{raw: "INVALID", want: 0},
+		{raw: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := parseElapsed(tt.raw); got != tt.want {
+				t.Errorf("parseElapsed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseMemory(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want int64
+	}{
+		{raw: "", want: 0},
+		{raw: "0", want: 0},
+		{raw: "4096", want: 4096},
+		{raw: "2048K", want: 2 << 20},
+		{raw: "1.5G", want: 3 << 29},
+		{raw: "invalid", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := parseMemory(tt.raw); got != tt.want {
+				t.Errorf("parseMemory() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/pkg/errors"
+)
+
+/************************************************************
+
+			Coalesce Indexed Jobs into Job Arrays
+
+************************************************************/
+
+// arrayTask is a script that waits to be submitted as a task of a job array.
+type arrayTask struct {
+	index      int
+	scriptFile string
+	result     chan arraySubmission
+}
+
+type arraySubmission struct {
+	jobID string
+	err   error
+}
+
+// arrayBatch holds the tasks of a group that arrived within the same submission window.
+type arrayBatch struct {
+	tasks map[int]*arrayTask
+}
+
+var arrays = struct {
+	sync.Mutex
+	batches map[string]*arrayBatch
+}{
+	batches: make(map[string]*arrayBatch),
+}
+
+// SubmitArrayTask submits the script as the task 'index' of a job array.
+// Scripts of the same group that arrive within Slurm.ArrayWindow are coalesced into a single
+// 'sbatch --array' submission. The call blocks until the array is submitted, and returns the id
+// of the task (e.g, 1001_4).
+func SubmitArrayTask(group string, index int, scriptFile string) (string, error) {
+	if Slurm.ArrayWindow <= 0 {
+		return SubmitJob(scriptFile)
+	}
+
+	task := &arrayTask{
+		index:      index,
+		scriptFile: scriptFile,
+		result:     make(chan arraySubmission, 1),
+	}
+
+	arrays.Lock()
+
+	batch, exists := arrays.batches[group]
+	if exists && batch.tasks[index] != nil {
+		arrays.Unlock()
+
+		// the index is retried (e.g, by backoffLimitPerIndex) before the previous attempt is submitted.
+		arrayJobID, err := submitArray(group, []*arrayTask{task})
+		if err != nil {
+			return "", err
+		}
+
+		return ArrayTaskID(arrayJobID, index), nil
+	}
+
+	if !exists {
+		batch = &arrayBatch{tasks: make(map[int]*arrayTask)}
+		arrays.batches[group] = batch
+
+		time.AfterFunc(Slurm.ArrayWindow, func() { flushArray(group, batch) })
+	}
+
+	batch.tasks[index] = task
+
+	arrays.Unlock()
+
+	res := <-task.result
+
+	return res.jobID, res.err
+}
+
+// ArrayTaskID returns the id that Slurm uses for a task of a job array.
+//
+// Every pod keeps the id of its own task, so the state of the task is resolved per pod by the scheduler
+// reconciler, which lists the tasks of arrays individually (squeue --array). The events listener needs no
+// changes, since every task writes the control files of its own pod.
+func ArrayTaskID(arrayJobID string, index int) string {
+	return arrayJobID + "_" + strconv.Itoa(index)
+}
+
+func flushArray(group string, batch *arrayBatch) {
+	arrays.Lock()
+	if arrays.batches[group] == batch {
+		delete(arrays.batches, group)
+	}
+	arrays.Unlock()
+
+	tasks := make([]*arrayTask, 0, len(batch.tasks))
+	for _, task := range batch.tasks {
+		tasks = append(tasks, task)
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].index < tasks[j].index })
+
+	for _, tasks := range splitByDirectives(tasks) {
+		arrayJobID, err := submitArray(group, tasks)
+
+		compute.DefaultLogger.Info("[Slurm] Job array has been submitted",
+			"group", group,
+			"tasks", len(tasks),
+			"job", arrayJobID,
+			"err", err,
+		)
+
+		for _, task := range tasks {
+			if err != nil {
+				task.result <- arraySubmission{err: err}
+			} else {
+				task.result <- arraySubmission{jobID: ArrayTaskID(arrayJobID, task.index)}
+			}
+		}
+	}
+}
+
+// splitByDirectives partitions the tasks into job arrays of tasks with identical directives, since the
+// directives of a job array apply to all of its tasks. Pods of the same template may still differ
+// (e.g, in the time limit or the dependencies given by their annotations).
+func splitByDirectives(tasks []*arrayTask) [][]*arrayTask {
+	var keys []string
+
+	batches := make(map[string][]*arrayTask)
+
+	for _, task := range tasks {
+		shared, err := sharedDirectives(task.scriptFile)
+
+		key := strings.Join(shared, "\n")
+		if err != nil {
+			// the error is reported by the submission of the task.
+			key = "\x00" + task.scriptFile
+		}
+
+		if _, exists := batches[key]; !exists {
+			keys = append(keys, key)
+		}
+
+		batches[key] = append(batches[key], task)
+	}
+
+	split := make([][]*arrayTask, 0, len(keys))
+	for _, key := range keys {
+		split = append(split, batches[key])
+	}
+
+	return split
+}
+
+// sharedDirectives returns the directives of the script that apply to the whole job array.
+func sharedDirectives(scriptFile string) ([]string, error) {
+	script, err := os.ReadFile(scriptFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read script '%s'", scriptFile)
+	}
+
+	var shared []string
+
+	for _, directive := range scanDirectives(string(script)) {
+		if !arrayDirectives[directive.Option] {
+			shared = append(shared, directive.Line)
+		}
+	}
+
+	return shared, nil
+}
+
+// submitArray submits a wrapper script that dispatches every array task to the script of its pod.
+func submitArray(group string, tasks []*arrayTask) (string, error) {
+	script, err := buildArrayScript(group, tasks)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot build array script for '%s'", group)
+	}
+
+	f, err := os.CreateTemp(compute.HPK.String(), ".array-"+group+"-*.sh")
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot create array script for '%s'", group)
+	}
+
+	// Slurm keeps a copy of the script, so it can be removed once the array is submitted.
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(script); err != nil {
+		f.Close()
+
+		return "", errors.Wrapf(err, "cannot write array script '%s'", f.Name())
+	}
+
+	if err := f.Close(); err != nil {
+		return "", errors.Wrapf(err, "cannot write array script '%s'", f.Name())
+	}
+
+	return SubmitJob(f.Name())
+}
+
+// arrayDirectives are set by the wrapper, and are therefore dropped from the directives of the tasks.
+var arrayDirectives = map[string]bool{
+	"job-name": true,
+	"output":   true,
+	"error":    true,
+	"array":    true,
+}
+
+// buildArrayScript generates the wrapper script of a job array. The tasks must have identical directives,
+// as given by splitByDirectives.
+func buildArrayScript(group string, tasks []*arrayTask) ([]byte, error) {
+	if len(tasks) == 0 {
+		return nil, errors.New("empty job array")
+	}
+
+	indices := make([]string, 0, len(tasks))
+	dispatch := bytes.Buffer{}
+
+	var shared []string
+
+	for i, task := range tasks {
+		script, err := os.ReadFile(task.scriptFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read script '%s'", task.scriptFile)
+		}
+
+		directives := scanDirectives(string(script))
+
+		options := make(map[string]string)
+
+		var taskShared []string
+
+		for _, directive := range directives {
+			options[directive.Option] = directive.Value
+
+			if !arrayDirectives[directive.Option] {
+				taskShared = append(taskShared, directive.Line)
+			}
+		}
+
+		if i == 0 {
+			shared = taskShared
+		} else if !slices.Equal(shared, taskShared) {
+			return nil, errors.Errorf("task '%d' has different directives than the rest of the array", task.index)
+		}
+
+		indices = append(indices, strconv.Itoa(task.index))
+
+		fmt.Fprintf(&dispatch, "%d)\n\tSLURM_JOB_NAME=%s exec bash %s >> %s 2>> %s\n\t;;\n",
+			task.index,
+			shellQuote(options["job-name"]),
+			shellQuote(task.scriptFile),
+			shellQuote(valueOr(options["output"], os.DevNull)),
+			shellQuote(valueOr(options["error"], os.DevNull)),
+		)
+	}
+
+	script := bytes.Buffer{}
+
+	script.WriteString("#!/bin/bash\n")
+	fmt.Fprintf(&script, "#SBATCH --job-name=%s\n", group)
+	fmt.Fprintf(&script, "#SBATCH --array=%s\n", strings.Join(indices, ","))
+	fmt.Fprintf(&script, "#SBATCH --output=%s\n", os.DevNull)
+	fmt.Fprintf(&script, "#SBATCH --error=%s\n", os.DevNull)
+
+	for _, line := range shared {
+		script.WriteString(line + "\n")
+	}
+
+	script.WriteString("\ncase \"${SLURM_ARRAY_TASK_ID}\" in\n")
+	script.Write(dispatch.Bytes())
+	script.WriteString("esac\n\n")
+	script.WriteString("echo \"[HOST] unknown array task ${SLURM_ARRAY_TASK_ID}\" >&2\n")
+	script.WriteString("exit 1\n")
+
+	return script.Bytes(), nil
+}
+
+// batchDirective is an '#SBATCH' line of a script.
+type batchDirective struct {
+	Option   string
+	Value    string
+	HasValue bool
+	Line     string
+}
+
+// scanDirectives returns the '#SBATCH' directives of the script, in both '--opt=value' and '--opt value' forms.
+func scanDirectives(script string) []batchDirective {
+	var directives []batchDirective
+
+	scanner := bufio.NewScanner(strings.NewReader(script))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if !strings.HasPrefix(line, "#SBATCH") {
+			continue
+		}
+
+		tokens := strings.Fields(strings.TrimPrefix(line, "#SBATCH"))
+		if len(tokens) == 0 {
+			continue
+		}
+
+		option, value, hasValue := strings.Cut(strings.TrimPrefix(tokens[0], "--"), "=")
+		if !hasValue && len(tokens) > 1 && !strings.HasPrefix(tokens[1], "#") {
+			value, hasValue = tokens[1], true
+		}
+
+		directives = append(directives, batchDirective{
+			Option:   option,
+			Value:    value,
+			HasValue: hasValue,
+			Line:     line,
+		})
+	}
+
+	return directives
+}
+
+// expandArrayIndices expands the task expressions of Slurm (e.g, "0,3,5-7:2%10") into a list of indices.
+func expandArrayIndices(expr string) []int {
+	var indices []int
+
+	// drop the limit of simultaneously running tasks.
+	expr, _, _ = strings.Cut(expr, "%")
+
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, ":")
+
+		step := 1
+		if hasStep {
+			if s, err := strconv.Atoi(stepExpr); err == nil && s > 0 {
+				step = s
+			}
+		}
+
+		first, last, isRange := strings.Cut(rangeExpr, "-")
+
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			continue
+		}
+
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil {
+				continue
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			indices = append(indices, i)
+		}
+	}
+
+	return indices
+}
+
+func valueOr(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
+
+// shellQuote quotes the value for bash.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
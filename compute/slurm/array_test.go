@@ -0,0 +1,225 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
+)
+
+// recordingClient keeps the scripts that are submitted to it.
+type recordingClient struct {
+	CLI
+
+	lock    sync.Mutex
+	scripts []string
+}
+
+func (c *recordingClient) SubmitJob(scriptFile string) (string, error) {
+	script, err := os.ReadFile(scriptFile)
+	if err != nil {
+		return "", err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.scripts = append(c.scripts, string(script))
+
+	return strconv.Itoa(1000 + len(c.scripts)), nil
+}
+
+func Test_SubmitArrayTask(t *testing.T) {
+	compute.HPK = endpoint.HPK(t.TempDir())
+	if err := os.MkdirAll(compute.HPK.String(), endpoint.PodGlobalDirectoryPermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &recordingClient{}
+
+	defaultClient, defaultWindow := Slurm.Client, Slurm.ArrayWindow
+	Slurm.Client, Slurm.ArrayWindow = client, 200*time.Millisecond
+
+	defer func() { Slurm.Client, Slurm.ArrayWindow = defaultClient, defaultWindow }()
+
+	/*---------------------------------------------------
+	 * Submit the pods of an Indexed Job concurrently
+	 *---------------------------------------------------*/
+	indices := []int{0, 1, 2, 5}
+	jobIDs := make([]string, len(indices))
+
+	wg := sync.WaitGroup{}
+
+	for i, index := range indices {
+		scriptFile := filepath.Join(t.TempDir(), "submit.sh")
+
+		script := "#!/bin/bash\n" +
+			"#SBATCH --job-name=sweep-" + strconv.Itoa(index) + "\n" +
+			"#SBATCH --output=/logs/stdout\n" +
+			"#SBATCH --error=/logs/stderr\n" +
+			"#SBATCH --ntasks-per-node=2\n"
+
+		if err := os.WriteFile(scriptFile, []byte(script), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+
+		go func(i, index int) {
+			defer wg.Done()
+
+			jobID, err := SubmitArrayTask("default_sweep", index, scriptFile)
+			if err != nil {
+				t.Error(err)
+			}
+
+			jobIDs[i] = jobID
+		}(i, index)
+	}
+
+	wg.Wait()
+
+	/*---------------------------------------------------
+	 * Validate the coalesced submission
+	 *---------------------------------------------------*/
+	if len(client.scripts) != 1 {
+		t.Fatalf("submissions = %d, want 1", len(client.scripts))
+	}
+
+	if want := []string{"1001_0", "1001_1", "1001_2", "1001_5"}; !reflect.DeepEqual(jobIDs, want) {
+		t.Errorf("job ids = %v, want %v", jobIDs, want)
+	}
+
+	script := client.scripts[0]
+
+	for _, expected := range []string{
+		"#SBATCH --job-name=default_sweep\n",
+		"#SBATCH --array=0,1,2,5\n",
+		"#SBATCH --ntasks-per-node=2\n",
+		"5)\n\tSLURM_JOB_NAME='sweep-5' exec bash",
+		">> '/logs/stdout' 2>> '/logs/stderr'",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("array script does not contain '%s'. script:\n%s", expected, script)
+		}
+	}
+
+	if strings.Count(script, "--ntasks-per-node") != 1 {
+		t.Errorf("array script has duplicate directives. script:\n%s", script)
+	}
+}
+
+func Test_SubmitArrayTaskDirectives(t *testing.T) {
+	compute.HPK = endpoint.HPK(t.TempDir())
+	if err := os.MkdirAll(compute.HPK.String(), endpoint.PodGlobalDirectoryPermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &recordingClient{}
+
+	defaultClient, defaultWindow := Slurm.Client, Slurm.ArrayWindow
+	Slurm.Client, Slurm.ArrayWindow = client, 200*time.Millisecond
+
+	defer func() { Slurm.Client, Slurm.ArrayWindow = defaultClient, defaultWindow }()
+
+	/*---------------------------------------------------
+	 * Submit pods whose directives differ
+	 *---------------------------------------------------*/
+	directives := map[int]string{
+		0: "#SBATCH --ntasks-per-node=2\n",
+		1: "#SBATCH --ntasks-per-node=2\n#SBATCH --time=00:10:00\n",
+		2: "#SBATCH --ntasks-per-node=2\n",
+	}
+
+	jobIDs := make([]string, len(directives))
+
+	wg := sync.WaitGroup{}
+
+	for index, extra := range directives {
+		scriptFile := filepath.Join(t.TempDir(), "submit.sh")
+
+		script := "#!/bin/bash\n" +
+			"#SBATCH --job-name=sweep-" + strconv.Itoa(index) + "\n" +
+			extra
+
+		if err := os.WriteFile(scriptFile, []byte(script), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+
+		go func(index int) {
+			defer wg.Done()
+
+			jobID, err := SubmitArrayTask("default_sweep", index, scriptFile)
+			if err != nil {
+				t.Error(err)
+			}
+
+			jobIDs[index] = jobID
+		}(index)
+	}
+
+	wg.Wait()
+
+	/*---------------------------------------------------
+	 * Validate that only identical directives are coalesced
+	 *---------------------------------------------------*/
+	if len(client.scripts) != 2 {
+		t.Fatalf("submissions = %d, want 2", len(client.scripts))
+	}
+
+	if want := []string{"1001_0", "1002_1", "1001_2"}; !reflect.DeepEqual(jobIDs, want) {
+		t.Errorf("job ids = %v, want %v", jobIDs, want)
+	}
+
+	if script := client.scripts[0]; !strings.Contains(script, "#SBATCH --array=0,2\n") || strings.Contains(script, "--time") {
+		t.Errorf("unexpected array script:\n%s", script)
+	}
+
+	if script := client.scripts[1]; !strings.Contains(script, "#SBATCH --array=1\n") || !strings.Contains(script, "#SBATCH --time=00:10:00\n") {
+		t.Errorf("unexpected array script:\n%s", script)
+	}
+}
+
+func Test_expandArrayIndices(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []int
+	}{
+		{expr: "3", want: []int{3}},
+		{expr: "0,3,5", want: []int{0, 3, 5}},
+		{expr: "0-3", want: []int{0, 1, 2, 3}},
+		{expr: "1-7:3%2", want: []int{1, 4, 7}},
+		{expr: "0,4-5", want: []int{0, 4, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if got := expandArrayIndices(tt.expr); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandArrayIndices() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Signal is the signal that asks the job to terminate gracefully.
 var Signal = "--signal=TERM"
 
 // SignalChildren signals the submission script and the pause environment.
@@ -36,14 +37,30 @@ var ErrRety = errors.New("retry later")
 
 var ErrInvalidJob = errors.New("invalid job id")
 
-func CancelJob(args string) (string, error) {
-	/*
-	 Install trap for the signals INT and TERM to
-	 the main BATCH script here.
-	 Send SIGTERM using kill to the internal script's
-	 process and wait for it to close gracefully.
-	*/
-	out, err := process.Execute(Slurm.CancelCmd /*Signal, SignalChildren,*/, args)
+// CancelJob cancels the job through the configured Slurm client.
+func CancelJob(jobID string) (string, error) {
+	return Slurm.Client.CancelJob(jobID)
+}
+
+// CancelJob kills the job immediately. For graceful termination, see TerminateJob.
+func (CLI) CancelJob(jobID string) (string, error) {
+	return scancel(jobID)
+}
+
+// TerminateJob sends SIGTERM to the job through the configured Slurm client.
+// The job is expected to exit on its own, or to be cancelled once its grace period is over.
+func TerminateJob(jobID string) (string, error) {
+	return Slurm.Client.TerminateJob(jobID)
+}
+
+// TerminateJob signals only the batch script (the pause), which runs the preStop hooks
+// before forwarding the signal to the containers.
+func (CLI) TerminateJob(jobID string) (string, error) {
+	return scancel(Signal, SignalParentOnly, jobID)
+}
+
+func scancel(args ...string) (string, error) {
+	out, err := process.Execute(Slurm.CancelCmd, args...)
 	if err != nil {
 		outStr := string(out)
 
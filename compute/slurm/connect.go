@@ -14,6 +14,14 @@
 
 package slurm
 
+import (
+	"strings"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+)
+
 /************************************************************
 
 			Initiate Slurm Connector
@@ -24,6 +32,15 @@ func init() {
 	Slurm.SubmitCmd = "sbatch"  // path.GetPathOrDie("sbatch")
 	Slurm.CancelCmd = "scancel" // path.GetPathOrDie("scancel")
 	Slurm.StatsCmd = "sinfo"
+	Slurm.QueueCmd = "squeue"
+	Slurm.AccountingCmd = "sacct"
+	Slurm.ControlCmd = "scontrol"
+	Slurm.AllocateCmd = "salloc"
+	Slurm.RunCmd = "srun"
+	Slurm.ArrayWindow = 5 * time.Second
+	Slurm.ResourceMappings = []ResourceMapping{{Resource: "nvidia.com/gpu", Kind: MappingGRES, Name: "gpu"}}
+
+	Slurm.Client = CLI{}
 }
 
 // Slurm represents a SLURM installation.
@@ -31,10 +48,73 @@ var Slurm struct {
 	SubmitCmd string
 	CancelCmd string
 	StatsCmd  string
+
+	QueueCmd      string
+	AccountingCmd string
+	ControlCmd    string
+
+	// AllocateCmd and RunCmd run interactive pods, on a pseudo-terminal.
+	AllocateCmd string
+	RunCmd      string
+
+	// ArrayWindow is how long to wait for the pods of an Indexed Job before submitting them as a job array.
+	ArrayWindow time.Duration
+
+	// PodsPerNode is the maximum number of pods advertised for every Slurm node, or for the host of the
+	// local scheduler. 0 means one pod per cpu.
+	PodsPerNode int
+
+	// ResourceMappings translate the extended resources of Kubernetes (e.g, nvidia.com/gpu) into Slurm.
+	ResourceMappings []ResourceMapping
+
+	// PriorityMappings translate the priority of pods into the QOS and the nice value of their jobs.
+	PriorityMappings []PriorityMapping
+
+	// Client is the backend used to talk with the Slurm controller.
+	Client Client
+}
+
+// Client abstracts the way that HPK talks with the Slurm controller.
+type Client interface {
+	// SubmitJob submits the batch script and returns the id of the new job.
+	SubmitJob(scriptFile string) (string, error)
+
+	// CancelJob cancels the job. It returns ErrInvalidJob if the job does not exist,
+	// and ErrRety if the job cannot be cancelled at this moment.
+	CancelJob(jobID string) (string, error)
+
+	// TerminateJob sends SIGTERM to the batch script of the job. It returns the same errors as CancelJob.
+	TerminateJob(jobID string) (string, error)
+
+	// QueryJobs returns the state of the given jobs. Unknown jobs are omitted from the result.
+	QueryJobs(jobIDs ...string) (map[string]JobInfo, error)
+
+	// QueryAccounting returns the accounting of a job and its steps. It returns ErrInvalidJob if the job is unknown.
+	QueryAccounting(jobID string) (Accounting, error)
+
+	// UpdateTimeLimit changes the time limit of the job. It returns ErrInvalidJob if the job does not exist.
+	UpdateTimeLimit(jobID string, limit time.Duration) error
+
+	// ClusterStats returns the nodes of the cluster.
+	ClusterStats() (Stats, error)
+
+	// Ping returns an error if the Slurm controller is not responding.
+	Ping() error
 }
 
-// ConnectionOK return true if HPK maintains connection with the Slurm manager.
-// Otherwise, it returns false.
-func ConnectionOK() bool {
-	return true
+// CLI talks with the Slurm controller through the sbatch, scancel, squeue, sacct, and sinfo commands.
+type CLI struct{}
+
+// Ping asks the Slurm controller whether it is responsive, through "scontrol ping".
+func (CLI) Ping() error {
+	out, err := process.Execute(Slurm.ControlCmd, "ping")
+	if err != nil {
+		return errors.Wrapf(err, "scontrol ping has failed. out: '%s'", out)
+	}
+
+	if !strings.Contains(string(out), "is UP") {
+		return errors.Errorf("slurm controller is not responding. out: '%s'", out)
+	}
+
+	return nil
 }
@@ -0,0 +1,294 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+/************************************************************
+
+		Extended Resources to Generic Resources (GRES)
+
+************************************************************/
+
+// MappingKind is the sbatch flag that an extended resource is translated to.
+type MappingKind string
+
+const (
+	// MappingGRES translates the resource to '--gres=<name>:<count>'.
+	MappingGRES MappingKind = "gres"
+
+	// MappingGPUsPerNode translates the resource to '--gpus-per-node=[<type>:]<count>'.
+	MappingGPUsPerNode MappingKind = "gpus-per-node"
+
+	// MappingLicenses translates the resource to '--licenses=<name>:<count>'.
+	MappingLicenses MappingKind = "licenses"
+)
+
+// ResourceMapping translates a Kubernetes extended resource into Slurm.
+type ResourceMapping struct {
+	Resource corev1.ResourceName
+
+	Kind MappingKind
+
+	// Name is the gres (e.g, gpu, gpu:a100), the gpu type, or the license, depending on the Kind.
+	Name string
+}
+
+// ParseResourceMapping parses mappings in the form '<resource>=<kind>[:<name>]'
+// (e.g, 'nvidia.com/gpu=gres:gpu', 'amd.com/gpu=gpus-per-node', 'example.com/matlab=licenses:matlab').
+func ParseResourceMapping(spec string) (ResourceMapping, error) {
+	resourceName, target, found := strings.Cut(spec, "=")
+	if !found || resourceName == "" {
+		return ResourceMapping{}, errors.Errorf("invalid resource mapping '%s'. Expected <resource>=<kind>[:<name>]", spec)
+	}
+
+	kind, name, _ := strings.Cut(target, ":")
+
+	mapping := ResourceMapping{
+		Resource: corev1.ResourceName(resourceName),
+		Kind:     MappingKind(kind),
+		Name:     name,
+	}
+
+	switch mapping.Kind {
+	case MappingGRES, MappingLicenses:
+		if mapping.Name == "" {
+			return ResourceMapping{}, errors.Errorf("resource mapping '%s' requires a name", spec)
+		}
+	case MappingGPUsPerNode:
+	default:
+		return ResourceMapping{}, errors.Errorf("unknown kind '%s' in resource mapping '%s'", kind, spec)
+	}
+
+	return mapping, nil
+}
+
+// ParseResourceMappings parses a list of mappings. See ParseResourceMapping.
+func ParseResourceMappings(specs []string) ([]ResourceMapping, error) {
+	mappings := make([]ResourceMapping, 0, len(specs))
+
+	for _, spec := range specs {
+		mapping, err := ParseResourceMapping(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, err
+		}
+
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, nil
+}
+
+// IsGPU returns true if the mapped resource is a GPU.
+func (m ResourceMapping) IsGPU() bool {
+	return m.Kind == MappingGPUsPerNode || m.gresType() == "gpu"
+}
+
+// gresType returns the type of the generic resource that backs the mapping (e.g, "gpu" for "gpu:a100").
+// Licenses are not generic resources.
+func (m ResourceMapping) gresType() string {
+	switch m.Kind {
+	case MappingGRES:
+		gresType, _, _ := strings.Cut(m.Name, ":")
+
+		return gresType
+	case MappingGPUsPerNode:
+		return "gpu"
+	default:
+		return ""
+	}
+}
+
+// gresSubtype returns the specific model of the generic resource (e.g, "a100" for "gpu:a100"), if any.
+func (m ResourceMapping) gresSubtype() string {
+	switch m.Kind {
+	case MappingGRES:
+		_, subtype, _ := strings.Cut(m.Name, ":")
+
+		return subtype
+	case MappingGPUsPerNode:
+		return m.Name
+	default:
+		return ""
+	}
+}
+
+// MappingOf returns the mapping of the given extended resource, if any.
+func MappingOf(name corev1.ResourceName) (ResourceMapping, bool) {
+	for _, mapping := range Slurm.ResourceMappings {
+		if mapping.Resource == name {
+			return mapping, true
+		}
+	}
+
+	return ResourceMapping{}, false
+}
+
+// ResourceFlags translates the requested extended resources into sbatch flags.
+// Requests for resources without a mapping are returned as unmapped.
+func ResourceFlags(requests map[corev1.ResourceName]int64) (flags []string, unmapped []corev1.ResourceName) {
+	var gres, licenses []string
+
+	// sorted for stable scripts.
+	names := make([]string, 0, len(requests))
+	for name := range requests {
+		names = append(names, string(name))
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		count := requests[corev1.ResourceName(name)]
+		if count <= 0 {
+			continue
+		}
+
+		mapping, exists := MappingOf(corev1.ResourceName(name))
+		if !exists {
+			unmapped = append(unmapped, corev1.ResourceName(name))
+
+			continue
+		}
+
+		switch mapping.Kind {
+		case MappingGRES:
+			gres = append(gres, fmt.Sprintf("%s:%d", mapping.Name, count))
+		case MappingLicenses:
+			licenses = append(licenses, fmt.Sprintf("%s:%d", mapping.Name, count))
+		case MappingGPUsPerNode:
+			if mapping.Name != "" {
+				flags = append(flags, fmt.Sprintf("--gpus-per-node=%s:%d", mapping.Name, count))
+			} else {
+				flags = append(flags, fmt.Sprintf("--gpus-per-node=%d", count))
+			}
+		}
+	}
+
+	// sbatch only keeps the last occurrence of a flag, so multiple resources are given as a single list.
+	if len(gres) > 0 {
+		flags = append(flags, "--gres="+strings.Join(gres, ","))
+	}
+
+	if len(licenses) > 0 {
+		flags = append(flags, "--licenses="+strings.Join(licenses, ","))
+	}
+
+	return flags, unmapped
+}
+
+// RequestsGPU returns true if any of the requested extended resources is a GPU.
+func RequestsGPU(requests map[corev1.ResourceName]int64) bool {
+	for name, count := range requests {
+		if mapping, exists := MappingOf(name); exists && count > 0 && mapping.IsGPU() {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*---------------------------------------------------
+ * Generic Resources of the Slurm nodes
+ *---------------------------------------------------*/
+
+// gresSocketBinding matches the socket or index bindings of the gres (e.g, "(S:0-1)", "(IDX:0,2)").
+var gresSocketBinding = regexp.MustCompile(`\([^)]*\)`)
+
+// gresCount is the number of instances for every generic resource of a node.
+type gresCount struct {
+	Type    string
+	Subtype string
+	Count   int64
+}
+
+// parseGres parses the generic resources of a node, as reported in the 'gres' and 'gres_used' fields of sinfo
+// (e.g, "gpu:a100:4(S:0-1),fpga:2").
+func parseGres(raw string) []gresCount {
+	var counts []gresCount
+
+	for _, entry := range strings.Split(gresSocketBinding.ReplaceAllString(raw, ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || entry == "(null)" {
+			continue
+		}
+
+		fields := strings.Split(entry, ":")
+
+		gres := gresCount{Type: fields[0], Count: 1}
+
+		switch len(fields) {
+		case 1:
+		case 2:
+			if count, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				gres.Count = count
+			} else {
+				gres.Subtype = fields[1]
+			}
+		default:
+			gres.Subtype = fields[1]
+
+			count, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				continue
+			}
+
+			gres.Count = count
+		}
+
+		counts = append(counts, gres)
+	}
+
+	return counts
+}
+
+// extendedResources returns the instances of the mapped extended resources, for the given generic resources.
+func extendedResources(gres []gresCount) corev1.ResourceList {
+	list := corev1.ResourceList{}
+
+	for _, mapping := range Slurm.ResourceMappings {
+		gresType := mapping.gresType()
+		if gresType == "" {
+			continue
+		}
+
+		var total int64
+
+		for _, g := range gres {
+			if g.Type != gresType {
+				continue
+			}
+
+			if subtype := mapping.gresSubtype(); subtype != "" && subtype != g.Subtype {
+				continue
+			}
+
+			total += g.Count
+		}
+
+		list[mapping.Resource] = *resource.NewQuantity(total, resource.DecimalSI)
+	}
+
+	return list
+}
@@ -0,0 +1,138 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func useResourceMappings(t *testing.T, specs ...string) {
+	mappings, err := ParseResourceMappings(specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := Slurm.ResourceMappings
+	Slurm.ResourceMappings = mappings
+
+	t.Cleanup(func() { Slurm.ResourceMappings = previous })
+}
+
+func TestParseResourceMapping(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    ResourceMapping
+		wantErr bool
+	}{
+		{spec: "nvidia.com/gpu=gres:gpu", want: ResourceMapping{Resource: "nvidia.com/gpu", Kind: MappingGRES, Name: "gpu"}},
+		{spec: "nvidia.com/a100=gres:gpu:a100", want: ResourceMapping{Resource: "nvidia.com/a100", Kind: MappingGRES, Name: "gpu:a100"}},
+		{spec: "amd.com/gpu=gpus-per-node", want: ResourceMapping{Resource: "amd.com/gpu", Kind: MappingGPUsPerNode}},
+		{spec: "example.com/matlab=licenses:matlab", want: ResourceMapping{Resource: "example.com/matlab", Kind: MappingLicenses, Name: "matlab"}},
+		{spec: "example.com/matlab=licenses", wantErr: true},
+		{spec: "nvidia.com/gpu", wantErr: true},
+		{spec: "nvidia.com/gpu=tres:gpu", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseResourceMapping(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseResourceMapping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseResourceMapping() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceFlags(t *testing.T) {
+	useResourceMappings(t,
+		"nvidia.com/gpu=gres:gpu",
+		"xilinx.com/fpga=gres:fpga",
+		"amd.com/gpu=gpus-per-node:mi250",
+		"example.com/matlab=licenses:matlab",
+	)
+
+	flags, unmapped := ResourceFlags(map[corev1.ResourceName]int64{
+		"nvidia.com/gpu":     2,
+		"xilinx.com/fpga":    1,
+		"amd.com/gpu":        4,
+		"example.com/matlab": 1,
+		"example.com/other":  1,
+	})
+
+	want := []string{"--gpus-per-node=mi250:4", "--gres=gpu:2,fpga:1", "--licenses=matlab:1"}
+
+	if !reflect.DeepEqual(flags, want) {
+		t.Errorf("ResourceFlags() flags = %v, want %v", flags, want)
+	}
+
+	if !reflect.DeepEqual(unmapped, []corev1.ResourceName{"example.com/other"}) {
+		t.Errorf("ResourceFlags() unmapped = %v", unmapped)
+	}
+}
+
+func Test_parseGres(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want []gresCount
+	}{
+		{raw: "", want: nil},
+		{raw: "(null)", want: nil},
+		{raw: "gpu:4", want: []gresCount{{Type: "gpu", Count: 4}}},
+		{raw: "gpu:a100:4(S:0-1),fpga:2", want: []gresCount{{Type: "gpu", Subtype: "a100", Count: 4}, {Type: "fpga", Count: 2}}},
+		{raw: "gpu:a100:1(IDX:0,2),gpu:v100:0(IDX:N/A)", want: []gresCount{{Type: "gpu", Subtype: "a100", Count: 1}, {Type: "gpu", Subtype: "v100", Count: 0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := parseGres(tt.raw); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGres() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeInfo_ExtendedResources(t *testing.T) {
+	useResourceMappings(t, "nvidia.com/gpu=gres:gpu", "nvidia.com/a100=gres:gpu:a100")
+
+	node := NodeInfo{CPUs: 8, Gres: "gpu:a100:4(S:0),gpu:v100:2(S:1)", GresUsed: "gpu:a100:1(IDX:0),gpu:v100:0(IDX:N/A)"}
+
+	capacity, allocatable := node.Capacity(), node.Allocatable()
+
+	tests := []struct {
+		resource        corev1.ResourceName
+		wantCapacity    int64
+		wantAllocatable int64
+	}{
+		{resource: "nvidia.com/gpu", wantCapacity: 6, wantAllocatable: 5},
+		{resource: "nvidia.com/a100", wantCapacity: 4, wantAllocatable: 3},
+	}
+
+	for _, tt := range tests {
+		if got := capacity[tt.resource]; got.Value() != tt.wantCapacity {
+			t.Errorf("capacity[%s] = %v, want %d", tt.resource, got.String(), tt.wantCapacity)
+		}
+
+		if got := allocatable[tt.resource]; got.Value() != tt.wantAllocatable {
+			t.Errorf("allocatable[%s] = %v, want %d", tt.resource, got.String(), tt.wantAllocatable)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+/************************************************************
+
+			Health of the Slurm Cluster
+
+************************************************************/
+
+// Health is the state of the Slurm controller and partitions, as observed by a single health check.
+type Health struct {
+	// ControllerErr is non-nil if the Slurm controller cannot be reached.
+	ControllerErr error
+
+	// Partitions maps every known partition to whether any of its nodes accepts new jobs.
+	// It is empty if the controller cannot be reached.
+	Partitions map[string]bool
+}
+
+// Reachable returns true if the Slurm controller responds.
+func (h Health) Reachable() bool {
+	return h.ControllerErr == nil
+}
+
+// DownPartitions returns the partitions without any node that accepts new jobs, among the given ones.
+// If no partition is given, all the known partitions are considered.
+func (h Health) DownPartitions(partitions ...string) []string {
+	if len(partitions) == 0 {
+		for name := range h.Partitions {
+			partitions = append(partitions, name)
+		}
+	}
+
+	var down []string
+
+	for _, name := range partitions {
+		if up, exists := h.Partitions[name]; exists && !up {
+			down = append(down, name)
+		}
+	}
+
+	sort.Strings(down)
+
+	return down
+}
+
+// CheckHealth pings the Slurm controller (scontrol ping), and queries the state of the partitions (sinfo).
+func CheckHealth() Health {
+	if err := Slurm.Client.Ping(); err != nil {
+		return Health{ControllerErr: err}
+	}
+
+	stats, err := Slurm.Client.ClusterStats()
+	if err != nil {
+		return Health{ControllerErr: errors.Wrapf(err, "stats query error")}
+	}
+
+	return Health{Partitions: partitionAvailability(stats)}
+}
+
+// partitionAvailability returns whether every partition has at least one node that accepts new jobs.
+func partitionAvailability(stats Stats) map[string]bool {
+	partitions := make(map[string]bool)
+
+	for _, node := range stats.Nodes {
+		for _, partition := range node.Partitions {
+			partitions[partition] = partitions[partition] || node.Available()
+		}
+	}
+
+	return partitions
+}
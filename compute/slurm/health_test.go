@@ -0,0 +1,60 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func Test_partitionAvailability(t *testing.T) {
+	var stats Stats
+
+	if err := json.Unmarshal([]byte(`{"nodes": [
+		{"name": "node1", "partitions": ["gpu", "all"], "state": "DOWN"},
+		{"name": "node2", "partitions": ["cpu", "all"], "state": ["IDLE"]},
+		{"name": "node3", "partitions": ["debug"], "state": "IDLE+DRAIN"},
+		{"name": "node4", "partitions": ["debug"], "state": "IDLE*"}
+	]}`), &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	health := Health{Partitions: partitionAvailability(stats)}
+
+	want := map[string]bool{"all": true, "cpu": true, "gpu": false, "debug": false}
+	if !reflect.DeepEqual(health.Partitions, want) {
+		t.Errorf("partitionAvailability() = %v, want %v", health.Partitions, want)
+	}
+
+	tests := []struct {
+		name       string
+		partitions []string
+		want       []string
+	}{
+		{name: "all partitions", partitions: nil, want: []string{"debug", "gpu"}},
+		{name: "up partition", partitions: []string{"cpu"}, want: nil},
+		{name: "down partition", partitions: []string{"gpu"}, want: []string{"gpu"}},
+		{name: "unknown partition", partitions: []string{"missing"}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := health.DownPartitions(tt.partitions...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DownPartitions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,6 +15,7 @@
 package slurm
 
 import (
+	"strconv"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
@@ -60,6 +61,23 @@ func GetJobID(pod *corev1.Pod) string {
 	return parseIDType(raw)
 }
 
+// SetPodAttempt records how many times the job of the pod has been requeued by Slurm.
+// The job id remains the same across attempts. The attempt is kept apart from the typed id of the pod,
+// because the id is given as is to Slurm (e.g, scancel, dependencies) and to the container statuses.
+func SetPodAttempt(pod *corev1.Pod, attempt int) {
+	metav1.SetMetaDataAnnotation(&pod.ObjectMeta, "pod.hpk/attempt", strconv.Itoa(attempt))
+}
+
+// GetPodAttempt returns the current attempt of the job, starting from 0.
+func GetPodAttempt(pod *corev1.Pod) int {
+	attempt, err := strconv.Atoi(pod.GetAnnotations()["pod.hpk/attempt"])
+	if err != nil {
+		return 0
+	}
+
+	return attempt
+}
+
 func parseIDType(raw string) string {
 	if strings.HasPrefix(raw, string(JobIDTypeSlurm)) {
 		return strings.Split(raw, string(JobIDTypeSlurm))[1]
@@ -0,0 +1,179 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/carv-ics-forth/hpk/pkg/pty"
+	"github.com/pkg/errors"
+)
+
+/************************************************************
+
+			Interactive Jobs
+
+************************************************************/
+
+// batchOnlyDirectives are the directives of sbatch that salloc does not accept.
+var batchOnlyDirectives = []string{
+	"output", "error", "open-mode", "signal", "requeue", "no-requeue", "array", "kill-on-invalid-dep",
+}
+
+// AllocationFlags translates the '#SBATCH' directives of the script into flags of salloc.
+func AllocationFlags(script string) []string {
+	var flags []string
+
+	for _, directive := range scanDirectives(script) {
+		if slices.Contains(batchOnlyDirectives, directive.Option) {
+			continue
+		}
+
+		if directive.HasValue {
+			flags = append(flags, "--"+directive.Option+"="+directive.Value)
+		} else {
+			flags = append(flags, "--"+directive.Option)
+		}
+	}
+
+	return flags
+}
+
+// InteractiveStepFlags are the flags of the srun step that runs the script of an interactive pod. The step is a
+// single task on a pseudo-terminal, and holds all the cpus that the script has requested for every node.
+func InteractiveStepFlags(script string) []string {
+	flags := []string{"--pty", "--nodes=1", "--ntasks=1"}
+
+	for _, directive := range scanDirectives(script) {
+		if directive.Option == "ntasks-per-node" && directive.HasValue {
+			flags = append(flags, "--cpus-per-task="+directive.Value)
+		}
+	}
+
+	return flags
+}
+
+// allocatedJobID matches the messages of salloc that report the id of the job,
+// either while waiting in the queue or once the allocation is granted.
+var allocatedJobID = regexp.MustCompile(`(?:Pending|Granted) job allocation (\d+)`)
+
+// AllocationTimeout is how long to wait for salloc to report the id of the job.
+var AllocationTimeout = time.Minute
+
+// SubmitInteractive runs the script as 'salloc <directives> srun --pty <script>' on a pseudo-terminal,
+// whose output is appended to logFile. It returns as soon as salloc reports the id of the job, which may
+// still be waiting in the queue. The allocation is released when the script exits, or the terminal is closed.
+func SubmitInteractive(scriptFile string, logFile string) (string, *pty.Terminal, error) {
+	script, err := os.ReadFile(scriptFile)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "cannot read script '%s'", scriptFile)
+	}
+
+	args := AllocationFlags(string(script))
+	args = append(args, Slurm.RunCmd)
+	args = append(args, InteractiveStepFlags(string(script))...)
+	args = append(args, scriptFile)
+
+	cmd := exec.Command(Slurm.AllocateCmd, args...)
+	cmd.Env = append(os.Environ(), process.GoEnviron...)
+
+	// the messages of salloc and srun are kept apart from the terminal, which only carries the output of the pod.
+	stderr, stderrWriter, err := os.Pipe()
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "cannot create pipe")
+	}
+
+	cmd.Stderr = stderrWriter
+
+	terminal, err := pty.Start(cmd, logFile)
+
+	stderrWriter.Close()
+
+	if err != nil {
+		stderr.Close()
+
+		return "", nil, err
+	}
+
+	var (
+		messages     strings.Builder
+		messagesLock sync.Mutex
+	)
+
+	jobIDs := make(chan string, 1)
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		defer stderr.Close()
+
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			compute.DefaultLogger.Info("salloc", "script", scriptFile, "message", line)
+
+			messagesLock.Lock()
+			messages.WriteString(line + "\n")
+			messagesLock.Unlock()
+
+			if match := allocatedJobID.FindStringSubmatch(line); match != nil {
+				select {
+				case jobIDs <- match[1]:
+				default:
+				}
+			}
+		}
+	}()
+
+	select {
+	case jobID := <-jobIDs:
+		return jobID, terminal, nil
+
+	case <-exited:
+		<-terminal.Done()
+
+		select {
+		case jobID := <-jobIDs:
+			// the job has already completed.
+			return jobID, terminal, nil
+		default:
+		}
+
+		messagesLock.Lock()
+		defer messagesLock.Unlock()
+
+		exitErr := terminal.Err()
+		if exitErr == nil {
+			exitErr = errors.New("salloc has exited without an allocation")
+		}
+
+		return "", nil, ClassifySubmitError(messages.String(), exitErr)
+
+	case <-time.After(AllocationTimeout):
+		_ = terminal.Close()
+
+		return "", nil, errors.Wrapf(ErrControllerTimeout, "salloc has not reported a job id within %s", AllocationTimeout)
+	}
+}
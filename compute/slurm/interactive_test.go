@@ -0,0 +1,137 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const interactiveScript = `#!/bin/bash
+#SBATCH --job-name=shell
+#SBATCH --output=/tmp/stdout
+#SBATCH --error=/tmp/stderr
+#SBATCH --partition=debug
+#SBATCH --requeue
+#SBATCH --signal=B:TERM@60 # tells the controller
+#SBATCH --ntasks-per-node=4
+#SBATCH --exclusive
+read line
+echo "got ${line}"
+`
+
+func TestInteractiveFlags(t *testing.T) {
+	wantAllocation := []string{"--job-name=shell", "--partition=debug", "--ntasks-per-node=4", "--exclusive"}
+	if got := AllocationFlags(interactiveScript); !reflect.DeepEqual(got, wantAllocation) {
+		t.Errorf("AllocationFlags() = %v, want %v", got, wantAllocation)
+	}
+
+	wantStep := []string{"--pty", "--nodes=1", "--ntasks=1", "--cpus-per-task=4"}
+	if got := InteractiveStepFlags(interactiveScript); !reflect.DeepEqual(got, wantStep) {
+		t.Errorf("InteractiveStepFlags() = %v, want %v", got, wantStep)
+	}
+}
+
+// useFakeAllocation replaces salloc and srun with scripts that drop their flags, and run the given command locally.
+// The fake salloc prints the given messages on stderr, and exits with the given code.
+func useFakeAllocation(t *testing.T, messages string, exitCode int) {
+	dir := t.TempDir()
+
+	salloc := filepath.Join(dir, "salloc")
+	srun := filepath.Join(dir, "srun")
+
+	fakeSalloc := fmt.Sprintf("#!/bin/bash\necho -e '%s' >&2\n[[ %d -ne 0 ]] && exit %d\n", messages, exitCode, exitCode) +
+		"while [[ $1 == --* ]]; do shift; done\nexec \"$@\"\n"
+
+	fakeSrun := "#!/bin/bash\nwhile [[ $1 == --* ]]; do shift; done\nexec \"$@\"\n"
+
+	if err := os.WriteFile(salloc, []byte(fakeSalloc), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(srun, []byte(fakeSrun), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	allocateCmd, runCmd := Slurm.AllocateCmd, Slurm.RunCmd
+	Slurm.AllocateCmd, Slurm.RunCmd = salloc, srun
+
+	t.Cleanup(func() { Slurm.AllocateCmd, Slurm.RunCmd = allocateCmd, runCmd })
+}
+
+func TestSubmitInteractive(t *testing.T) {
+	scriptFile := filepath.Join(t.TempDir(), "submit.sh")
+	if err := os.WriteFile(scriptFile, []byte(interactiveScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("granted", func(t *testing.T) {
+		useFakeAllocation(t, "salloc: Pending job allocation 4242\\nsalloc: Granted job allocation 4242", 0)
+
+		logFile := filepath.Join(t.TempDir(), "shell.log")
+
+		jobID, terminal, err := SubmitInteractive(scriptFile, logFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if jobID != "4242" {
+			t.Errorf("SubmitInteractive() = %s, want 4242", jobID)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		attached := make(chan error)
+
+		go func() {
+			attached <- terminal.Attach(ctx, strings.NewReader("hello\n"), nil, nil)
+		}()
+
+		select {
+		case <-terminal.Done():
+		case <-ctx.Done():
+			t.Fatal("interactive job has not exited")
+		}
+
+		if err := <-attached; err != nil {
+			t.Fatal(err)
+		}
+
+		logs, err := os.ReadFile(logFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(logs), "got hello") {
+			t.Errorf("logs = %q, want 'got hello'", logs)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		useFakeAllocation(t, "salloc: error: Job submit/allocate failed: Invalid account or account/partition combination specified", 1)
+
+		_, _, err := SubmitInteractive(scriptFile, filepath.Join(t.TempDir(), "shell.log"))
+		if reason := SubmitFailureReason(err); reason != "InvalidAccount" {
+			t.Errorf("SubmitFailureReason() = %s, want InvalidAccount. err: %v", reason, err)
+		}
+	})
+}
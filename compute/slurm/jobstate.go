@@ -0,0 +1,133 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"fmt"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/pkg/crdtools"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// jobTermination describes how a terminal job state is reflected on the containers.
+type jobTermination struct {
+	Reason   string
+	Message  string
+	ExitCode int32
+}
+
+var jobTerminations = map[JobState]jobTermination{
+	JobStateCompleted:   {Reason: "Completed", Message: "Slurm job has completed", ExitCode: 0},
+	JobStateFailed:      {Reason: "Error", Message: "Slurm job has failed", ExitCode: 1},
+	JobStateTimeout:     {Reason: compute.ReasonDeadlineExceeded, Message: "Slurm job has reached its time limit", ExitCode: 143},
+	JobStateNodeFail:    {Reason: "NodeLost", Message: "Slurm job was terminated due to node failure", ExitCode: 137},
+	JobStatePreempted:   {Reason: "Preempted", Message: "Slurm job was preempted", ExitCode: 143},
+	JobStateOutOfMemory: {Reason: "OOMKilled", Message: "Slurm job has run out of memory", ExitCode: 137},
+	JobStateCancelled:   {Reason: "Cancelled", Message: "Slurm job was cancelled", ExitCode: 143},
+}
+
+// ApplyJobState terminates every container that has not yet terminated, and moves the pod into a final phase.
+// It returns false if the job is still active, or if the pod is already in a final phase.
+func ApplyJobState(pod *corev1.Pod, job JobInfo) bool {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+
+	termination, terminal := jobTerminations[job.State]
+	if !terminal {
+		return false
+	}
+
+	if job.ExitCode != 0 {
+		termination.ExitCode = int32(job.ExitCode)
+	}
+
+	/*---------------------------------------------------
+	 * Terminate the remaining containers
+	 *---------------------------------------------------*/
+	succeeded := true
+
+	terminate := func(status *corev1.ContainerStatus) {
+		if status.State.Terminated == nil {
+			var startedAt metav1.Time
+			if status.State.Running != nil {
+				startedAt = status.State.Running.StartedAt
+			}
+
+			status.State.Waiting = nil
+			status.State.Running = nil
+			status.State.Terminated = &corev1.ContainerStateTerminated{
+				ExitCode:    termination.ExitCode,
+				Signal:      int32(job.Signal),
+				Reason:      termination.Reason,
+				Message:     termination.Message,
+				StartedAt:   startedAt,
+				FinishedAt:  metav1.Now(),
+				ContainerID: status.ContainerID,
+			}
+			status.Ready = false
+		}
+
+		if status.State.Terminated.ExitCode != 0 {
+			succeeded = false
+		}
+	}
+
+	for i := range pod.Status.InitContainerStatuses {
+		terminate(&pod.Status.InitContainerStatuses[i])
+	}
+
+	for i := range pod.Status.ContainerStatuses {
+		terminate(&pod.Status.ContainerStatuses[i])
+	}
+
+	/*---------------------------------------------------
+	 * Set the final phase of the Pod
+	 *---------------------------------------------------*/
+	if job.State == JobStateCompleted && succeeded {
+		pod.Status.Phase = corev1.PodSucceeded
+		pod.Status.Reason = termination.Reason
+		pod.Status.Message = fmt.Sprintf("Slurm job '%s' has completed", job.JobID)
+
+		crdtools.SetPodStatusCondition(&pod.Status.Conditions, corev1.PodCondition{
+			Type:               corev1.PodReady,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             "PodCompleted",
+			Message:            "Pod Has been Successfully Terminated.",
+		})
+
+		return true
+	}
+
+	reason := termination.Reason
+	if job.State == JobStateCompleted {
+		// the job has completed, but some containers have not.
+		reason = "ContainerFailed"
+	}
+
+	// match the semantics of kubelet for activeDeadlineSeconds.
+	if job.State == JobStateTimeout {
+		compute.PodError(pod, reason, compute.MessageDeadlineExceeded)
+
+		return true
+	}
+
+	compute.PodError(pod, reason, "Slurm job '%s' is in state '%s' (%s)", job.JobID, job.State, job.Reason)
+
+	return true
+}
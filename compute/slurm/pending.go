@@ -0,0 +1,118 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/pkg/crdtools"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/************************************************************
+
+			Pending Reasons of Queued Jobs
+
+************************************************************/
+
+// PodQueued is true while the job of the pod waits in the Slurm queue. Its reason is the pending reason
+// of the job (e.g, Priority, Resources, Dependency, JobHeldUser), and its message includes the estimated start time.
+const PodQueued corev1.PodConditionType = "slurm.hpk.io/Queued"
+
+// ReasonInSlurmQueue is the waiting reason of containers whose job has no known pending reason.
+const ReasonInSlurmQueue = "InSlurmQueue"
+
+// PendingMessage describes why the job waits in the queue, and when it is expected to start.
+func PendingMessage(job JobInfo) string {
+	if job.StartTime.IsZero() {
+		return fmt.Sprintf("Job waiting in the Slurm queue (%s)", job.Reason)
+	}
+
+	return fmt.Sprintf("Job waiting in the Slurm queue (%s). Estimated start time: %s",
+		job.Reason, job.StartTime.UTC().Format(time.RFC3339))
+}
+
+// ApplyQueueState reflects the pending reason of a queued job on the PodQueued condition, and on the containers
+// that have not started yet. Once the job has left the queue, the condition is set to false.
+// It returns true if the pod has changed.
+func ApplyQueueState(pod *corev1.Pod, job JobInfo) bool {
+	existing := crdtools.FindStatusCondition(pod.Status.Conditions, PodQueued)
+
+	condition := corev1.PodCondition{
+		Type:               PodQueued,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             job.Reason,
+		Message:            PendingMessage(job),
+	}
+
+	switch {
+	case job.State.IsQueued():
+		if job.Reason == "" || job.Reason == "None" {
+			condition.Reason = ReasonInSlurmQueue
+		}
+
+	case existing != nil && existing.Status == corev1.ConditionTrue:
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = "Started"
+		condition.Message = "Job has left the Slurm queue"
+
+	default:
+		return false
+	}
+
+	if existing != nil && existing.Status == condition.Status &&
+		existing.Reason == condition.Reason && existing.Message == condition.Message {
+		return false
+	}
+
+	crdtools.SetPodStatusCondition(&pod.Status.Conditions, condition)
+
+	if condition.Status == corev1.ConditionTrue {
+		waiting := QueuedWaitingState(pod)
+
+		for i := range pod.Status.InitContainerStatuses {
+			if pod.Status.InitContainerStatuses[i].State.Waiting != nil {
+				pod.Status.InitContainerStatuses[i].State.Waiting = waiting.DeepCopy()
+			}
+		}
+
+		for i := range pod.Status.ContainerStatuses {
+			if pod.Status.ContainerStatuses[i].State.Waiting != nil {
+				pod.Status.ContainerStatuses[i].State.Waiting = waiting.DeepCopy()
+			}
+		}
+	}
+
+	return true
+}
+
+// QueuedWaitingState returns the waiting state of containers whose job is in the queue,
+// according to the PodQueued condition of the pod.
+func QueuedWaitingState(pod *corev1.Pod) *corev1.ContainerStateWaiting {
+	if queued := crdtools.FindStatusCondition(pod.Status.Conditions, PodQueued); queued != nil && queued.Status == corev1.ConditionTrue {
+		return &corev1.ContainerStateWaiting{
+			Reason:  queued.Reason,
+			Message: queued.Message,
+		}
+	}
+
+	return &corev1.ContainerStateWaiting{
+		Reason:  ReasonInSlurmQueue,
+		Message: "Job waiting in the Slurm queue",
+	}
+}
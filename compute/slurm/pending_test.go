@@ -0,0 +1,138 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/pkg/crdtools"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestApplyQueueState(t *testing.T) {
+	startTime := time.Date(2023, 10, 16, 14, 0, 0, 0, time.UTC)
+
+	queued := func(reason string) []corev1.PodCondition {
+		return []corev1.PodCondition{{
+			Type:    PodQueued,
+			Status:  corev1.ConditionTrue,
+			Reason:  reason,
+			Message: PendingMessage(JobInfo{Reason: reason, StartTime: startTime}),
+		}}
+	}
+
+	tests := []struct {
+		name        string
+		conditions  []corev1.PodCondition
+		job         JobInfo
+		wantChanged bool
+		wantStatus  corev1.ConditionStatus
+		wantReason  string
+	}{
+		{
+			name:        "pending for the first time",
+			job:         JobInfo{State: JobStatePending, Reason: "Priority", StartTime: startTime},
+			wantChanged: true,
+			wantStatus:  corev1.ConditionTrue,
+			wantReason:  "Priority",
+		},
+		{
+			name:        "pending reason unchanged",
+			conditions:  queued("Priority"),
+			job:         JobInfo{State: JobStatePending, Reason: "Priority", StartTime: startTime},
+			wantChanged: false,
+			wantStatus:  corev1.ConditionTrue,
+			wantReason:  "Priority",
+		},
+		{
+			name:        "pending reason changed",
+			conditions:  queued("Priority"),
+			job:         JobInfo{State: JobStatePending, Reason: "Resources", StartTime: startTime},
+			wantChanged: true,
+			wantStatus:  corev1.ConditionTrue,
+			wantReason:  "Resources",
+		},
+		{
+			name:        "estimated start time changed",
+			conditions:  queued("Priority"),
+			job:         JobInfo{State: JobStatePending, Reason: "Priority", StartTime: startTime.Add(time.Hour)},
+			wantChanged: true,
+			wantStatus:  corev1.ConditionTrue,
+			wantReason:  "Priority",
+		},
+		{
+			name:        "pending without reason",
+			job:         JobInfo{State: JobStatePending, Reason: "None"},
+			wantChanged: true,
+			wantStatus:  corev1.ConditionTrue,
+			wantReason:  ReasonInSlurmQueue,
+		},
+		{
+			name:        "left the queue",
+			conditions:  queued("Priority"),
+			job:         JobInfo{State: JobStateRunning, Reason: "None"},
+			wantChanged: true,
+			wantStatus:  corev1.ConditionFalse,
+			wantReason:  "Started",
+		},
+		{
+			name:        "running without having been queued",
+			job:         JobInfo{State: JobStateRunning, Reason: "None"},
+			wantChanged: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				Status: corev1.PodStatus{
+					Conditions: tt.conditions,
+					ContainerStatuses: []corev1.ContainerStatus{
+						{Name: "waiting", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: ReasonInSlurmQueue}}},
+						{Name: "running", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+					},
+				},
+			}
+
+			if got := ApplyQueueState(pod, tt.job); got != tt.wantChanged {
+				t.Errorf("ApplyQueueState() = %v, want %v", got, tt.wantChanged)
+			}
+
+			condition := crdtools.FindStatusCondition(pod.Status.Conditions, PodQueued)
+			if tt.wantStatus == "" {
+				if condition != nil {
+					t.Errorf("unexpected condition %v", condition)
+				}
+
+				return
+			}
+
+			if condition == nil || condition.Status != tt.wantStatus || condition.Reason != tt.wantReason {
+				t.Fatalf("condition = %v, want status %s and reason %s", condition, tt.wantStatus, tt.wantReason)
+			}
+
+			if tt.wantChanged && tt.wantStatus == corev1.ConditionTrue {
+				if waiting := pod.Status.ContainerStatuses[0].State.Waiting; waiting.Reason != tt.wantReason || waiting.Message != condition.Message {
+					t.Errorf("waiting = %v, want reason %s and message %s", waiting, tt.wantReason, condition.Message)
+				}
+
+				if pod.Status.ContainerStatuses[1].State.Waiting != nil {
+					t.Errorf("running container must not be waiting")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+/************************************************************
+
+			Pod Priority to Slurm QOS and Nice
+
+************************************************************/
+
+// PriorityMapping translates the priority of pods into the QOS and the nice value of their jobs.
+// Pods are matched either by their PriorityClass, or by their priority falling within a range.
+type PriorityMapping struct {
+	// PriorityClass matches pods with the given PriorityClassName. If empty, pods are matched by priority.
+	PriorityClass string
+
+	// MinPriority and MaxPriority are the inclusive bounds of the priority range.
+	MinPriority int32
+	MaxPriority int32
+
+	// QOS is given to '--qos'. If empty, the QOS is not changed.
+	QOS string
+
+	// Nice is given to '--nice'. If nil, the nice value is not changed.
+	Nice *int
+}
+
+// ParsePriorityMapping parses mappings in the form '<selector>=[<qos>][:<nice>]', where the selector is either a
+// PriorityClass name or a priority range '<min>..<max>', with either bound optional
+// (e.g, 'system-cluster-critical=urgent', '1000..=high:-100', '..-1=:10000').
+func ParsePriorityMapping(spec string) (PriorityMapping, error) {
+	selector, target, found := strings.Cut(spec, "=")
+	if !found || selector == "" || target == "" {
+		return PriorityMapping{}, errors.Errorf("invalid priority mapping '%s'. Expected <selector>=[<qos>][:<nice>]", spec)
+	}
+
+	mapping := PriorityMapping{MinPriority: math.MinInt32, MaxPriority: math.MaxInt32}
+
+	if minimum, maximum, isRange := strings.Cut(selector, ".."); isRange {
+		if minimum != "" {
+			value, err := strconv.ParseInt(minimum, 10, 32)
+			if err != nil {
+				return PriorityMapping{}, errors.Wrapf(err, "invalid lower bound in priority mapping '%s'", spec)
+			}
+
+			mapping.MinPriority = int32(value)
+		}
+
+		if maximum != "" {
+			value, err := strconv.ParseInt(maximum, 10, 32)
+			if err != nil {
+				return PriorityMapping{}, errors.Wrapf(err, "invalid upper bound in priority mapping '%s'", spec)
+			}
+
+			mapping.MaxPriority = int32(value)
+		}
+
+		if mapping.MinPriority > mapping.MaxPriority {
+			return PriorityMapping{}, errors.Errorf("empty priority range in priority mapping '%s'", spec)
+		}
+	} else {
+		mapping.PriorityClass = selector
+	}
+
+	qos, nice, hasNice := strings.Cut(target, ":")
+
+	mapping.QOS = qos
+
+	if hasNice {
+		value, err := strconv.Atoi(nice)
+		if err != nil {
+			return PriorityMapping{}, errors.Wrapf(err, "invalid nice value in priority mapping '%s'", spec)
+		}
+
+		mapping.Nice = &value
+	}
+
+	if mapping.QOS == "" && mapping.Nice == nil {
+		return PriorityMapping{}, errors.Errorf("priority mapping '%s' requires a qos or a nice value", spec)
+	}
+
+	return mapping, nil
+}
+
+// ParsePriorityMappings parses a list of mappings. See ParsePriorityMapping.
+func ParsePriorityMappings(specs []string) ([]PriorityMapping, error) {
+	mappings := make([]PriorityMapping, 0, len(specs))
+
+	for _, spec := range specs {
+		mapping, err := ParsePriorityMapping(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, err
+		}
+
+		// Slurm enforces the permission itself, by rejecting the jobs of the mapping.
+		if mapping.Nice != nil && *mapping.Nice < 0 {
+			compute.DefaultLogger.Info("Negative nice value requires HPK to run as a Slurm operator or administrator",
+				"mapping", spec)
+		}
+
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, nil
+}
+
+// Matches returns true if the pod is selected by the mapping.
+func (m PriorityMapping) Matches(pod *corev1.Pod) bool {
+	if m.PriorityClass != "" {
+		return pod.Spec.PriorityClassName == m.PriorityClass
+	}
+
+	// pods without a resolved priority have the default priority of Kubernetes.
+	var priority int32
+
+	if pod.Spec.Priority != nil {
+		priority = *pod.Spec.Priority
+	}
+
+	return priority >= m.MinPriority && priority <= m.MaxPriority
+}
+
+// PriorityOf returns the first mapping that matches the pod, if any.
+func PriorityOf(pod *corev1.Pod) (PriorityMapping, bool) {
+	for _, mapping := range Slurm.PriorityMappings {
+		if mapping.Matches(pod) {
+			return mapping, true
+		}
+	}
+
+	return PriorityMapping{}, false
+}
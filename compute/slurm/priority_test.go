@@ -0,0 +1,105 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestParsePriorityMapping(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    PriorityMapping
+		wantErr bool
+	}{
+		{
+			spec: "system-cluster-critical=urgent",
+			want: PriorityMapping{PriorityClass: "system-cluster-critical", MinPriority: math.MinInt32, MaxPriority: math.MaxInt32, QOS: "urgent"},
+		},
+		{
+			spec: "1000..=high:-100",
+			want: PriorityMapping{MinPriority: 1000, MaxPriority: math.MaxInt32, QOS: "high", Nice: pointer.Int(-100)},
+		},
+		{
+			spec: "..-1=:10000",
+			want: PriorityMapping{MinPriority: math.MinInt32, MaxPriority: -1, Nice: pointer.Int(10000)},
+		},
+		{
+			spec: "0..999=normal",
+			want: PriorityMapping{MinPriority: 0, MaxPriority: 999, QOS: "normal"},
+		},
+		{spec: "urgent", wantErr: true},
+		{spec: "urgent=", wantErr: true},
+		{spec: "urgent=:", wantErr: true},
+		{spec: "urgent=high:fast", wantErr: true},
+		{spec: "10..1=high", wantErr: true},
+		{spec: "low..=high", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParsePriorityMapping(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePriorityMapping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePriorityMapping() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriorityOf(t *testing.T) {
+	mappings, err := ParsePriorityMappings([]string{"urgent=inference", "1000..=high", "..-1=:10000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := Slurm.PriorityMappings
+	Slurm.PriorityMappings = mappings
+
+	t.Cleanup(func() { Slurm.PriorityMappings = previous })
+
+	tests := []struct {
+		name          string
+		priorityClass string
+		priority      *int32
+		wantQOS       string
+		wantFound     bool
+	}{
+		{name: "by class", priorityClass: "urgent", priority: pointer.Int32(10), wantQOS: "inference", wantFound: true},
+		{name: "by range", priorityClass: "critical", priority: pointer.Int32(2000), wantQOS: "high", wantFound: true},
+		{name: "by negative range", priority: pointer.Int32(-5), wantFound: true},
+		{name: "default priority", wantFound: false},
+		{name: "unmapped priority", priority: pointer.Int32(500), wantFound: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{PriorityClassName: tt.priorityClass, Priority: tt.priority}}
+
+			got, found := PriorityOf(pod)
+			if found != tt.wantFound || got.QOS != tt.wantQOS {
+				t.Errorf("PriorityOf() = %v, %v, want qos %s, %v", got, found, tt.wantQOS, tt.wantFound)
+			}
+		})
+	}
+}
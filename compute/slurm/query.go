@@ -0,0 +1,217 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+)
+
+// JobState is the state of a Slurm job, as reported by squeue and sacct.
+// https://slurm.schedmd.com/squeue.html#SECTION_JOB-STATE-CODES
+type JobState string
+
+const (
+	JobStatePending     JobState = "PENDING"
+	JobStateRunning     JobState = "RUNNING"
+	JobStateCompleted   JobState = "COMPLETED"
+	JobStateFailed      JobState = "FAILED"
+	JobStateTimeout     JobState = "TIMEOUT"
+	JobStateNodeFail    JobState = "NODE_FAIL"
+	JobStatePreempted   JobState = "PREEMPTED"
+	JobStateOutOfMemory JobState = "OUT_OF_MEMORY"
+	JobStateCancelled   JobState = "CANCELLED"
+	JobStateRequeued    JobState = "REQUEUED"
+	JobStateRequeueHold JobState = "REQUEUE_HOLD"
+	JobStateRequeueFed  JobState = "REQUEUE_FED"
+)
+
+// ReasonDependencyNeverSatisfied is the pending reason of jobs whose dependencies have failed.
+const ReasonDependencyNeverSatisfied = "DependencyNeverSatisfied"
+
+// IsTerminal returns true if the job will not make any further progress.
+func (s JobState) IsTerminal() bool {
+	switch s {
+	case JobStateCompleted, JobStateFailed, JobStateTimeout, JobStateNodeFail,
+		JobStatePreempted, JobStateOutOfMemory, JobStateCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsQueued returns true if the job waits in the queue, either for its first attempt or after being requeued.
+func (s JobState) IsQueued() bool {
+	switch s {
+	case JobStatePending, JobStateRequeued, JobStateRequeueHold, JobStateRequeueFed:
+		return true
+	default:
+		return false
+	}
+}
+
+// JobInfo summarizes the state of a Slurm job.
+type JobInfo struct {
+	JobID string
+
+	State JobState
+
+	// Reason explains why the job is in its current state (e.g, Priority, Resources).
+	Reason string
+
+	// StartTime is the estimated start time of pending jobs (as given by 'squeue --start'),
+	// or the actual start time of running jobs. It is zero if unknown.
+	StartTime time.Time
+
+	// ExitCode and Signal are only meaningful for terminated jobs.
+	ExitCode int
+	Signal   int
+}
+
+// QueryJobs returns the state of the given jobs through the configured Slurm client.
+func QueryJobs(jobIDs ...string) (map[string]JobInfo, error) {
+	return Slurm.Client.QueryJobs(jobIDs...)
+}
+
+// QueryJobs resolves the active jobs through squeue.
+// Jobs that have already left the queue are resolved through sacct.
+// Jobs that are known to neither of them are omitted from the result.
+func (CLI) QueryJobs(jobIDs ...string) (map[string]JobInfo, error) {
+	jobs := make(map[string]JobInfo, len(jobIDs))
+
+	if len(jobIDs) == 0 {
+		return jobs, nil
+	}
+
+	/*---------------------------------------------------
+	 * Query the active jobs
+	 *---------------------------------------------------*/
+	// --array lists every task of a job array on a separate line (e.g, 1001_4).
+	out, err := process.Execute(Slurm.QueueCmd, "--noheader", "--states=all", "--array",
+		"--jobs="+strings.Join(jobIDs, ","),
+		"--format=%i|%T|%r|%S",
+	)
+	if err != nil {
+		// squeue fails if none of the jobs is still known to the controller.
+		if !strings.Contains(string(out), "Invalid job id specified") {
+			return nil, errors.Wrapf(err, "squeue has failed. out: '%s'", out)
+		}
+	} else {
+		for _, job := range parseQueueOutput(string(out)) {
+			jobs[job.JobID] = job
+		}
+	}
+
+	/*---------------------------------------------------
+	 * Query the accounting for jobs missing from the queue
+	 *---------------------------------------------------*/
+	var missing []string
+
+	for _, jobID := range jobIDs {
+		if _, exists := jobs[jobID]; !exists {
+			missing = append(missing, jobID)
+		}
+	}
+
+	if len(missing) == 0 {
+		return jobs, nil
+	}
+
+	out, err = process.Execute(Slurm.AccountingCmd, "--noheader", "--parsable2", "--allocations",
+		"--jobs="+strings.Join(missing, ","),
+		"--format=JobID,State,Reason,ExitCode",
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "sacct has failed. out: '%s'", out)
+	}
+
+	for _, job := range parseAccountingOutput(string(out)) {
+		jobs[job.JobID] = job
+	}
+
+	return jobs, nil
+}
+
+// parseQueueOutput parses lines in the format "JobID|State|Reason|StartTime".
+func parseQueueOutput(out string) []JobInfo {
+	var jobs []JobInfo
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), "|")
+		if len(fields) != 4 {
+			continue
+		}
+
+		jobs = append(jobs, JobInfo{
+			JobID:     fields[0],
+			State:     parseJobState(fields[1]),
+			Reason:    fields[2],
+			StartTime: parseTime(fields[3]),
+		})
+	}
+
+	return jobs
+}
+
+// parseTime parses the timestamps of Slurm (e.g, "2023-10-16T14:00:00"), which are given in local time.
+// Unknown times (e.g, "N/A", "Unknown") are returned as zero.
+func parseTime(raw string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02T15:04:05", strings.TrimSpace(raw), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+// parseAccountingOutput parses lines in the format "JobID|State|Reason|ExitCode:Signal".
+func parseAccountingOutput(out string) []JobInfo {
+	var jobs []JobInfo
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), "|")
+		if len(fields) != 4 {
+			continue
+		}
+
+		job := JobInfo{
+			JobID:  fields[0],
+			State:  parseJobState(fields[1]),
+			Reason: fields[2],
+		}
+
+		exitCode, signal, _ := strings.Cut(fields[3], ":")
+		job.ExitCode, _ = strconv.Atoi(exitCode)
+		job.Signal, _ = strconv.Atoi(signal)
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs
+}
+
+// parseJobState drops any decorations from the state (e.g, "CANCELLED by 1000").
+func parseJobState(raw string) JobState {
+	state, _, _ := strings.Cut(strings.TrimSpace(raw), " ")
+
+	return JobState(strings.TrimSuffix(state, "+"))
+}
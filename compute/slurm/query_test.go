@@ -0,0 +1,155 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_parseQueueOutput(t *testing.T) {
+	out := "1001|PENDING|Priority|2023-10-16T14:30:00\n1002|PENDING|Resources|N/A\n1003|RUNNING|None|2023-10-16T12:00:00\n\nmalformed\n"
+
+	want := []JobInfo{
+		{JobID: "1001", State: JobStatePending, Reason: "Priority", StartTime: time.Date(2023, 10, 16, 14, 30, 0, 0, time.Local)},
+		{JobID: "1002", State: JobStatePending, Reason: "Resources"},
+		{JobID: "1003", State: JobStateRunning, Reason: "None", StartTime: time.Date(2023, 10, 16, 12, 0, 0, 0, time.Local)},
+	}
+
+	if got := parseQueueOutput(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseQueueOutput() = %v, want %v", got, want)
+	}
+}
+
+func Test_parseAccountingOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want JobInfo
+	}{
+		{
+			name: "completed",
+			out:  "1001|COMPLETED|None|0:0",
+			want: JobInfo{JobID: "1001", State: JobStateCompleted, Reason: "None"},
+		},
+		{
+			name: "cancelled by user",
+			out:  "1002|CANCELLED by 1000|None|0:15",
+			want: JobInfo{JobID: "1002", State: JobStateCancelled, Reason: "None", Signal: 15},
+		},
+		{
+			name: "out of memory",
+			out:  "1003|OUT_OF_MEMORY|None|0:125",
+			want: JobInfo{JobID: "1003", State: JobStateOutOfMemory, Reason: "None", Signal: 125},
+		},
+		{
+			name: "failed",
+			out:  "1004|FAILED|NonZeroExitCode|2:0",
+			want: JobInfo{JobID: "1004", State: JobStateFailed, Reason: "NonZeroExitCode", ExitCode: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseAccountingOutput(tt.out)
+			if len(got) != 1 || !reflect.DeepEqual(got[0], tt.want) {
+				t.Errorf("parseAccountingOutput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ApplyJobState(t *testing.T) {
+	newPod := func() *corev1.Pod {
+		return &corev1.Pod{
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "main", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		job        JobInfo
+		applied    bool
+		wantPhase  corev1.PodPhase
+		wantReason string
+	}{
+		{
+			name:      "running job",
+			job:       JobInfo{JobID: "1", State: JobStateRunning},
+			applied:   false,
+			wantPhase: corev1.PodRunning,
+		},
+		{
+			name:       "completed job",
+			job:        JobInfo{JobID: "1", State: JobStateCompleted},
+			applied:    true,
+			wantPhase:  corev1.PodSucceeded,
+			wantReason: "Completed",
+		},
+		{
+			name:       "cancelled job",
+			job:        JobInfo{JobID: "1", State: JobStateCancelled},
+			applied:    true,
+			wantPhase:  corev1.PodFailed,
+			wantReason: "Cancelled",
+		},
+		{
+			name:       "time limit",
+			job:        JobInfo{JobID: "1", State: JobStateTimeout},
+			applied:    true,
+			wantPhase:  corev1.PodFailed,
+			wantReason: "DeadlineExceeded",
+		},
+		{
+			name:       "node failure",
+			job:        JobInfo{JobID: "1", State: JobStateNodeFail},
+			applied:    true,
+			wantPhase:  corev1.PodFailed,
+			wantReason: "NodeLost",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newPod()
+
+			if applied := ApplyJobState(pod, tt.job); applied != tt.applied {
+				t.Fatalf("ApplyJobState() = %v, want %v", applied, tt.applied)
+			}
+
+			if pod.Status.Phase != tt.wantPhase {
+				t.Errorf("phase = %v, want %v", pod.Status.Phase, tt.wantPhase)
+			}
+
+			if tt.applied {
+				if pod.Status.Reason != tt.wantReason {
+					t.Errorf("reason = %v, want %v", pod.Status.Reason, tt.wantReason)
+				}
+
+				if pod.Status.ContainerStatuses[0].State.Terminated == nil {
+					t.Errorf("container is not terminated")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"fmt"
+
+	"github.com/carv-ics-forth/hpk/pkg/crdtools"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/************************************************************
+
+			Requeue and Preemption
+
+************************************************************/
+
+// ReasonPreempted is the reason of pods whose job has been put back in the queue by Slurm
+// (e.g, due to preemption, node failure, or 'scontrol requeue').
+const ReasonPreempted = "Preempted"
+
+// RequeueFlag maps the restart policy of the pod to the requeue behavior of its job.
+// Jobs of pods that must never restart are not requeued after preemption or node failure.
+func RequeueFlag(pod *corev1.Pod) string {
+	if pod.Spec.RestartPolicy == corev1.RestartPolicyNever {
+		return "--no-requeue"
+	}
+
+	return "--requeue"
+}
+
+// ApplyRequeue resets the pod to Pending, for a new attempt of its job.
+// Every container that has started during the previous attempt is restarted, and keeps its
+// last state as LastTerminationState.
+func ApplyRequeue(pod *corev1.Pod, job JobInfo) {
+	restart := func(status *corev1.ContainerStatus) {
+		switch {
+		case status.State.Terminated != nil:
+			status.LastTerminationState = corev1.ContainerState{Terminated: status.State.Terminated}
+		case status.State.Running != nil:
+			status.LastTerminationState = corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{
+					ExitCode:    143,
+					Reason:      ReasonPreempted,
+					Message:     "Slurm job was requeued",
+					StartedAt:   status.State.Running.StartedAt,
+					FinishedAt:  metav1.Now(),
+					ContainerID: status.ContainerID,
+				},
+			}
+		default:
+			/*-- the container has not started yet --*/
+			return
+		}
+
+		status.RestartCount++
+
+		started := false
+		status.Started = &started
+		status.Ready = false
+		status.ContainerID = ""
+		status.State = corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{
+				Reason:  ReasonInSlurmQueue,
+				Message: "Job waiting in the Slurm queue",
+			},
+		}
+	}
+
+	for i := range pod.Status.InitContainerStatuses {
+		restart(&pod.Status.InitContainerStatuses[i])
+	}
+
+	for i := range pod.Status.ContainerStatuses {
+		restart(&pod.Status.ContainerStatuses[i])
+	}
+
+	/*---------------------------------------------------
+	 * Return the Pod to Pending
+	 *---------------------------------------------------*/
+	pod.Status.Phase = corev1.PodPending
+	pod.Status.Reason = ReasonPreempted
+	pod.Status.Message = fmt.Sprintf("Slurm job '%s' has been requeued (%s)", job.JobID, job.Reason)
+
+	// the new attempt may run on a different node, and will announce its own ip.
+	pod.Status.PodIP = ""
+	pod.Status.PodIPs = nil
+
+	// only keep the scheduling condition. the rest are set again as the new attempt progresses.
+	conditions := make([]corev1.PodCondition, 0, len(pod.Status.Conditions))
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled {
+			conditions = append(conditions, condition)
+		}
+	}
+
+	pod.Status.Conditions = conditions
+
+	for _, conditionType := range []corev1.PodConditionType{corev1.PodInitialized, corev1.ContainersReady, corev1.PodReady} {
+		crdtools.SetPodStatusCondition(&pod.Status.Conditions, corev1.PodCondition{
+			Type:               conditionType,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             ReasonPreempted,
+			Message:            "Slurm job has been requeued",
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRequeueFlag(t *testing.T) {
+	tests := []struct {
+		policy corev1.RestartPolicy
+		want   string
+	}{
+		{policy: corev1.RestartPolicyNever, want: "--no-requeue"},
+		{policy: corev1.RestartPolicyOnFailure, want: "--requeue"},
+		{policy: corev1.RestartPolicyAlways, want: "--requeue"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{RestartPolicy: tt.policy}}
+
+			if got := RequeueFlag(pod); got != tt.want {
+				t.Errorf("RequeueFlag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyRequeue(t *testing.T) {
+	pod := &corev1.Pod{
+		Status: corev1.PodStatus{
+			Phase:  corev1.PodRunning,
+			PodIP:  "10.0.0.1",
+			PodIPs: []corev1.PodIP{{IP: "10.0.0.1"}},
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+				{Type: "slurm.hpk.io/NodesReady", Status: corev1.ConditionTrue},
+			},
+			InitContainerStatuses: []corev1.ContainerStatus{
+				{Name: "init", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
+			},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "main", RestartCount: 1, ContainerID: "pid://42", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				{Name: "sidecar", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "InSlurmQueue"}}},
+			},
+		},
+	}
+
+	ApplyRequeue(pod, JobInfo{JobID: "1001", State: JobStatePending, Reason: "BeginTime"})
+
+	if pod.Status.Phase != corev1.PodPending || pod.Status.Reason != ReasonPreempted {
+		t.Errorf("pod = (%v, %v), want (%v, %v)", pod.Status.Phase, pod.Status.Reason, corev1.PodPending, ReasonPreempted)
+	}
+
+	if pod.Status.PodIP != "" || len(pod.Status.PodIPs) != 0 {
+		t.Errorf("pod ip = %v, want none", pod.Status.PodIPs)
+	}
+
+	if len(pod.Status.Conditions) != 4 {
+		t.Errorf("conditions = %v, want scheduled, initialized, ready, and containers ready", pod.Status.Conditions)
+	}
+
+	tests := []struct {
+		status           corev1.ContainerStatus
+		wantRestartCount int32
+		wantLastReason   string
+	}{
+		{status: pod.Status.InitContainerStatuses[0], wantRestartCount: 1, wantLastReason: "Completed"},
+		{status: pod.Status.ContainerStatuses[0], wantRestartCount: 2, wantLastReason: ReasonPreempted},
+		{status: pod.Status.ContainerStatuses[1], wantRestartCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status.Name, func(t *testing.T) {
+			if tt.status.RestartCount != tt.wantRestartCount {
+				t.Errorf("restartCount = %v, want %v", tt.status.RestartCount, tt.wantRestartCount)
+			}
+
+			if tt.status.State.Waiting == nil {
+				t.Errorf("container is not waiting")
+			}
+
+			if tt.wantLastReason == "" {
+				return
+			}
+
+			if last := tt.status.LastTerminationState.Terminated; last == nil || last.Reason != tt.wantLastReason {
+				t.Errorf("lastTerminationState = %v, want reason %v", tt.status.LastTerminationState, tt.wantLastReason)
+			}
+
+			if tt.status.ContainerID != "" {
+				t.Errorf("containerID = %v, want none", tt.status.ContainerID)
+			}
+		})
+	}
+}
@@ -0,0 +1,631 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+)
+
+/************************************************************
+
+			Slurm REST API (slurmrestd)
+
+************************************************************/
+
+// REST talks with the Slurm controller through the JSON API of slurmrestd.
+// https://slurm.schedmd.com/rest_api.html
+type REST struct {
+	// Endpoint is the base URL of slurmrestd (e.g, http://localhost:6820).
+	Endpoint string
+
+	// APIVersion is the version of the slurm and slurmdb plugins (e.g, v0.0.39).
+	APIVersion string
+
+	// UserName and Token are used for the JWT authentication.
+	UserName string
+	Token    string
+
+	HTTPClient *http.Client
+}
+
+// NewREST returns a client for the slurmrestd listening on the given endpoint.
+func NewREST(endpoint, apiVersion, userName, token string) *REST {
+	return &REST{
+		Endpoint:   strings.TrimSuffix(endpoint, "/"),
+		APIVersion: apiVersion,
+		UserName:   userName,
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// restDirectives maps sbatch options to the job properties of slurmrestd.
+// slurmrestd ignores the #SBATCH directives of the script, so we have to pass them explicitly.
+var restDirectives = map[string]string{
+	"job-name":        "name",
+	"output":          "standard_output",
+	"error":           "standard_error",
+	"partition":       "partition",
+	"account":         "account",
+	"qos":             "qos",
+	"reservation":     "reservation",
+	"nodes":           "nodes",
+	"ntasks":          "tasks",
+	"ntasks-per-node": "tasks_per_node",
+	"cpus-per-task":   "cpus_per_task",
+	"mem":             "memory_per_node",
+	"time":            "time_limit",
+	"dependency":      "dependency",
+	"array":           "array",
+	"nice":            "nice",
+	"gres":            "gres",
+	"gpus-per-node":   "gpus_per_node",
+	"licenses":        "licenses",
+	"exclude":         "excluded_nodes",
+}
+
+type restError struct {
+	Error       string `json:"error"`
+	ErrorNumber int    `json:"error_number"`
+	Description string `json:"description"`
+}
+
+type restErrors []restError
+
+// Err returns nil if there are no errors, or merges them into a single error.
+func (in restErrors) Err() error {
+	if len(in) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(in))
+
+	for _, e := range in {
+		messages = append(messages, strings.TrimSpace(e.Error+" "+e.Description))
+	}
+
+	return errors.New(strings.Join(messages, "; "))
+}
+
+type restSubmitRequest struct {
+	Script string         `json:"script"`
+	Job    map[string]any `json:"job"`
+}
+
+type restSubmitResponse struct {
+	JobID  restNumber `json:"job_id"`
+	Errors restErrors `json:"errors"`
+}
+
+type restJob struct {
+	JobID       restNumber   `json:"job_id"`
+	JobState    restState    `json:"job_state"`
+	StateReason string       `json:"state_reason"`
+	StartTime   restNumber   `json:"start_time"`
+	ExitCode    restExitCode `json:"exit_code"`
+
+	ArrayJobID      restNumber `json:"array_job_id"`
+	ArrayTaskID     restNumber `json:"array_task_id"`
+	ArrayTaskString string     `json:"array_task_string"`
+}
+
+// IDs returns the ids that the record stands for. Pending tasks of a job array are
+// folded into a single record, that must be expanded into one id per task.
+func (j restJob) IDs() []string {
+	switch {
+	case j.ArrayJobID == 0:
+		return []string{j.JobID.String()}
+	case j.ArrayTaskString != "":
+		var ids []string
+
+		for _, index := range expandArrayIndices(j.ArrayTaskString) {
+			ids = append(ids, ArrayTaskID(j.ArrayJobID.String(), index))
+		}
+
+		return ids
+	default:
+		return []string{ArrayTaskID(j.ArrayJobID.String(), int(j.ArrayTaskID))}
+	}
+}
+
+type restJobsResponse struct {
+	Jobs   []restJob  `json:"jobs"`
+	Errors restErrors `json:"errors"`
+}
+
+type restAccountingJob struct {
+	JobID restNumber `json:"job_id"`
+	Array struct {
+		JobID  restNumber `json:"job_id"`
+		TaskID restNumber `json:"task_id"`
+	} `json:"array"`
+	State struct {
+		Current restState `json:"current"`
+		Reason  string    `json:"reason"`
+	} `json:"state"`
+	ExitCode restExitCode `json:"exit_code"`
+	Time     struct {
+		Elapsed restNumber `json:"elapsed"`
+	} `json:"time"`
+	Nodes string               `json:"nodes"`
+	Steps []restAccountingStep `json:"steps"`
+}
+
+// matches returns true if the record belongs to the given job, or task of a job array.
+func (j restAccountingJob) matches(jobID string) bool {
+	return j.JobID.String() == jobID ||
+		(j.Array.JobID != 0 && ArrayTaskID(j.Array.JobID.String(), int(j.Array.TaskID)) == jobID)
+}
+
+type restAccountingStep struct {
+	TRES struct {
+		Requested struct {
+			Max []restTRES `json:"max"`
+		} `json:"requested"`
+	} `json:"tres"`
+}
+
+// restTRES is a trackable resource (e.g, cpu, mem), as reported by the accounting.
+type restTRES struct {
+	Type  string     `json:"type"`
+	Count restNumber `json:"count"`
+}
+
+type restAccountingResponse struct {
+	Jobs   []restAccountingJob `json:"jobs"`
+	Errors restErrors          `json:"errors"`
+}
+
+type restNodesResponse struct {
+	Stats
+	Errors restErrors `json:"errors"`
+}
+
+type restPingResponse struct {
+	Pings []struct {
+		Hostname string `json:"hostname"`
+		Ping     string `json:"ping"`
+		Pinged   string `json:"pinged"`
+	} `json:"pings"`
+	Errors restErrors `json:"errors"`
+}
+
+type restEmptyResponse struct {
+	Errors restErrors `json:"errors"`
+}
+
+// restNumber decodes both plain numbers and the {"set": true, "number": N} objects of newer API versions.
+type restNumber int64
+
+func (n *restNumber) UnmarshalJSON(data []byte) error {
+	var plain int64
+	if err := json.Unmarshal(data, &plain); err == nil {
+		*n = restNumber(plain)
+		return nil
+	}
+
+	var wrapped struct {
+		Number *int64 `json:"number"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil || wrapped.Number == nil {
+		return errors.Errorf("unexpected number format '%s'", data)
+	}
+
+	*n = restNumber(*wrapped.Number)
+
+	return nil
+}
+
+// Time interprets the number as a unix timestamp. Unset timestamps are returned as zero.
+func (n restNumber) Time() time.Time {
+	if n <= 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(int64(n), 0)
+}
+
+func (n restNumber) String() string {
+	return strconv.FormatInt(int64(n), 10)
+}
+
+// restState decodes both plain states and the state lists (e.g, ["RUNNING"]) of newer API versions.
+type restState string
+
+func (s *restState) UnmarshalJSON(data []byte) error {
+	var plain string
+	if err := json.Unmarshal(data, &plain); err == nil {
+		*s = restState(plain)
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.Wrapf(err, "unexpected state format '%s'", data)
+	}
+
+	if len(list) > 0 {
+		*s = restState(list[0])
+	}
+
+	return nil
+}
+
+// restExitCode decodes both plain exit codes and the {"return_code": N, "signal": {"id": N}} objects.
+type restExitCode struct {
+	ReturnCode int
+	Signal     int
+}
+
+func (e *restExitCode) UnmarshalJSON(data []byte) error {
+	var plain restNumber
+	if err := json.Unmarshal(data, &plain); err == nil {
+		e.ReturnCode = int(plain)
+		return nil
+	}
+
+	var wrapped struct {
+		ReturnCode restNumber `json:"return_code"`
+		Signal     struct {
+			ID restNumber `json:"id"`
+		} `json:"signal"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return errors.Wrapf(err, "unexpected exit code format '%s'", data)
+	}
+
+	e.ReturnCode = int(wrapped.ReturnCode)
+	e.Signal = int(wrapped.Signal.ID)
+
+	return nil
+}
+
+// jobEnvironment is the environment of the jobs submitted via slurmrestd. It is the same as the
+// environment that sbatch passes to the jobs, so that pods run alike on both backends.
+func jobEnvironment() []string {
+	return append(os.Environ(), process.GoEnviron...)
+}
+
+func (c *REST) SubmitJob(scriptFile string) (string, error) {
+	script, err := os.ReadFile(scriptFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot read script '%s'", scriptFile)
+	}
+
+	job := parseDirectives(string(script))
+	job["current_working_directory"] = filepath.Dir(scriptFile)
+	job["environment"] = jobEnvironment()
+
+	var res restSubmitResponse
+
+	if err := c.do(http.MethodPost, c.slurmPath("job", "submit"), restSubmitRequest{
+		Script: string(script),
+		Job:    job,
+	}, &res); err != nil {
+		// slurmrestd may be restarting, so the submission can be retried.
+		return "", errors.Wrap(ErrControllerTimeout, err.Error())
+	}
+
+	if err := res.Errors.Err(); err != nil {
+		return "", ClassifySubmitError(err.Error(), err)
+	}
+
+	return res.JobID.String(), nil
+}
+
+func (c *REST) CancelJob(jobID string) (string, error) {
+	var res restEmptyResponse
+
+	if err := c.do(http.MethodDelete, c.slurmPath("job", jobID), nil, &res); err != nil {
+		return "", errors.Wrapf(err, "Could not cancel job")
+	}
+
+	if err := res.Errors.Err(); err != nil {
+		// in this case, the job does not exist, so for what it matters it is terminated.
+		if strings.Contains(err.Error(), "Invalid job id specified") {
+			return err.Error(), ErrInvalidJob
+		}
+
+		if strings.Contains(err.Error(), "Job can not be altered now, try again later") {
+			return err.Error(), ErrRety
+		}
+
+		return err.Error(), errors.Wrap(err, "Could not cancel job")
+	}
+
+	return "", nil
+}
+
+func (c *REST) TerminateJob(jobID string) (string, error) {
+	var res restEmptyResponse
+
+	if err := c.do(http.MethodDelete, c.slurmPath("job", jobID)+"?signal=SIGTERM&flags=BATCH_JOB", nil, &res); err != nil {
+		return "", errors.Wrapf(err, "Could not signal job")
+	}
+
+	if err := res.Errors.Err(); err != nil {
+		if strings.Contains(err.Error(), "Invalid job id specified") {
+			return err.Error(), ErrInvalidJob
+		}
+
+		if strings.Contains(err.Error(), "Job can not be altered now, try again later") {
+			return err.Error(), ErrRety
+		}
+
+		return err.Error(), errors.Wrap(err, "Could not signal job")
+	}
+
+	return "", nil
+}
+
+func (c *REST) UpdateTimeLimit(jobID string, limit time.Duration) error {
+	var res restEmptyResponse
+
+	if err := c.do(http.MethodPost, c.slurmPath("job", jobID), map[string]any{
+		"time_limit": timeLimitMinutes(limit),
+	}, &res); err != nil {
+		return errors.Wrapf(err, "job update error")
+	}
+
+	if err := res.Errors.Err(); err != nil {
+		if strings.Contains(err.Error(), "Invalid job id specified") {
+			return ErrInvalidJob
+		}
+
+		return errors.Wrapf(err, "job update error")
+	}
+
+	return nil
+}
+
+func (c *REST) QueryJobs(jobIDs ...string) (map[string]JobInfo, error) {
+	jobs := make(map[string]JobInfo, len(jobIDs))
+
+	if len(jobIDs) == 0 {
+		return jobs, nil
+	}
+
+	/*---------------------------------------------------
+	 * Query the active jobs
+	 *---------------------------------------------------*/
+	var active restJobsResponse
+
+	if err := c.do(http.MethodGet, c.slurmPath("jobs"), nil, &active); err != nil {
+		return nil, errors.Wrapf(err, "job query error")
+	}
+
+	if err := active.Errors.Err(); err != nil {
+		return nil, errors.Wrapf(err, "job query error")
+	}
+
+	requested := make(map[string]bool, len(jobIDs))
+	for _, jobID := range jobIDs {
+		requested[jobID] = true
+	}
+
+	for _, job := range active.Jobs {
+		for _, jobID := range job.IDs() {
+			if requested[jobID] {
+				jobs[jobID] = JobInfo{
+					JobID:     jobID,
+					State:     parseJobState(string(job.JobState)),
+					Reason:    job.StateReason,
+					StartTime: job.StartTime.Time(),
+					ExitCode:  job.ExitCode.ReturnCode,
+					Signal:    job.ExitCode.Signal,
+				}
+			}
+		}
+	}
+
+	/*---------------------------------------------------
+	 * Query the accounting for jobs missing from the queue
+	 *---------------------------------------------------*/
+	for _, jobID := range jobIDs {
+		if _, exists := jobs[jobID]; exists {
+			continue
+		}
+
+		var accounting restAccountingResponse
+
+		if err := c.do(http.MethodGet, c.slurmdbPath("job", jobID), nil, &accounting); err != nil {
+			return nil, errors.Wrapf(err, "accounting query error")
+		}
+
+		// jobs that are unknown to the accounting are omitted.
+		for _, job := range accounting.Jobs {
+			if !job.matches(jobID) {
+				continue
+			}
+
+			jobs[jobID] = JobInfo{
+				JobID:    jobID,
+				State:    parseJobState(string(job.State.Current)),
+				Reason:   job.State.Reason,
+				ExitCode: job.ExitCode.ReturnCode,
+				Signal:   job.ExitCode.Signal,
+			}
+		}
+	}
+
+	return jobs, nil
+}
+
+func (c *REST) QueryAccounting(jobID string) (Accounting, error) {
+	var res restAccountingResponse
+
+	if err := c.do(http.MethodGet, c.slurmdbPath("job", jobID), nil, &res); err != nil {
+		return Accounting{}, errors.Wrapf(err, "accounting query error")
+	}
+
+	for _, job := range res.Jobs {
+		if !job.matches(jobID) {
+			continue
+		}
+
+		accounting := Accounting{
+			JobID:    jobID,
+			State:    parseJobState(string(job.State.Current)),
+			ExitCode: job.ExitCode.ReturnCode,
+			Signal:   job.ExitCode.Signal,
+			Elapsed:  time.Duration(job.Time.Elapsed) * time.Second,
+			NodeList: job.Nodes,
+		}
+
+		for _, step := range job.Steps {
+			for _, tres := range step.TRES.Requested.Max {
+				if tres.Type == "mem" && int64(tres.Count) > accounting.MaxRSS {
+					accounting.MaxRSS = int64(tres.Count)
+				}
+			}
+		}
+
+		return accounting, nil
+	}
+
+	return Accounting{}, errors.Wrapf(ErrInvalidJob, "job '%s' is not in the accounting", jobID)
+}
+
+func (c *REST) ClusterStats() (Stats, error) {
+	var res restNodesResponse
+
+	if err := c.do(http.MethodGet, c.slurmPath("nodes"), nil, &res); err != nil {
+		return Stats{}, errors.Wrapf(err, "stats query error")
+	}
+
+	if err := res.Errors.Err(); err != nil {
+		return Stats{}, errors.Wrapf(err, "stats query error")
+	}
+
+	return res.Stats, nil
+}
+
+func (c *REST) Ping() error {
+	var res restPingResponse
+
+	if err := c.do(http.MethodGet, c.slurmPath("ping"), nil, &res); err != nil {
+		return errors.Wrapf(err, "ping error")
+	}
+
+	if err := res.Errors.Err(); err != nil {
+		return errors.Wrapf(err, "ping error")
+	}
+
+	for _, ping := range res.Pings {
+		if ping.Ping == "UP" || ping.Pinged == "UP" {
+			return nil
+		}
+	}
+
+	return errors.New("slurm controller is not responding")
+}
+
+func (c *REST) slurmPath(elem ...string) string {
+	return "/slurm/" + c.APIVersion + "/" + strings.Join(elem, "/")
+}
+
+func (c *REST) slurmdbPath(elem ...string) string {
+	return "/slurmdb/" + c.APIVersion + "/" + strings.Join(elem, "/")
+}
+
+// do sends the request and decodes the response into out.
+// slurmrestd reports failures within the body, so the status code is only checked for responses that cannot be decoded.
+func (c *REST) do(method string, path string, in any, out any) error {
+	var body io.Reader
+
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return errors.Wrapf(err, "cannot encode request")
+		}
+
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, c.Endpoint+path, body)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create request")
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-SLURM-USER-NAME", c.UserName)
+	req.Header.Set("X-SLURM-USER-TOKEN", c.Token)
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "request to slurmrestd has failed")
+	}
+	defer res.Body.Close()
+
+	payload, err := io.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrapf(err, "cannot read response")
+	}
+
+	if err := json.Unmarshal(payload, out); err != nil {
+		return errors.Wrapf(err, "cannot decode response. status: '%s', body: '%s'", res.Status, payload)
+	}
+
+	return nil
+}
+
+// parseDirectives translates the #SBATCH directives of the script into job properties.
+func parseDirectives(script string) map[string]any {
+	job := make(map[string]any)
+
+	for _, directive := range scanDirectives(script) {
+		switch directive.Option {
+		case "requeue":
+			job["requeue"] = true
+			continue
+		case "no-requeue":
+			job["requeue"] = false
+			continue
+		}
+
+		property, supported := restDirectives[directive.Option]
+		if !supported {
+			compute.DefaultLogger.Info("Ignore directive unsupported by slurmrestd", "directive", directive.Line)
+
+			continue
+		}
+
+		if !directive.HasValue {
+			job[property] = true
+			continue
+		}
+
+		if number, err := strconv.ParseInt(directive.Value, 10, 64); err == nil {
+			job[property] = number
+		} else {
+			job[property] = directive.Value
+		}
+	}
+
+	return job
+}
@@ -0,0 +1,238 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/pkg/errors"
+)
+
+// fakeSlurmrestd mimics the responses of slurmrestd.
+func fakeSlurmrestd(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+
+	authorized := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-SLURM-USER-NAME") != "hpk" || r.Header.Get("X-SLURM-USER-TOKEN") != "jwt" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = io.WriteString(w, `{"errors": [{"error": "Authentication failure"}]}`)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+
+	mux.HandleFunc("/slurm/v0.0.39/job/submit", authorized(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Script string         `json:"script"`
+			Job    map[string]any `json:"job"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("cannot decode submission: %v", err)
+		}
+
+		if req.Job["name"] != "mypod" || req.Job["partition"] != "gpu" || req.Job["tasks_per_node"] != float64(4) {
+			t.Errorf("unexpected job properties: %v", req.Job)
+		}
+
+		// the job inherits the environment of HPK, as with sbatch.
+		inherited := false
+
+		for _, env := range req.Job["environment"].([]any) {
+			if env == "HPK_SUBMIT_ENV=inherited" {
+				inherited = true
+			}
+		}
+
+		if !inherited {
+			t.Errorf("environment of HPK is not forwarded: %v", req.Job["environment"])
+		}
+
+		_, _ = io.WriteString(w, `{"job_id": 1001, "errors": []}`)
+	}))
+
+	mux.HandleFunc("/slurm/v0.0.39/job/1001", authorized(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+
+		if signal := r.URL.Query().Get("signal"); signal != "" && (signal != "SIGTERM" || r.URL.Query().Get("flags") != "BATCH_JOB") {
+			t.Errorf("unexpected signal %s to %s", signal, r.URL.Query().Get("flags"))
+		}
+
+		_, _ = io.WriteString(w, `{"errors": []}`)
+	}))
+
+	mux.HandleFunc("/slurm/v0.0.39/job/404", authorized(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, `{"errors": [{"error": "Invalid job id specified", "error_number": 2017}]}`)
+	}))
+
+	mux.HandleFunc("/slurm/v0.0.39/jobs", authorized(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"jobs": [
+			{"job_id": 1001, "job_state": "RUNNING", "state_reason": "None", "exit_code": 0},
+			{"job_id": 1003, "job_state": ["PENDING"], "state_reason": "Priority", "start_time": 1700000000, "exit_code": {"set": true, "number": 0}},
+			{"job_id": 2000, "array_job_id": 2000, "array_task_string": "0-2", "job_state": "PENDING", "state_reason": "Resources", "exit_code": 0},
+			{"job_id": 2004, "array_job_id": 2000, "array_task_id": 3, "job_state": "RUNNING", "state_reason": "None", "exit_code": 0}
+		], "errors": []}`)
+	}))
+
+	mux.HandleFunc("/slurmdb/v0.0.39/job/1002", authorized(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"jobs": [
+			{"job_id": 1002, "state": {"current": "TIMEOUT", "reason": "None"}, "exit_code": {"status": "SIGNALED", "return_code": 0, "signal": {"id": 15}},
+			 "time": {"elapsed": 3600}, "nodes": "node[01-02]", "steps": [
+				{"tres": {"requested": {"max": [{"type": "cpu", "count": 4}, {"type": "mem", "count": 1048576}]}}},
+				{"tres": {"requested": {"max": [{"type": "mem", "count": 2097152}]}}}
+			 ]}
+		], "errors": []}`)
+	}))
+
+	mux.HandleFunc("/slurm/v0.0.39/nodes", authorized(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"nodes": [
+			{"name": "node1", "cpus": 32, "free_memory": 64000, "partitions": ["gpu"]},
+			{"name": "node2", "cpus": 16, "free_memory": 32000, "partitions": ["cpu"]}
+		], "errors": []}`)
+	}))
+
+	mux.HandleFunc("/slurm/v0.0.39/ping", authorized(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"pings": [{"hostname": "slurmctld", "ping": "UP", "mode": "primary"}], "errors": []}`)
+	}))
+
+	return httptest.NewServer(mux)
+}
+
+func TestREST(t *testing.T) {
+	server := fakeSlurmrestd(t)
+	defer server.Close()
+
+	client := slurm.NewREST(server.URL, "v0.0.39", "hpk", "jwt")
+
+	t.Run("submit", func(t *testing.T) {
+		t.Setenv("HPK_SUBMIT_ENV", "inherited")
+
+		scriptFile := filepath.Join(t.TempDir(), "submit.sh")
+
+		script := "#!/bin/bash\n#SBATCH --job-name=mypod\n#SBATCH --partition=gpu\n#SBATCH --ntasks-per-node=4\necho hello\n"
+		if err := os.WriteFile(scriptFile, []byte(script), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		jobID, err := client.SubmitJob(scriptFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if jobID != "1001" {
+			t.Errorf("SubmitJob() = %s, want 1001", jobID)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		if _, err := client.CancelJob("1001"); err != nil {
+			t.Errorf("CancelJob() error = %v", err)
+		}
+
+		if _, err := client.CancelJob("404"); !errors.Is(err, slurm.ErrInvalidJob) {
+			t.Errorf("CancelJob() error = %v, want %v", err, slurm.ErrInvalidJob)
+		}
+	})
+
+	t.Run("terminate", func(t *testing.T) {
+		if _, err := client.TerminateJob("1001"); err != nil {
+			t.Errorf("TerminateJob() error = %v", err)
+		}
+
+		if _, err := client.TerminateJob("404"); !errors.Is(err, slurm.ErrInvalidJob) {
+			t.Errorf("TerminateJob() error = %v, want %v", err, slurm.ErrInvalidJob)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		jobs, err := client.QueryJobs("1001", "1002", "1003", "2000_1", "2000_3")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]slurm.JobInfo{
+			"1001":   {JobID: "1001", State: slurm.JobStateRunning, Reason: "None"},
+			"1002":   {JobID: "1002", State: slurm.JobStateTimeout, Reason: "None", Signal: 15},
+			"1003":   {JobID: "1003", State: slurm.JobStatePending, Reason: "Priority", StartTime: time.Unix(1700000000, 0)},
+			"2000_1": {JobID: "2000_1", State: slurm.JobStatePending, Reason: "Resources"},
+			"2000_3": {JobID: "2000_3", State: slurm.JobStateRunning, Reason: "None"},
+		}
+
+		for jobID, expected := range want {
+			if jobs[jobID] != expected {
+				t.Errorf("QueryJobs()[%s] = %v, want %v", jobID, jobs[jobID], expected)
+			}
+		}
+	})
+
+	t.Run("accounting", func(t *testing.T) {
+		accounting, err := client.QueryAccounting("1002")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := slurm.Accounting{
+			JobID:    "1002",
+			State:    slurm.JobStateTimeout,
+			Signal:   15,
+			Elapsed:  time.Hour,
+			NodeList: "node[01-02]",
+			MaxRSS:   2097152,
+		}
+
+		if accounting != want {
+			t.Errorf("QueryAccounting() = %v, want %v", accounting, want)
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		stats, err := client.ClusterStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(stats.Nodes) != 2 || stats.Nodes[0].CPUs != 32 {
+			t.Errorf("ClusterStats() = %v", stats)
+		}
+	})
+
+	t.Run("ping", func(t *testing.T) {
+		if err := client.Ping(); err != nil {
+			t.Errorf("Ping() error = %v", err)
+		}
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		unauthorized := slurm.NewREST(server.URL, "v0.0.39", "hpk", "wrong")
+
+		if _, err := unauthorized.ClusterStats(); err == nil {
+			t.Errorf("ClusterStats() expected authentication error")
+		}
+	})
+}
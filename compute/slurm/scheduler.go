@@ -0,0 +1,76 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"time"
+
+	"github.com/carv-ics-forth/hpk/pkg/pty"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Scheduler runs pods as Slurm jobs, through the configured Slurm client.
+type Scheduler struct{}
+
+func (Scheduler) Submit(scriptFile string) (string, error) {
+	return SubmitJob(scriptFile)
+}
+
+func (Scheduler) SubmitInteractive(scriptFile string, logFile string) (string, *pty.Terminal, error) {
+	return SubmitInteractive(scriptFile, logFile)
+}
+
+func (Scheduler) Cancel(jobID string) (string, error) {
+	return CancelJob(jobID)
+}
+
+func (Scheduler) Terminate(jobID string) (string, error) {
+	return TerminateJob(jobID)
+}
+
+func (Scheduler) SubmitArrayTask(group string, index int, scriptFile string) (string, error) {
+	return SubmitArrayTask(group, index, scriptFile)
+}
+
+func (Scheduler) Status(jobIDs ...string) (map[string]JobInfo, error) {
+	return QueryJobs(jobIDs...)
+}
+
+func (Scheduler) Accounting(jobID string) (Accounting, error) {
+	return QueryAccounting(jobID)
+}
+
+func (Scheduler) Capacity() (capacity corev1.ResourceList, allocatable corev1.ResourceList, err error) {
+	stats, err := Slurm.Client.ClusterStats()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	capacity, allocatable = sumResources(stats)
+
+	return capacity, allocatable, nil
+}
+
+func (Scheduler) UpdateDeadline(jobID string, deadline time.Duration) error {
+	return UpdateTimeLimit(jobID, deadline)
+}
+
+func (Scheduler) Ping() error {
+	return Slurm.Client.Ping()
+}
+
+func (Scheduler) IDType() JobIDType {
+	return JobIDTypeSlurm
+}
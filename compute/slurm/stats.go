@@ -17,84 +17,214 @@ package slurm
 
 import (
 	"context"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/carv-ics-forth/hpk/compute"
 	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/json"
 )
 
+// TotalResources returns the capacity of the cluster.
 func TotalResources() corev1.ResourceList {
-	var (
-		totalCPU       resource.Quantity
-		totalMem       resource.Quantity
-		totalStorage   resource.Quantity
-		totalEphemeral resource.Quantity
-		totalPods      resource.Quantity
-	)
-
-	for _, node := range getClusterStats().Nodes {
-		nodeResources := node.ResourceList()
-
-		if cpu := nodeResources.Cpu(); !cpu.IsZero() {
-			totalCPU.Add(*cpu)
-		}
+	capacity, _ := sumResources(getClusterStats())
 
-		if mem := nodeResources.Memory(); !mem.IsZero() {
-			totalMem.Add(*mem)
-		}
+	return capacity
+}
 
-		if storage := nodeResources.Storage(); !storage.IsZero() {
-			totalStorage.Add(*storage)
-		}
+// AllocatableResources returns the resources that are still idle in the cluster.
+func AllocatableResources(ctx context.Context) corev1.ResourceList {
+	_, allocatable := sumResources(getClusterStats())
 
-		if ephemeral := nodeResources.StorageEphemeral(); !ephemeral.IsZero() {
-			totalEphemeral.Add(*ephemeral)
-		}
+	return allocatable
+}
 
-		if pods := nodeResources.Pods(); !pods.IsZero() {
-			totalPods.Add(*pods)
-		}
+// sumResources aggregates the capacity and the allocatable resources of all the nodes in the cluster.
+func sumResources(stats Stats) (capacity corev1.ResourceList, allocatable corev1.ResourceList) {
+	capacity = emptyResources()
+	allocatable = emptyResources()
+
+	for _, node := range stats.Nodes {
+		addResources(capacity, node.Capacity())
+		addResources(allocatable, node.Allocatable())
 	}
 
+	return capacity, allocatable
+}
+
+func emptyResources() corev1.ResourceList {
 	return corev1.ResourceList{
-		corev1.ResourceCPU:              totalCPU,
-		corev1.ResourceMemory:           totalMem,
-		corev1.ResourceStorage:          totalStorage,
-		corev1.ResourceEphemeralStorage: totalEphemeral,
-		corev1.ResourcePods:             totalPods,
+		corev1.ResourceCPU:              resource.Quantity{},
+		corev1.ResourceMemory:           resource.Quantity{},
+		corev1.ResourceEphemeralStorage: resource.Quantity{},
+		corev1.ResourcePods:             resource.Quantity{},
 	}
 }
 
-func AllocatableResources(ctx context.Context) corev1.ResourceList {
-	return TotalResources()
+func addResources(total corev1.ResourceList, list corev1.ResourceList) {
+	for name, quantity := range list {
+		sum := total[name]
+		sum.Add(quantity)
+		total[name] = sum
+	}
 }
 
 type NodeInfo struct {
 	Architecture  string `json:"architecture"`
 	KernelVersion string `json:"operating_system"`
 
-	Name     string `json:"name"`
-	CPUs     uint64 `json:"cpus"`
-	CPUCores uint64 `json:"cores"`
+	Name      string `json:"name"`
+	CPUs      uint64 `json:"cpus"`
+	CPUCores  uint64 `json:"cores"`
+	AllocCPUs uint64 `json:"alloc_cpus"`
 
+	// EphemeralStorage is reported in MegaBytes.
 	EphemeralStorage uint64 `json:"temporary_disk"`
 
+	// RealMemory and AllocMemory are reported in MegaBytes.
+	RealMemory  int64 `json:"real_memory"`
+	AllocMemory int64 `json:"alloc_memory"`
+
 	// FreeMemory ... reported in MegaBytes
 	//[TODO: temporarily changed it to int64 due to sometimes slurm declares freememory as "-2"]
 	FreeMemory int64    `json:"free_memory"`
 	Partitions []string `json:"partitions"`
+
+	Features StringList `json:"features"`
+
+	// Gres and GresUsed are the generic resources of the node (e.g, "gpu:a100:4(S:0-1)").
+	Gres     string `json:"gres"`
+	GresUsed string `json:"gres_used"`
+
+	// State is the list of state flags (e.g, IDLE, DRAIN).
+	State StringList `json:"state"`
 }
 
-// ResourceList converts the Slurm-reported stats into Kubernetes-Stats.
-func (i NodeInfo) ResourceList() corev1.ResourceList {
-	return corev1.ResourceList{
-		"cpu":       *resource.NewQuantity(int64(i.CPUs), resource.DecimalSI),
-		"memory":    *resource.NewScaledQuantity(int64(i.FreeMemory), resource.Mega),
-		"ephemeral": *resource.NewQuantity(int64(i.EphemeralStorage), resource.DecimalSI),
-		"pods":      resource.MustParse("110"),
+// StringList decodes both the comma-separated strings of older versions (e.g, "gpu,a100" or "IDLE+DRAIN"),
+// and the lists of newer versions.
+type StringList []string
+
+func (f *StringList) UnmarshalJSON(data []byte) error {
+	var plain string
+	if err := json.Unmarshal(data, &plain); err == nil {
+		*f = nil
+
+		for _, item := range strings.FieldsFunc(plain, func(r rune) bool { return r == ',' || r == '+' }) {
+			if item = strings.TrimSpace(item); item != "" {
+				*f = append(*f, item)
+			}
+		}
+
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.Wrapf(err, "unexpected list format '%s'", data)
+	}
+
+	*f = list
+
+	return nil
+}
+
+// unavailableStates are the node states that prevent new jobs from running on the node.
+var unavailableStates = []string{
+	"DOWN", "DRAIN", "DRAINED", "DRAINING", "FAIL", "FAILING", "FUTURE",
+	"MAINTENANCE", "NOT_RESPONDING", "POWERED_DOWN", "POWER_DOWN", "INVALID", "UNKNOWN",
+}
+
+// Available returns false if Slurm will not start new jobs on the node.
+func (i NodeInfo) Available() bool {
+	for _, state := range i.State {
+		// a trailing asterisk means that the node is not responding.
+		if strings.HasSuffix(state, "*") {
+			return false
+		}
+
+		if slices.Contains(unavailableStates, strings.ToUpper(state)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Capacity converts the Slurm-reported stats into Kubernetes-Stats.
+func (i NodeInfo) Capacity() corev1.ResourceList {
+	pods := int64(Slurm.PodsPerNode)
+	if pods == 0 {
+		// every job holds at least one cpu.
+		pods = int64(i.CPUs)
+	}
+
+	capacity := corev1.ResourceList{
+		corev1.ResourceCPU:              *resource.NewQuantity(int64(i.CPUs), resource.DecimalSI),
+		corev1.ResourceMemory:           *resource.NewQuantity(megabytes(i.RealMemory), resource.BinarySI),
+		corev1.ResourceEphemeralStorage: *resource.NewQuantity(megabytes(int64(i.EphemeralStorage)), resource.BinarySI),
+		corev1.ResourcePods:             *resource.NewQuantity(pods, resource.DecimalSI),
+	}
+
+	for name, quantity := range extendedResources(parseGres(i.Gres)) {
+		capacity[name] = quantity
+	}
+
+	return capacity
+}
+
+// Allocatable returns the resources of the node that are not allocated to any job.
+// Nodes that are down or drained have no allocatable resources.
+func (i NodeInfo) Allocatable() corev1.ResourceList {
+	allocatable := emptyResources()
+
+	capacity := i.Capacity()
+
+	if !i.Available() {
+		// advertise the extended resources even if they are not allocatable.
+		for name := range capacity {
+			allocatable[name] = resource.Quantity{}
+		}
+
+		return allocatable
+	}
+
+	var idleCPUs int64
+	if i.CPUs > i.AllocCPUs {
+		idleCPUs = int64(i.CPUs - i.AllocCPUs)
+	}
+
+	allocatable[corev1.ResourceCPU] = *resource.NewQuantity(idleCPUs, resource.DecimalSI)
+	allocatable[corev1.ResourceMemory] = *resource.NewQuantity(megabytes(max(i.RealMemory-i.AllocMemory, 0)), resource.BinarySI)
+	allocatable[corev1.ResourceEphemeralStorage] = capacity[corev1.ResourceEphemeralStorage]
+	allocatable[corev1.ResourcePods] = capacity[corev1.ResourcePods]
+
+	used := extendedResources(parseGres(i.GresUsed))
+
+	for name := range extendedResources(parseGres(i.Gres)) {
+		idle := capacity[name]
+		idle.Sub(used[name])
+
+		if idle.Sign() < 0 {
+			idle = resource.Quantity{}
+		}
+
+		allocatable[name] = idle
+	}
+
+	return allocatable
+}
+
+// megabytes converts the memory units of Slurm (MB, as in 1024*1024) into bytes.
+func megabytes(value int64) int64 {
+	if value < 0 {
+		return 0
 	}
+
+	return value * 1024 * 1024
 }
 
 type Stats struct {
@@ -102,16 +232,121 @@ type Stats struct {
 }
 
 func getClusterStats() Stats {
+	info, err := Slurm.Client.ClusterStats()
+	if err != nil {
+		compute.SystemPanic(err, "stats query error")
+	}
+
+	return info
+}
+
+func (CLI) ClusterStats() (Stats, error) {
 	out, err := process.Execute(Slurm.StatsCmd, "--long", "--json")
 	if err != nil {
-		compute.SystemPanic(err, "stats query error. out : '%s'", out)
+		return Stats{}, errors.Wrapf(err, "sinfo has failed. out : '%s'", out)
 	}
 
 	var info Stats
 
 	if err := json.Unmarshal(out, &info); err != nil {
-		compute.SystemPanic(err, "stats decoding error")
+		return Stats{}, errors.Wrapf(err, "stats decoding error")
 	}
 
-	return info
+	return info, nil
+}
+
+// PartitionInfo summarizes the nodes of a Slurm partition.
+type PartitionInfo struct {
+	Name string
+
+	// Architectures and Features are the union of the architectures and features of the partition's nodes.
+	Architectures []string
+	Features      []string
+
+	Capacity    corev1.ResourceList
+	Allocatable corev1.ResourceList
+}
+
+// Partitions groups the nodes of the cluster by partition. Nodes that belong to multiple partitions
+// are counted in each of them.
+func Partitions() ([]PartitionInfo, error) {
+	stats, err := Slurm.Client.ClusterStats()
+	if err != nil {
+		return nil, errors.Wrapf(err, "stats query error")
+	}
+
+	return groupByPartition(stats), nil
+}
+
+// PartitionResources returns the capacity and the allocatable resources of the given partition.
+func PartitionResources(name string) (capacity corev1.ResourceList, allocatable corev1.ResourceList, err error) {
+	partitions, err := Partitions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, partition := range partitions {
+		if partition.Name == name {
+			return partition.Capacity, partition.Allocatable, nil
+		}
+	}
+
+	return nil, nil, errors.Errorf("partition '%s' was not found", name)
+}
+
+func groupByPartition(stats Stats) []PartitionInfo {
+	members := make(map[string]*Stats)
+
+	for _, node := range stats.Nodes {
+		for _, partition := range node.Partitions {
+			if members[partition] == nil {
+				members[partition] = &Stats{}
+			}
+
+			members[partition].Nodes = append(members[partition].Nodes, node)
+		}
+	}
+
+	partitions := make([]PartitionInfo, 0, len(members))
+
+	for name, partitionStats := range members {
+		architectures := make(map[string]bool)
+		features := make(map[string]bool)
+
+		for _, node := range partitionStats.Nodes {
+			if node.Architecture != "" {
+				architectures[node.Architecture] = true
+			}
+
+			for _, feature := range node.Features {
+				features[feature] = true
+			}
+		}
+
+		capacity, allocatable := sumResources(*partitionStats)
+
+		partitions = append(partitions, PartitionInfo{
+			Name:          name,
+			Architectures: sortedKeys(architectures),
+			Features:      sortedKeys(features),
+			Capacity:      capacity,
+			Allocatable:   allocatable,
+		})
+	}
+
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Name < partitions[j].Name })
+
+	return partitions
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+
+	for key := range set {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
 }
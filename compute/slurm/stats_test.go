@@ -0,0 +1,113 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func Test_groupByPartition(t *testing.T) {
+	var stats Stats
+
+	if err := json.Unmarshal([]byte(`{"nodes": [
+		{"name": "node1", "architecture": "x86_64", "cpus": 32, "partitions": ["gpu", "all"], "features": "gpu,a100"},
+		{"name": "node2", "architecture": "x86_64", "cpus": 16, "partitions": ["cpu", "all"], "features": ["avx512"]},
+		{"name": "node3", "architecture": "aarch64", "cpus": 8, "partitions": ["all"], "features": ""}
+	]}`), &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	partitions := groupByPartition(stats)
+
+	want := []struct {
+		name          string
+		architectures []string
+		features      []string
+		cpus          int64
+	}{
+		{name: "all", architectures: []string{"aarch64", "x86_64"}, features: []string{"a100", "avx512", "gpu"}, cpus: 56},
+		{name: "cpu", architectures: []string{"x86_64"}, features: []string{"avx512"}, cpus: 16},
+		{name: "gpu", architectures: []string{"x86_64"}, features: []string{"a100", "gpu"}, cpus: 32},
+	}
+
+	if len(partitions) != len(want) {
+		t.Fatalf("groupByPartition() = %v, want %d partitions", partitions, len(want))
+	}
+
+	for i, expected := range want {
+		got := partitions[i]
+
+		if got.Name != expected.name {
+			t.Errorf("partition[%d] = %s, want %s", i, got.Name, expected.name)
+		}
+
+		if !reflect.DeepEqual(got.Architectures, expected.architectures) {
+			t.Errorf("%s architectures = %v, want %v", got.Name, got.Architectures, expected.architectures)
+		}
+
+		if !reflect.DeepEqual(got.Features, expected.features) {
+			t.Errorf("%s features = %v, want %v", got.Name, got.Features, expected.features)
+		}
+
+		if cpus := got.Capacity[corev1.ResourceCPU]; cpus.Value() != expected.cpus {
+			t.Errorf("%s cpus = %v, want %d", got.Name, cpus.String(), expected.cpus)
+		}
+	}
+}
+
+func Test_sumResources(t *testing.T) {
+	var stats Stats
+
+	if err := json.Unmarshal([]byte(`{"nodes": [
+		{"name": "idle", "cpus": 32, "alloc_cpus": 0, "real_memory": 1024, "alloc_memory": 0, "free_memory": 512, "temporary_disk": 100, "state": "idle"},
+		{"name": "mixed", "cpus": 32, "alloc_cpus": 8, "real_memory": 1024, "alloc_memory": 256, "free_memory": 512, "temporary_disk": 100, "state": ["MIXED"]},
+		{"name": "drained", "cpus": 32, "alloc_cpus": 0, "real_memory": 1024, "alloc_memory": 0, "free_memory": 1024, "temporary_disk": 100, "state": "IDLE+DRAIN"},
+		{"name": "unresponsive", "cpus": 32, "alloc_cpus": 0, "real_memory": 1024, "alloc_memory": 0, "free_memory": 1024, "temporary_disk": 100, "state": "idle*"}
+	]}`), &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	capacity, allocatable := sumResources(stats)
+
+	tests := []struct {
+		name     string
+		list     corev1.ResourceList
+		resource corev1.ResourceName
+		want     string
+	}{
+		{name: "capacity cpu", list: capacity, resource: corev1.ResourceCPU, want: "128"},
+		{name: "capacity memory", list: capacity, resource: corev1.ResourceMemory, want: "4Gi"},
+		{name: "capacity ephemeral storage", list: capacity, resource: corev1.ResourceEphemeralStorage, want: "400Mi"},
+		{name: "capacity pods", list: capacity, resource: corev1.ResourcePods, want: "128"},
+		{name: "allocatable cpu", list: allocatable, resource: corev1.ResourceCPU, want: "56"},
+		{name: "allocatable memory", list: allocatable, resource: corev1.ResourceMemory, want: "1792Mi"},
+		{name: "allocatable pods", list: allocatable, resource: corev1.ResourcePods, want: "64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.list[tt.resource]
+
+			if want := resource.MustParse(tt.want); got.Cmp(want) != 0 {
+				t.Errorf("%s = %s, want %s", tt.resource, got.String(), tt.want)
+			}
+		})
+	}
+}
@@ -17,10 +17,12 @@ package slurm
 
 import (
 	"regexp"
-	"strconv"
+	"strings"
+	"time"
 
-	"github.com/carv-ics-forth/hpk/compute"
 	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 // ExcludeNodes EXISTS ONLY FOR DEBUGGING PURPOSES of Inotify on NFS.
@@ -32,21 +34,103 @@ var ExcludeNodes = "--exclude="
 // With a mode value of "L", "su" is executed with the "-" option, replicating the login environment.
 var NewUserEnv = "--get-user-env=10L"
 
+// SubmitJob submits the batch script through the configured Slurm client.
 func SubmitJob(scriptFile string) (string, error) {
+	return Slurm.Client.SubmitJob(scriptFile)
+}
+
+var submittedJobID = regexp.MustCompile(`Submitted batch job (?P<jid>\d+)`)
 
+func (CLI) SubmitJob(scriptFile string) (string, error) {
 	// Submit Job
 	out, err := process.Execute(Slurm.SubmitCmd, ExcludeNodes, NewUserEnv, scriptFile)
 	if err != nil {
-		compute.SystemPanic(err, "job submission error. out : '%s'", out)
+		return "", ClassifySubmitError(string(out), err)
 	}
 
 	// Parse Job ID
-	expectedOutput := regexp.MustCompile(`Submitted batch job (?P<jid>\d+)`)
-	jid := expectedOutput.FindStringSubmatch(string(out))
-
-	if _, err := strconv.Atoi(jid[1]); err != nil {
-		compute.SystemPanic(err, "Invalid JobID")
+	jid := submittedJobID.FindStringSubmatch(string(out))
+	if jid == nil {
+		return "", errors.Errorf("unexpected output of sbatch: '%s'", out)
 	}
 
 	return jid[1], nil
 }
+
+/*---------------------------------------------------
+ * Submission Errors
+ *---------------------------------------------------*/
+
+var (
+	ErrInvalidAccount = errors.New("invalid account")
+
+	ErrInvalidPartition = errors.New("invalid partition")
+
+	ErrQOSSubmitLimit = errors.New("QOS submit limit has been reached")
+
+	ErrNodeConfigUnavailable = errors.New("requested node configuration is not available")
+
+	// ErrControllerTimeout is transient, and the submission can be retried.
+	ErrControllerTimeout = errors.New("Slurm controller is not responding")
+)
+
+// submitErrors classify the messages of sbatch and slurmrestd, along with the reason reported on the pod.
+var submitErrors = []struct {
+	message string
+	err     error
+	reason  string
+}{
+	{message: "Invalid account", err: ErrInvalidAccount, reason: "InvalidAccount"},
+	{message: "Invalid partition", err: ErrInvalidPartition, reason: "InvalidPartition"},
+	{message: "QOSMaxSubmitJob", err: ErrQOSSubmitLimit, reason: "QOSSubmitLimit"},
+	{message: "job submit limit", err: ErrQOSSubmitLimit, reason: "QOSSubmitLimit"},
+	{message: "Requested node configuration is not available", err: ErrNodeConfigUnavailable, reason: "NodeConfigUnavailable"},
+	{message: "Socket timed out", err: ErrControllerTimeout, reason: "ControllerTimeout"},
+	{message: "Unable to contact slurm controller", err: ErrControllerTimeout, reason: "ControllerTimeout"},
+	{message: "Slurm temporarily unable to accept job", err: ErrControllerTimeout, reason: "ControllerTimeout"},
+}
+
+// ReasonSubmitFailed is the reason of pods whose jobs have been rejected for an unknown reason.
+const ReasonSubmitFailed = "SubmitFailed"
+
+// ClassifySubmitError wraps the error into one of the known submission errors, according to the output of Slurm.
+// Unknown errors are returned as they are.
+func ClassifySubmitError(out string, err error) error {
+	// keep only the last line, which explains the failure.
+	message := strings.TrimSpace(out)
+	if i := strings.LastIndex(message, "\n"); i >= 0 {
+		message = message[i+1:]
+	}
+
+	for _, known := range submitErrors {
+		if strings.Contains(out, known.message) {
+			return errors.Wrap(known.err, message)
+		}
+	}
+
+	return errors.Wrapf(err, "job submission error. out: '%s'", message)
+}
+
+// SubmitFailureReason returns the reason of the submission error, as reported on the pod.
+func SubmitFailureReason(err error) string {
+	for _, known := range submitErrors {
+		if errors.Is(err, known.err) {
+			return known.reason
+		}
+	}
+
+	return ReasonSubmitFailed
+}
+
+// IsTransient returns true if the submission may succeed if retried.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrControllerTimeout)
+}
+
+// SubmitBackoff is the backoff for retrying transient submission errors.
+var SubmitBackoff = wait.Backoff{
+	Duration: 2 * time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+}
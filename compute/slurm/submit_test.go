@@ -0,0 +1,78 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestClassifySubmitError(t *testing.T) {
+	exitErr := errors.New("exit status 1")
+
+	tests := []struct {
+		name          string
+		out           string
+		wantReason    string
+		wantTransient bool
+	}{
+		{
+			name:       "invalid account",
+			out:        "sbatch: error: Batch job submission failed: Invalid account or account/partition combination specified",
+			wantReason: "InvalidAccount",
+		},
+		{
+			name:       "invalid partition",
+			out:        "sbatch: error: Batch job submission failed: Invalid partition name specified",
+			wantReason: "InvalidPartition",
+		},
+		{
+			name:       "qos submit limit",
+			out:        "sbatch: error: QOSMaxSubmitJobPerUserLimit\nsbatch: error: Batch job submission failed: Job violates accounting/QOS policy (job submit limit, user's size and/or time limits)",
+			wantReason: "QOSSubmitLimit",
+		},
+		{
+			name:       "node configuration",
+			out:        "sbatch: error: Batch job submission failed: Requested node configuration is not available",
+			wantReason: "NodeConfigUnavailable",
+		},
+		{
+			name:          "socket timeout",
+			out:           "sbatch: error: Batch job submission failed: Socket timed out on send/recv operation",
+			wantReason:    "ControllerTimeout",
+			wantTransient: true,
+		},
+		{
+			name:       "unknown",
+			out:        "sbatch: error: something unexpected",
+			wantReason: ReasonSubmitFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ClassifySubmitError(tt.out, exitErr)
+
+			if got := SubmitFailureReason(err); got != tt.wantReason {
+				t.Errorf("SubmitFailureReason() = %v, want %v", got, tt.wantReason)
+			}
+
+			if got := IsTransient(err); got != tt.wantTransient {
+				t.Errorf("IsTransient() = %v, want %v", got, tt.wantTransient)
+			}
+		})
+	}
+}
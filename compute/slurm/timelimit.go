@@ -0,0 +1,98 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+)
+
+// FormatTimeLimit converts the limit into the "days-hours:minutes:seconds" format of Slurm.
+// Slurm rounds the limit up to the next minute.
+func FormatTimeLimit(limit time.Duration) string {
+	seconds := int64(limit.Round(time.Second) / time.Second)
+
+	return fmt.Sprintf("%d-%02d:%02d:%02d", seconds/86400, seconds%86400/3600, seconds%3600/60, seconds%60)
+}
+
+// ParseTimeLimit converts a time limit of Slurm into a duration. The accepted formats are "minutes",
+// "minutes:seconds", "hours:minutes:seconds", "days-hours", "days-hours:minutes" and "days-hours:minutes:seconds".
+// Unlimited time limits are not accepted, as they cannot be compared.
+func ParseTimeLimit(limit string) (time.Duration, error) {
+	invalid := errors.Errorf("invalid time limit '%s'", limit)
+
+	days, clock, hasDays := strings.Cut(strings.TrimSpace(limit), "-")
+	if !hasDays {
+		days, clock = "0", days
+	}
+
+	var values []time.Duration
+
+	for _, field := range append([]string{days}, strings.Split(clock, ":")...) {
+		value, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return 0, invalid
+		}
+
+		values = append(values, time.Duration(value))
+	}
+
+	total := values[0] * 24 * time.Hour
+
+	switch fields := values[1:]; {
+	case len(fields) == 1 && hasDays:
+		total += fields[0] * time.Hour
+	case len(fields) == 1:
+		total += fields[0] * time.Minute
+	case len(fields) == 2 && hasDays:
+		total += fields[0]*time.Hour + fields[1]*time.Minute
+	case len(fields) == 2:
+		total += fields[0]*time.Minute + fields[1]*time.Second
+	case len(fields) == 3:
+		total += fields[0]*time.Hour + fields[1]*time.Minute + fields[2]*time.Second
+	default:
+		return 0, invalid
+	}
+
+	return total, nil
+}
+
+// timeLimitMinutes converts the limit into minutes, rounded up like Slurm does.
+func timeLimitMinutes(limit time.Duration) int64 {
+	return int64((limit + time.Minute - 1) / time.Minute)
+}
+
+// UpdateTimeLimit changes the time limit of an active job through the configured Slurm client.
+func UpdateTimeLimit(jobID string, limit time.Duration) error {
+	return Slurm.Client.UpdateTimeLimit(jobID, limit)
+}
+
+func (CLI) UpdateTimeLimit(jobID string, limit time.Duration) error {
+	out, err := process.Execute(Slurm.ControlCmd, "update", "JobId="+jobID, "TimeLimit="+FormatTimeLimit(limit))
+	if err != nil {
+		if strings.Contains(string(out), "Invalid job id specified") {
+			return ErrInvalidJob
+		}
+
+		return errors.Wrapf(err, "scontrol update has failed. out: '%s'", out)
+	}
+
+	return nil
+}
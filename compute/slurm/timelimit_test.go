@@ -0,0 +1,52 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeLimit(t *testing.T) {
+	tests := []struct {
+		limit   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{limit: "30", want: 30 * time.Minute},
+		{limit: "30:15", want: 30*time.Minute + 15*time.Second},
+		{limit: "01:30:15", want: time.Hour + 30*time.Minute + 15*time.Second},
+		{limit: "2-03", want: 51 * time.Hour},
+		{limit: "2-03:30", want: 51*time.Hour + 30*time.Minute},
+		{limit: "1-01:01:01", want: 25*time.Hour + time.Minute + time.Second},
+		{limit: "UNLIMITED", wantErr: true},
+		{limit: "1:2:3:4", wantErr: true},
+		{limit: "-5", wantErr: true},
+		{limit: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.limit, func(t *testing.T) {
+			got, err := ParseTimeLimit(tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimeLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseTimeLimit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
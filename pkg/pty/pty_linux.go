@@ -0,0 +1,86 @@
+//go:build linux
+
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pty
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Open allocates a new pseudo-terminal, and returns its master and slave ends.
+func Open() (master *os.File, slave *os.File, err error) {
+	masterFd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot open /dev/ptmx")
+	}
+
+	// a non-blocking descriptor makes the master pollable, so that pending reads are interrupted on Close.
+	if err := unix.SetNonblock(masterFd, true); err != nil {
+		unix.Close(masterFd)
+
+		return nil, nil, errors.Wrapf(err, "cannot set the pseudo-terminal to non-blocking mode")
+	}
+
+	master = os.NewFile(uintptr(masterFd), "/dev/ptmx")
+
+	// unlock the slave end (equivalent of unlockpt).
+	if err := unix.IoctlSetPointerInt(masterFd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+
+		return nil, nil, errors.Wrapf(err, "cannot unlock the pseudo-terminal")
+	}
+
+	index, err := unix.IoctlGetInt(masterFd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+
+		return nil, nil, errors.Wrapf(err, "cannot get the number of the pseudo-terminal")
+	}
+
+	slaveName := "/dev/pts/" + strconv.Itoa(index)
+
+	slaveFd, err := unix.Open(slaveName, unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+
+		return nil, nil, errors.Wrapf(err, "cannot open '%s'", slaveName)
+	}
+
+	return master, os.NewFile(uintptr(slaveFd), slaveName), nil
+}
+
+// Resize sets the window size of the pseudo-terminal. The foreground process of the terminal receives SIGWINCH.
+func Resize(terminal *os.File, rows uint16, cols uint16) error {
+	// Fd() would switch the descriptor to blocking mode.
+	conn, err := terminal.SyscallConn()
+	if err != nil {
+		return errors.Wrapf(err, "cannot access the pseudo-terminal")
+	}
+
+	var ioctlErr error
+
+	if err := conn.Control(func(fd uintptr) {
+		ioctlErr = unix.IoctlSetWinsize(int(fd), unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols})
+	}); err != nil {
+		return errors.Wrapf(err, "cannot access the pseudo-terminal")
+	}
+
+	return ioctlErr
+}
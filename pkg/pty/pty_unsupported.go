@@ -0,0 +1,36 @@
+//go:build !linux
+
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pty
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupported is returned on platforms without support for pseudo-terminals.
+var ErrUnsupported = errors.New("pseudo-terminals are not supported on this platform")
+
+// Open allocates a new pseudo-terminal, and returns its master and slave ends.
+func Open() (master *os.File, slave *os.File, err error) {
+	return nil, nil, ErrUnsupported
+}
+
+// Resize sets the window size of the pseudo-terminal. The foreground process of the terminal receives SIGWINCH.
+func Resize(terminal *os.File, rows uint16, cols uint16) error {
+	return ErrUnsupported
+}
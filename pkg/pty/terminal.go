@@ -0,0 +1,225 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pty runs commands on pseudo-terminals, so that clients can attach to them.
+package pty
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// endOfTransmission (Ctrl-D) signals the end of input to the foreground process of a terminal.
+const endOfTransmission = 0x04
+
+// Size is the window size of a terminal.
+type Size struct {
+	Rows uint16
+	Cols uint16
+}
+
+// Terminal is a command that runs on a pseudo-terminal. The output of the terminal is appended to a log file,
+// and streamed to every attached client. It must be created with Start.
+type Terminal struct {
+	cmd    *exec.Cmd
+	master *os.File
+	log    *os.File
+
+	clients     map[io.Writer]struct{}
+	clientsLock sync.Mutex
+
+	done chan struct{}
+	err  error
+}
+
+// Start runs the command on a new pseudo-terminal, as the leader of a new session. The terminal becomes the
+// stdin and stdout of the command, and also its stderr, unless the command has its own.
+func Start(cmd *exec.Cmd, logFile string) (*Terminal, error) {
+	log, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open log file '%s'", logFile)
+	}
+
+	master, slave, err := Open()
+	if err != nil {
+		log.Close()
+
+		return nil, err
+	}
+
+	// the parent does not need the slave end, once it is inherited by the command.
+	defer slave.Close()
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+
+	if cmd.Stderr == nil {
+		cmd.Stderr = slave
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		log.Close()
+
+		return nil, errors.Wrapf(err, "cannot start '%s'", cmd.String())
+	}
+
+	t := &Terminal{
+		cmd:     cmd,
+		master:  master,
+		log:     log,
+		clients: make(map[io.Writer]struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go t.run()
+
+	return t, nil
+}
+
+// run streams the output of the terminal until the command exits.
+func (t *Terminal) run() {
+	streamed := make(chan struct{})
+
+	go func() {
+		defer close(streamed)
+
+		buf := make([]byte, 32*1024)
+
+		for {
+			n, err := t.master.Read(buf)
+			if n > 0 {
+				t.broadcast(buf[:n])
+			}
+
+			// the master fails with EIO once the command and its children have closed the terminal.
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	t.err = t.cmd.Wait()
+
+	<-streamed
+
+	t.master.Close()
+	t.log.Close()
+
+	close(t.done)
+}
+
+func (t *Terminal) broadcast(data []byte) {
+	_, _ = t.log.Write(data)
+
+	t.clientsLock.Lock()
+	defer t.clientsLock.Unlock()
+
+	for client := range t.clients {
+		// drop clients that have gone away, without affecting the rest.
+		if _, err := client.Write(data); err != nil {
+			delete(t.clients, client)
+		}
+	}
+}
+
+// Attach copies the stdin to the terminal, and the output of the terminal to the stdout, until the stdin is closed,
+// the context is cancelled, or the command exits. Resize requests are applied to the terminal.
+// Any of stdin, stdout, and resize may be nil. Multiple clients may be attached at the same time.
+func (t *Terminal) Attach(ctx context.Context, stdin io.Reader, stdout io.Writer, resize <-chan Size) error {
+	select {
+	case <-t.done:
+		return errors.New("terminal has exited")
+	default:
+	}
+
+	if stdout != nil {
+		t.clientsLock.Lock()
+		t.clients[stdout] = struct{}{}
+		t.clientsLock.Unlock()
+
+		defer func() {
+			t.clientsLock.Lock()
+			delete(t.clients, stdout)
+			t.clientsLock.Unlock()
+		}()
+	}
+
+	detached := make(chan struct{})
+
+	if stdin != nil {
+		go func() {
+			defer close(detached)
+
+			_, _ = io.Copy(t.master, stdin)
+		}()
+	}
+
+	if resize != nil {
+		go func() {
+			for {
+				select {
+				case size, ok := <-resize:
+					if !ok {
+						return
+					}
+
+					_ = Resize(t.master, size.Rows, size.Cols)
+				case <-ctx.Done():
+					return
+				case <-t.done:
+					return
+				}
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-detached:
+	case <-t.done:
+	}
+
+	return nil
+}
+
+// CloseStdin signals the end of input to the foreground process of the terminal.
+func (t *Terminal) CloseStdin() error {
+	_, err := t.master.Write([]byte{endOfTransmission})
+
+	return err
+}
+
+// Close hangs up the terminal, which sends SIGHUP to the command.
+func (t *Terminal) Close() error {
+	return t.master.Close()
+}
+
+// Done is closed once the command has exited.
+func (t *Terminal) Done() <-chan struct{} {
+	return t.done
+}
+
+// Err returns the exit error of the command. It is only meaningful once Done is closed.
+func (t *Terminal) Err() error {
+	return t.err
+}
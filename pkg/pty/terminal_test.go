@@ -0,0 +1,141 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pty_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/pkg/pty"
+)
+
+// syncBuffer collects the output of the terminal, which is written from another goroutine.
+type syncBuffer struct {
+	sync.Mutex
+	strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.Builder.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.Builder.String()
+}
+
+func TestTerminal(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		input  string
+		size   *pty.Size
+		want   string
+	}{
+		{
+			name:   "echo",
+			script: `read line; echo "got ${line}"`,
+			input:  "hello\n",
+			want:   "got hello",
+		},
+		{
+			name:   "tty",
+			script: `read line; [[ -t 0 && -t 1 ]] && echo "is a tty"`,
+			input:  "\n",
+			want:   "is a tty",
+		},
+		{
+			name:   "resize",
+			script: `read line; stty size`,
+			input:  "\n",
+			size:   &pty.Size{Rows: 42, Cols: 120},
+			want:   "42 120",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logFile := filepath.Join(t.TempDir(), "container.log")
+
+			terminal, err := pty.Start(exec.Command("bash", "-c", tt.script), logFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stdin, input := io.Pipe()
+			output := &syncBuffer{}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			resize := make(chan pty.Size, 1)
+			if tt.size != nil {
+				resize <- *tt.size
+			}
+
+			attached := make(chan error)
+
+			go func() {
+				attached <- terminal.Attach(ctx, stdin, output, resize)
+			}()
+
+			// wait until the client is registered and resized, so that no output is missed.
+			time.Sleep(100 * time.Millisecond)
+
+			if _, err := io.WriteString(input, tt.input); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case <-terminal.Done():
+			case <-ctx.Done():
+				t.Fatal("terminal has not exited")
+			}
+
+			if err := <-attached; err != nil {
+				t.Errorf("Attach() error = %v", err)
+			}
+
+			if terminal.Err() != nil {
+				t.Errorf("Err() = %v, output: %s", terminal.Err(), output.String())
+			}
+
+			if !strings.Contains(output.String(), tt.want) {
+				t.Errorf("output = %q, want %q", output.String(), tt.want)
+			}
+
+			logs, err := os.ReadFile(logFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(string(logs), tt.want) {
+				t.Errorf("logs = %q, want %q", logs, tt.want)
+			}
+		})
+	}
+}
@@ -15,6 +15,8 @@
 package resources
 
 import (
+	"strings"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 )
@@ -60,6 +62,19 @@ func Sum(aggr corev1.ResourceList, rlist ...corev1.ResourceList) {
 		}
 	}
 
+	// extended resources (e.g, nvidia.com/gpu) are summarized as they are.
+	for _, list := range rlist {
+		for name, quantity := range list {
+			if !IsExtendedResourceName(name) {
+				continue
+			}
+
+			total := aggr[name]
+			total.Add(quantity)
+			aggr[name] = total
+		}
+	}
+
 	// replace
 	aggr[corev1.ResourceCPU] = totalCPU.DeepCopy()
 	aggr[corev1.ResourceMemory] = totalMem.DeepCopy()
@@ -75,6 +90,19 @@ type ResourceList struct {
 
 	// Memory is the number of requests MBs of memory.
 	Memory *int64
+
+	// Extended are the requested extended resources (e.g, nvidia.com/gpu), which are always integers.
+	Extended map[corev1.ResourceName]int64
+}
+
+// IsExtendedResourceName returns true for the fully-qualified resource names outside the kubernetes.io domain.
+func IsExtendedResourceName(name corev1.ResourceName) bool {
+	domain, _, qualified := strings.Cut(string(name), "/")
+	if !qualified {
+		return false
+	}
+
+	return domain != "kubernetes.io" && !strings.HasSuffix(domain, ".kubernetes.io")
 }
 
 func ResourceListToStruct(list corev1.ResourceList) ResourceList {
@@ -90,5 +118,15 @@ func ResourceListToStruct(list corev1.ResourceList) ResourceList {
 		rlist.Memory = &val
 	}
 
+	for name, quantity := range list {
+		if IsExtendedResourceName(name) && !quantity.IsZero() {
+			if rlist.Extended == nil {
+				rlist.Extended = make(map[corev1.ResourceName]int64)
+			}
+
+			rlist.Extended[name] = quantity.Value()
+		}
+	}
+
 	return rlist
 }
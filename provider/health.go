@@ -0,0 +1,206 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// Node conditions that reflect the state of Slurm.
+const (
+	// NodeSlurmControllerReachable is True while the Slurm controller responds to pings.
+	NodeSlurmControllerReachable corev1.NodeConditionType = "SlurmControllerReachable"
+
+	// NodePartitionDown is True if any partition of the node has no node that accepts new jobs.
+	NodePartitionDown corev1.NodeConditionType = "PartitionDown"
+)
+
+// UnreachableTaintKey is the NoSchedule taint of virtual nodes, while the Slurm controller is unreachable or none of
+// the partitions of the node accepts new jobs. New pods are not scheduled on the node, so they do not pile up in a
+// dead queue. Running pods are not affected.
+const UnreachableTaintKey = "slurm.hpk.io/unreachable"
+
+// HealthFunc returns the state of the Slurm controller and partitions.
+type HealthFunc func() slurm.Health
+
+// NodeConditions translates the health of Slurm into the conditions of a virtual node that represents
+// the given partitions. If no partition is given, the node represents the whole cluster.
+//
+// The node is Ready if the controller is reachable and at least one of its partitions accepts new jobs.
+// A Ready=False node gets the NoExecute taint of the node lifecycle controller, so short outages are filtered
+// by UnhealthyThreshold, and pods that must survive longer outages should tolerate node.kubernetes.io/not-ready.
+// The pressure conditions of the kubelet are meaningless for Slurm, and are always False.
+func NodeConditions(health slurm.Health, partitions []string) []corev1.NodeCondition {
+	now := metav1.Now()
+
+	condition := func(conditionType corev1.NodeConditionType, status corev1.ConditionStatus, reason string, message string) corev1.NodeCondition {
+		return corev1.NodeCondition{
+			Type:               conditionType,
+			Status:             status,
+			LastHeartbeatTime:  now,
+			LastTransitionTime: now,
+			Reason:             reason,
+			Message:            message,
+		}
+	}
+
+	var ready, reachable, partitionDown corev1.NodeCondition
+
+	if !health.Reachable() {
+		message := fmt.Sprintf("Slurm controller is unreachable: %v", health.ControllerErr)
+
+		reachable = condition(NodeSlurmControllerReachable, corev1.ConditionFalse, "PingFailed", message)
+		partitionDown = condition(NodePartitionDown, corev1.ConditionUnknown, "SlurmControllerUnreachable", "the state of the partitions is unknown")
+		ready = condition(corev1.NodeReady, corev1.ConditionFalse, "SlurmUnreachable", message)
+	} else {
+		reachable = condition(NodeSlurmControllerReachable, corev1.ConditionTrue, "PingSucceeded", "Slurm controller is reachable")
+
+		if down := health.DownPartitions(partitions...); len(down) > 0 {
+			partitionDown = condition(NodePartitionDown, corev1.ConditionTrue, "PartitionDown",
+				"partitions without available nodes: "+strings.Join(down, ", "))
+		} else {
+			partitionDown = condition(NodePartitionDown, corev1.ConditionFalse, "PartitionsUp", "all partitions have available nodes")
+		}
+
+		if AcceptsJobs(health, partitions) {
+			ready = condition(corev1.NodeReady, corev1.ConditionTrue, "KubeletReady", "Slurm is accepting new jobs")
+		} else {
+			ready = condition(corev1.NodeReady, corev1.ConditionFalse, "PartitionDown", "no partition accepts new jobs")
+		}
+	}
+
+	return []corev1.NodeCondition{
+		ready,
+		reachable,
+		partitionDown,
+		condition(corev1.NodeMemoryPressure, corev1.ConditionFalse, "KubeletHasSufficientMemory", "kubelet has sufficient memory available"),
+		condition(corev1.NodeDiskPressure, corev1.ConditionFalse, "KubeletHasNoDiskPressure", "kubelet has no disk pressure"),
+		condition(corev1.NodePIDPressure, corev1.ConditionFalse, "KubeletHasNoPIDPressure", "kubelet has no PID pressure"),
+		condition(corev1.NodeNetworkUnavailable, corev1.ConditionFalse, "RouteCreated", "RouteController created a route"),
+	}
+}
+
+// AcceptsJobs returns true if the controller is reachable, and at least one of the partitions accepts new jobs.
+// If no partition is given, all the known partitions are considered.
+func AcceptsJobs(health slurm.Health, partitions []string) bool {
+	if !health.Reachable() {
+		return false
+	}
+
+	known := len(partitions)
+	if known == 0 {
+		known = len(health.Partitions)
+	}
+
+	return known == 0 || len(health.DownPartitions(partitions...)) < known
+}
+
+// mergeConditions keeps the transition time of the conditions whose status has not changed.
+// It returns true if any condition differs from the previous ones, ignoring the timestamps.
+func mergeConditions(previous []corev1.NodeCondition, conditions []corev1.NodeCondition) bool {
+	changed := len(previous) != len(conditions)
+
+	for i := range conditions {
+		var old *corev1.NodeCondition
+
+		for j := range previous {
+			if previous[j].Type == conditions[i].Type {
+				old = &previous[j]
+
+				break
+			}
+		}
+
+		if old == nil {
+			changed = true
+
+			continue
+		}
+
+		if old.Status == conditions[i].Status {
+			conditions[i].LastTransitionTime = old.LastTransitionTime
+		}
+
+		if old.Status != conditions[i].Status || old.Reason != conditions[i].Reason || old.Message != conditions[i].Message {
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// setUnreachableTaint adds or removes the UnreachableTaintKey taint on the given node, and returns
+// true if the taints have changed. Taints are part of the node spec, which the node controller does not update.
+func setUnreachableTaint(ctx context.Context, nodeName string, tainted bool) (bool, error) {
+	nodes := compute.K8SClientset.CoreV1().Nodes()
+
+	changed := false
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := nodes.Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		var (
+			taints []corev1.Taint
+			exists bool
+		)
+
+		for _, taint := range node.Spec.Taints {
+			if taint.Key == UnreachableTaintKey {
+				exists = true
+
+				continue
+			}
+
+			taints = append(taints, taint)
+		}
+
+		if exists == tainted {
+			return nil
+		}
+
+		if tainted {
+			now := metav1.Now()
+
+			taints = append(taints, corev1.Taint{
+				Key:       UnreachableTaintKey,
+				Effect:    corev1.TaintEffectNoSchedule,
+				TimeAdded: &now,
+			})
+		}
+
+		node.Spec.Taints = taints
+
+		if _, err := nodes.Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+
+		changed = true
+
+		return nil
+	})
+
+	return changed, err
+}
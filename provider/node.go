@@ -18,11 +18,15 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"strings"
 
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
 	"github.com/carv-ics-forth/hpk/compute/slurm"
 	"github.com/matishsiao/goInfo"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // NewVirtualNode builds a kubernetes node object from a provider
@@ -30,10 +34,24 @@ import (
 func (v *VirtualK8S) NewVirtualNode(ctx context.Context, nodename string, taint *corev1.Taint) *corev1.Node {
 	taints := make([]corev1.Taint, 0)
 
+	capacity, allocatable, err := scheduler.Default.Capacity()
+	if err != nil {
+		compute.SystemPanic(err, "unable to get the capacity of the scheduler")
+	}
+
 	if taint != nil {
 		taints = append(taints, *taint)
 	}
 
+	return v.newNode(ctx, nodename, taints, capacity, allocatable, nil)
+}
+
+func (v *VirtualK8S) newNode(ctx context.Context, nodename string, taints []corev1.Taint,
+	capacity corev1.ResourceList, allocatable corev1.ResourceList, partitions []string,
+) *corev1.Node {
+	// the state of the partitions is refreshed by the NodeProvider.
+	health := slurm.Health{ControllerErr: scheduler.Default.Ping()}
+
 	return &corev1.Node{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: nodename,
@@ -51,19 +69,71 @@ func (v *VirtualK8S) NewVirtualNode(ctx context.Context, nodename string, taint
 			NodeInfo:        v.NodeSystemInfo(ctx),
 			Addresses:       v.NodeAddresses(ctx),
 			DaemonEndpoints: v.NodeDaemonEndpoints(ctx),
-			Conditions:      NodeConditions(ctx),
+			Conditions:      NodeConditions(health, partitions),
 			Phase: func() corev1.NodePhase {
-				if slurm.ConnectionOK() {
+				if health.Reachable() {
 					return corev1.NodeRunning
 				}
 				return corev1.NodePending
 			}(),
-			Capacity:    slurm.TotalResources(),
-			Allocatable: slurm.AllocatableResources(ctx),
+			Capacity:    capacity,
+			Allocatable: allocatable,
 		},
 	}
 }
 
+// Labels of the per-partition virtual nodes.
+const (
+	PartitionLabel     = "slurm.hpk.io/partition"
+	FeatureLabelPrefix = "feature.slurm.hpk.io/"
+)
+
+// PartitionNodeName returns the name of the virtual node that represents the given partition.
+func PartitionNodeName(nodename string, partition string) string {
+	return nodename + "-" + strings.ReplaceAll(strings.ToLower(partition), "_", "-")
+}
+
+// NewPartitionNode builds a virtual node that represents a single Slurm partition.
+// The node advertises the capacity of the partition, and is labeled with its architecture and features.
+func (v *VirtualK8S) NewPartitionNode(ctx context.Context, nodename string, partition slurm.PartitionInfo, taints []corev1.Taint) *corev1.Node {
+	virtualNode := v.newNode(ctx, nodename, taints, partition.Capacity, partition.Allocatable, []string{partition.Name})
+
+	virtualNode.Labels[PartitionLabel] = partition.Name
+
+	// heterogeneous partitions keep the architecture of the host.
+	if len(partition.Architectures) == 1 {
+		virtualNode.Labels["kubernetes.io/arch"] = goArch(partition.Architectures[0])
+	}
+
+	for _, feature := range partition.Features {
+		key := FeatureLabelPrefix + feature
+
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			v.Logger.Info("Skip feature that is not a valid label", "partition", partition.Name, "feature", feature)
+
+			continue
+		}
+
+		virtualNode.Labels[key] = "true"
+	}
+
+	return virtualNode
+}
+
+// goArch translates the architecture reported by Slurm (uname -m) to the one used by Kubernetes.
+func goArch(machine string) string {
+	switch machine {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "ppc64le", "s390x":
+		return machine
+	default:
+		return runtime.GOARCH
+	}
+}
+
 // ConfigureNode enables a provider to configure the node object that
 // will be used for Kubernetes.
 func (v *VirtualK8S) ConfigureNode(ctx context.Context, node *corev1.Node) {
@@ -76,57 +146,6 @@ func (v *VirtualK8S) ConfigureNode(ctx context.Context, node *corev1.Node) {
 	panic("not yet supported")
 }
 
-// NodeConditions creates a slice of node conditions representing a
-// kubelet in perfect health. These four conditions are the ones which virtual-kubelet
-// sets as Unknown when a Ping fails.
-func NodeConditions(_ context.Context) []corev1.NodeCondition {
-	// NodeConditions returns a list of conditions (Ready, OutOfDisk, etc), for updates to the node status
-	// within Kubernetes.
-	// TODO: Make this configurable
-	return []corev1.NodeCondition{
-		{
-			Type:               corev1.NodeReady,
-			Status:             corev1.ConditionTrue,
-			LastHeartbeatTime:  metav1.Now(),
-			LastTransitionTime: metav1.Now(),
-			Reason:             "KubeletPending",
-			Message:            "kubelet is pending.",
-		},
-		{
-			Type:               corev1.NodeMemoryPressure,
-			Status:             corev1.ConditionFalse,
-			LastHeartbeatTime:  metav1.Now(),
-			LastTransitionTime: metav1.Now(),
-			Reason:             "KubeletHasSufficientMemory",
-			Message:            "kubelet has sufficient memory available",
-		},
-		{
-			Type:               corev1.NodeDiskPressure,
-			Status:             corev1.ConditionFalse,
-			LastHeartbeatTime:  metav1.Now(),
-			LastTransitionTime: metav1.Now(),
-			Reason:             "KubeletHasNoDiskPressure",
-			Message:            "kubelet has no disk pressure",
-		},
-		{
-			Type:               corev1.NodePIDPressure,
-			Status:             corev1.ConditionFalse,
-			LastHeartbeatTime:  metav1.Now(),
-			LastTransitionTime: metav1.Now(),
-			Reason:             "KubeletHasNoPIDPressure",
-			Message:            "kubelet has no PID pressure",
-		},
-		{
-			Type:               corev1.NodeNetworkUnavailable,
-			Status:             corev1.ConditionFalse,
-			LastHeartbeatTime:  metav1.Now(),
-			LastTransitionTime: metav1.Now(),
-			Reason:             "RouteCreated",
-			Message:            "RouteController created a route",
-		},
-	}
-}
-
 func (v *VirtualK8S) NodeAddresses(_ context.Context) []corev1.NodeAddress {
 	return []corev1.NodeAddress{
 		{
@@ -0,0 +1,215 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// CapacityFunc returns the current capacity and allocatable resources of a virtual node.
+type CapacityFunc func() (capacity corev1.ResourceList, allocatable corev1.ResourceList, err error)
+
+// UnhealthyThreshold is the number of consecutive failed health checks before the outage is reflected on the
+// conditions of the virtual node, and the node is tainted as unreachable. It prevents short outages of the
+// Slurm controller from flapping the node.
+var UnhealthyThreshold = 3
+
+// NodeProvider keeps the status of a virtual node in sync with the resources and the health of the cluster.
+// It must be created with NewNodeProvider.
+type NodeProvider struct {
+	capacity CapacityFunc
+	health   HealthFunc
+	interval time.Duration
+
+	// partitions are the Slurm partitions that the node represents. Empty for the whole cluster.
+	partitions []string
+
+	// failures counts the consecutive health checks that have found the Slurm controller unreachable.
+	failures int
+
+	// taint adds or removes the UnreachableTaintKey taint on the node.
+	taint func(ctx context.Context, nodeName string, tainted bool) (bool, error)
+
+	notify      func(*corev1.Node)
+	updateReady chan struct{}
+
+	// node is the last status that was sent to the node controller.
+	node     *corev1.Node
+	nodeLock sync.Mutex
+}
+
+// NewNodeProvider returns a provider that refreshes the capacity and the conditions of the node every interval.
+// If the interval is 0, the node is never refreshed.
+func NewNodeProvider(node *corev1.Node, interval time.Duration, capacity CapacityFunc, health HealthFunc) *NodeProvider {
+	var partitions []string
+
+	if partition, exists := node.GetLabels()[PartitionLabel]; exists {
+		partitions = []string{partition}
+	}
+
+	return &NodeProvider{
+		capacity:    capacity,
+		health:      health,
+		interval:    interval,
+		partitions:  partitions,
+		taint:       setUnreachableTaint,
+		updateReady: make(chan struct{}),
+		node:        node.DeepCopy(),
+	}
+}
+
+// Ping just implements the NodeProvider interface.
+// It returns the error from the passed in context only.
+func (p *NodeProvider) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// NotifyNodeStatus implements the NodeProvider interface, and starts refreshing the capacity of the node.
+// It assumes that it is called only once, which is indeed true for the node controller.
+func (p *NodeProvider) NotifyNodeStatus(ctx context.Context, f func(*corev1.Node)) {
+	p.notify = f
+	close(p.updateReady)
+
+	if p.interval > 0 {
+		go p.refreshLoop(ctx)
+	}
+}
+
+// UpdateStatus sends a node status update to the node controller.
+func (p *NodeProvider) UpdateStatus(ctx context.Context, node *corev1.Node) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.updateReady:
+	}
+
+	p.nodeLock.Lock()
+	p.node = node.DeepCopy()
+	p.nodeLock.Unlock()
+
+	p.notify(node)
+
+	return nil
+}
+
+func (p *NodeProvider) refreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.refresh(ctx)
+		}
+	}
+}
+
+// refresh patches the status of the node, if its capacity or its conditions have changed since the last update.
+// While Slurm does not accept new jobs, the node is tainted so that new pods are not scheduled on it.
+func (p *NodeProvider) refresh(ctx context.Context) {
+	health := p.health()
+	unschedulable := !AcceptsJobs(health, p.partitions)
+
+	if health.Reachable() {
+		p.failures = 0
+	} else {
+		p.failures++
+
+		if p.failures < UnhealthyThreshold {
+			compute.DefaultLogger.Info("Slurm health check has failed",
+				"node", p.node.GetName(),
+				"failures", p.failures,
+				"err", health.ControllerErr,
+			)
+
+			return
+		}
+	}
+
+	var capacity, allocatable corev1.ResourceList
+
+	if health.Reachable() {
+		var err error
+
+		capacity, allocatable, err = p.capacity()
+		if err != nil {
+			compute.DefaultLogger.Error(err, "Unable to refresh the capacity of the node")
+		}
+	}
+
+	conditions := NodeConditions(health, p.partitions)
+
+	p.nodeLock.Lock()
+
+	conditionsChanged := mergeConditions(p.node.Status.Conditions, conditions)
+	capacityChanged := false
+
+	p.node.Status.Conditions = conditions
+
+	if health.Reachable() {
+		p.node.Status.Phase = corev1.NodeRunning
+	} else {
+		p.node.Status.Phase = corev1.NodePending
+	}
+
+	if capacity != nil && (!equality.Semantic.DeepEqual(p.node.Status.Capacity, capacity) ||
+		!equality.Semantic.DeepEqual(p.node.Status.Allocatable, allocatable)) {
+		p.node.Status.Capacity = capacity
+		p.node.Status.Allocatable = allocatable
+
+		compute.DefaultLogger.Info("Node capacity has changed",
+			"node", p.node.GetName(),
+			"capacity", capacity,
+			"allocatable", allocatable,
+		)
+
+		capacityChanged = true
+	}
+
+	node := p.node.DeepCopy()
+
+	p.nodeLock.Unlock()
+
+	// the taint is reconciled on every refresh, as it may be left over from a previous run.
+	tainted, err := p.taint(ctx, node.GetName(), unschedulable)
+	if err != nil {
+		compute.DefaultLogger.Error(err, "Unable to update the unreachable taint of the node", "node", node.GetName())
+	} else if tainted {
+		compute.DefaultLogger.Info("Node taints have changed",
+			"node", node.GetName(),
+			"unschedulable", unschedulable,
+		)
+	}
+
+	if conditionsChanged {
+		compute.DefaultLogger.Info("Node conditions have changed",
+			"node", node.GetName(),
+			"reachable", health.Reachable(),
+			"downPartitions", health.DownPartitions(p.partitions...),
+		)
+	}
+
+	if conditionsChanged || capacityChanged {
+		p.notify(node)
+	}
+}
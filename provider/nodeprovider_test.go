@@ -0,0 +1,201 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeNode records the updates of the node provider, in place of the node controller and the api server.
+type fakeNode struct {
+	health   slurm.Health
+	tainted  bool
+	notified []*corev1.Node
+}
+
+func newTestNodeProvider(t *testing.T, labels map[string]string) (*NodeProvider, *fakeNode) {
+	t.Helper()
+
+	fake := &fakeNode{health: slurm.Health{Partitions: map[string]bool{"cpu": true, "gpu": true}}}
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "hpk-kubelet", Labels: labels}}
+
+	capacity := func() (corev1.ResourceList, corev1.ResourceList, error) {
+		resources := corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("64")}
+
+		return resources, resources, nil
+	}
+
+	p := NewNodeProvider(node, 0, capacity, func() slurm.Health { return fake.health })
+
+	p.taint = func(_ context.Context, _ string, tainted bool) (bool, error) {
+		changed := fake.tainted != tainted
+		fake.tainted = tainted
+
+		return changed, nil
+	}
+
+	p.NotifyNodeStatus(context.Background(), func(node *corev1.Node) {
+		fake.notified = append(fake.notified, node)
+	})
+
+	return p, fake
+}
+
+func nodeCondition(node *corev1.Node, conditionType corev1.NodeConditionType) corev1.ConditionStatus {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status
+		}
+	}
+
+	return ""
+}
+
+func TestNodeProviderRefresh(t *testing.T) {
+	unreachable := slurm.Health{ControllerErr: errors.New("Unable to contact slurm controller")}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		health []slurm.Health
+
+		expectedNotifications int
+		expectedTainted       bool
+		expectedReady         []corev1.ConditionStatus
+		expectedReachable     corev1.ConditionStatus
+		expectedPartitionDown corev1.ConditionStatus
+	}{
+		{
+			name:   "healthy",
+			health: []slurm.Health{{Partitions: map[string]bool{"cpu": true, "gpu": true}}},
+
+			expectedNotifications: 1,
+			expectedReady:         []corev1.ConditionStatus{corev1.ConditionTrue},
+			expectedReachable:     corev1.ConditionTrue,
+			expectedPartitionDown: corev1.ConditionFalse,
+		},
+		{
+			name:   "short outage is ignored",
+			health: []slurm.Health{unreachable, unreachable},
+
+			expectedNotifications: 0,
+		},
+		{
+			name:   "unreachable controller",
+			health: []slurm.Health{unreachable, unreachable, unreachable},
+
+			expectedNotifications: 1,
+			expectedReady:         []corev1.ConditionStatus{corev1.ConditionFalse},
+			expectedTainted:       true,
+			expectedReachable:     corev1.ConditionFalse,
+			expectedPartitionDown: corev1.ConditionUnknown,
+		},
+		{
+			name:   "recovered controller",
+			health: []slurm.Health{unreachable, unreachable, unreachable, {Partitions: map[string]bool{"cpu": true}}},
+
+			expectedNotifications: 2,
+			expectedReady:         []corev1.ConditionStatus{corev1.ConditionFalse, corev1.ConditionTrue},
+			expectedReachable:     corev1.ConditionTrue,
+			expectedPartitionDown: corev1.ConditionFalse,
+		},
+		{
+			name:   "some partitions down",
+			health: []slurm.Health{{Partitions: map[string]bool{"cpu": true, "gpu": false}}},
+
+			expectedNotifications: 1,
+			expectedReady:         []corev1.ConditionStatus{corev1.ConditionTrue},
+			expectedReachable:     corev1.ConditionTrue,
+			expectedPartitionDown: corev1.ConditionTrue,
+		},
+		{
+			name:   "all partitions down",
+			health: []slurm.Health{{Partitions: map[string]bool{"cpu": false, "gpu": false}}},
+
+			expectedNotifications: 1,
+			expectedReady:         []corev1.ConditionStatus{corev1.ConditionFalse},
+			expectedTainted:       true,
+			expectedReachable:     corev1.ConditionTrue,
+			expectedPartitionDown: corev1.ConditionTrue,
+		},
+		{
+			name:   "partition of the node down",
+			labels: map[string]string{PartitionLabel: "gpu"},
+			health: []slurm.Health{{Partitions: map[string]bool{"cpu": true, "gpu": false}}},
+
+			expectedNotifications: 1,
+			expectedReady:         []corev1.ConditionStatus{corev1.ConditionFalse},
+			expectedTainted:       true,
+			expectedReachable:     corev1.ConditionTrue,
+			expectedPartitionDown: corev1.ConditionTrue,
+		},
+		{
+			name:   "unchanged status is not sent",
+			health: []slurm.Health{{Partitions: map[string]bool{"cpu": true}}, {Partitions: map[string]bool{"cpu": true}}},
+
+			expectedNotifications: 1,
+			expectedReady:         []corev1.ConditionStatus{corev1.ConditionTrue},
+			expectedReachable:     corev1.ConditionTrue,
+			expectedPartitionDown: corev1.ConditionFalse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, fake := newTestNodeProvider(t, tt.labels)
+
+			for _, health := range tt.health {
+				fake.health = health
+				p.refresh(context.Background())
+			}
+
+			if len(fake.notified) != tt.expectedNotifications {
+				t.Fatalf("expected %d notifications but got %d", tt.expectedNotifications, len(fake.notified))
+			}
+
+			if fake.tainted != tt.expectedTainted {
+				t.Errorf("expected tainted '%t' but got '%t'", tt.expectedTainted, fake.tainted)
+			}
+
+			for i, node := range fake.notified {
+				if status := nodeCondition(node, corev1.NodeReady); status != tt.expectedReady[i] {
+					t.Errorf("expected Ready '%s' on notification %d but got '%s'", tt.expectedReady[i], i, status)
+				}
+			}
+
+			if len(fake.notified) == 0 {
+				return
+			}
+
+			node := fake.notified[len(fake.notified)-1]
+
+			if status := nodeCondition(node, NodeSlurmControllerReachable); status != tt.expectedReachable {
+				t.Errorf("expected SlurmControllerReachable '%s' but got '%s'", tt.expectedReachable, status)
+			}
+
+			if status := nodeCondition(node, NodePartitionDown); status != tt.expectedPartitionDown {
+				t.Errorf("expected PartitionDown '%s' but got '%s'", tt.expectedPartitionDown, status)
+			}
+		})
+	}
+}
@@ -28,8 +28,10 @@ import (
 	"github.com/carv-ics-forth/hpk/compute/events"
 	PodHandler "github.com/carv-ics-forth/hpk/compute/podhandler"
 	"github.com/carv-ics-forth/hpk/compute/runtime"
+	"github.com/carv-ics-forth/hpk/compute/scheduler"
 	"github.com/carv-ics-forth/hpk/compute/slurm"
 	"github.com/carv-ics-forth/hpk/pkg/container"
+	"github.com/carv-ics-forth/hpk/pkg/pty"
 	"github.com/sirupsen/logrus"
 	"github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -44,6 +46,7 @@ import (
 	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
 	vkapi "github.com/virtual-kubelet/virtual-kubelet/node/api"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/util/json"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -58,6 +61,10 @@ type InitConfig struct {
 
 	FSPollingInterval time.Duration
 
+	// JobSyncInterval defines how often pods are reconciled against the state of their Slurm jobs.
+	// If zero, the reconciliation is disabled.
+	JobSyncInterval time.Duration
+
 	RestConfig *rest.Config
 }
 
@@ -261,6 +268,14 @@ func (v *VirtualK8S) UpdatePod(ctx context.Context, pod *corev1.Pod) error {
 		/* ... */
 	}
 
+	/*-- Kubernetes allows the deadline of a running pod to be set, or shortened --*/
+	if !equality.Semantic.DeepEqual(localPod.Spec.ActiveDeadlineSeconds, pod.Spec.ActiveDeadlineSeconds) &&
+		pod.Spec.ActiveDeadlineSeconds != nil {
+		if err := v.updateDeadline(pod); err != nil {
+			logger.Error(err, "Failed to update the time limit of the job")
+		}
+	}
+
 	if statusDiff := pretty.Diff(localPod.Status, pod.Status); len(statusDiff) > 0 {
 		/* ... */
 	}
@@ -273,6 +288,32 @@ func (v *VirtualK8S) UpdatePod(ctx context.Context, pod *corev1.Pod) error {
 	return nil
 }
 
+// updateDeadline propagates the activeDeadlineSeconds of the pod to the time limit of its job.
+func (v *VirtualK8S) updateDeadline(pod *corev1.Pod) error {
+	deadlineScheduler, ok := scheduler.Default.(scheduler.DeadlineScheduler)
+	if !ok {
+		return errors.New("the scheduler does not support time limits")
+	}
+
+	deadline := time.Duration(*pod.Spec.ActiveDeadlineSeconds) * time.Second
+
+	if err := deadlineScheduler.UpdateDeadline(slurm.GetJobID(pod), deadline); err != nil {
+		if errors.Is(err, slurm.ErrInvalidJob) {
+			// the job has already terminated.
+			return nil
+		}
+
+		return err
+	}
+
+	v.Logger.Info("Time limit of the job has been updated",
+		"obj", client.ObjectKeyFromObject(pod),
+		"deadline", deadline,
+	)
+
+	return nil
+}
+
 // DeletePod takes a Kubernetes Pod and deletes it from the provider. Once a pod is deleted, the provider is
 // expected to call the NotifyPods callback with a terminal pod status where all the containers are in a terminal
 // state, as well as the pod. DeletePod may be called multiple times for the same pod.
@@ -282,7 +323,8 @@ func (v *VirtualK8S) DeletePod(ctx context.Context, pod *corev1.Pod) error {
 
 	logger.Info("[K8s] -> DeletePod")
 
-	if !PodHandler.DeletePod(podKey, v.fileWatcher) {
+	// the pod is removed once its containers have terminated, or its grace period is over.
+	if !PodHandler.TerminatePod(pod, v.fileWatcher, v.updatedPod) {
 		logger.Info("[K8s] <- DeletePod (POD NOT FOUND)")
 
 		return errdefs.NotFoundf("object not found")
@@ -407,23 +449,59 @@ func (v *VirtualK8S) NotifyPods(ctx context.Context, f func(*corev1.Pod)) {
 		MaxQueueSize: 20,
 	})
 
-	go eh.Listen(ctx, events.PodControl{
-		UpdateStatus: PodHandler.UpdateStatusFromRuntime,
-		LoadFromDisk: PodHandler.LoadPodFromKey,
-		NotifyVirtualKubelet: func(pod *corev1.Pod) {
-			if pod == nil {
-				panic("this should not happen")
-			}
+	notifyVirtualKubelet := func(pod *corev1.Pod) {
+		if pod == nil {
+			panic("this should not happen")
+		}
 
-			f(pod)
+		f(pod)
 
-			v.Logger.Info(" * K8s status is synchronized",
-				"version", pod.ResourceVersion,
-				"phase", pod.Status.Phase,
-			)
-		},
+		v.Logger.Info(" * K8s status is synchronized",
+			"version", pod.ResourceVersion,
+			"phase", pod.Status.Phase,
+		)
+
+		/*-- once the pod has terminated, record the accounting of its job --*/
+		PodHandler.RecordAccounting(ctx, pod)
+	}
+
+	/*-- interactive pods cannot survive a restart of HPK, as their terminal is gone --*/
+	go func() {
+		orphaned, err := PodHandler.FailOrphanedInteractivePods(ctx)
+		if err != nil {
+			v.Logger.Error(err, "Unable to fail the orphaned interactive pods")
+		}
+
+		for _, pod := range orphaned {
+			notifyVirtualKubelet(pod)
+		}
+	}()
+
+	go eh.Listen(ctx, events.PodControl{
+		UpdateStatus:         PodHandler.UpdateStatusFromRuntime,
+		LoadFromDisk:         PodHandler.LoadPodFromKey,
+		NotifyVirtualKubelet: notifyVirtualKubelet,
 	})
 
+	/*---------------------------------------------------
+	 * Reconcile Pods against the state of Scheduler Jobs.
+	 *---------------------------------------------------*/
+	if v.InitConfig.JobSyncInterval > 0 {
+		reconciler := &scheduler.Reconciler{
+			Interval: v.InitConfig.JobSyncInterval,
+			Control: scheduler.PodControl{
+				ListPods:     PodHandler.LoadPods,
+				UpdateStatus: PodHandler.UpdateStatusFromRuntime,
+				SaveToDisk: func(pod *corev1.Pod) error {
+					return PodHandler.SavePodToFile(ctx, pod)
+				},
+				NotifyVirtualKubelet: notifyVirtualKubelet,
+			},
+		}
+
+		go reconciler.Run(ctx)
+	}
+
 	/*-- add fileWatcher events to queue to be processed asynchronously --*/
 	go func() {
 		for {
@@ -481,6 +559,11 @@ func (v *VirtualK8S) GetContainerLogs(ctx context.Context, namespace, podName, c
 
 	logfilePath := compute.HPK.Pod(podKey).Container(containerName).LogsPath()
 
+	/*-- the logs of the run before the last restart of the container --*/
+	if opts.Previous {
+		logfilePath = compute.HPK.Pod(podKey).Container(containerName).PreviousLogsPath()
+	}
+
 	/*---------------------------------------------------
 	 * Log Streaming (With Follow)
 	 *---------------------------------------------------*/
@@ -638,6 +721,60 @@ func (v *VirtualK8S) RunInContainer(ctx context.Context, namespace, podName, con
 	})
 }
 
+// AttachToContainer attaches to the terminal of an interactive pod, whose container has both stdin and tty.
+// The terminal is available from the submission of the pod, but carries no output until its allocation starts.
+func (v *VirtualK8S) AttachToContainer(ctx context.Context, namespace, podName, containerName string, attach vkapi.AttachIO) error {
+	podKey := client.ObjectKey{Namespace: namespace, Name: podName}
+	logger := v.Logger.WithValues("obj", podKey)
+
+	/*---------------------------------------------------
+	 * Preamble used for Request tracing on the logs
+	 *---------------------------------------------------*/
+	logger.Info("[K8s] -> AttachToContainer", "container", containerName)
+	defer logger.Info("[K8s] <- AttachToContainer", "container", containerName)
+
+	defer func() {
+		if attach.Stdout() != nil {
+			attach.Stdout().Close()
+		}
+		if attach.Stderr() != nil {
+			attach.Stderr().Close()
+		}
+	}()
+
+	var resize chan pty.Size
+
+	if attach.TTY() {
+		resize = make(chan pty.Size)
+
+		go func() {
+			for {
+				select {
+				case size := <-attach.Resize():
+					select {
+					case resize <- pty.Size{Rows: size.Height, Cols: size.Width}:
+					case <-ctx.Done():
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// the terminal merges stdout and stderr.
+	err := PodHandler.AttachToContainer(ctx, podKey, containerName, attach.Stdin(), attach.Stdout(), resize)
+	switch {
+	case errors.Is(err, PodHandler.ErrNotInteractive):
+		return errdefs.AsInvalidInput(err)
+	case errors.Is(err, PodHandler.ErrNoTerminal):
+		return errdefs.AsNotFound(err)
+	default:
+		return err
+	}
+}
+
 // termSize helps exec termSize
 type termSize struct {
 	attach vkapi.AttachIO